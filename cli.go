@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	answers "tokinfo/internal/answers"
+	cache "tokinfo/internal/cache"
+	config "tokinfo/internal/config"
+	gemini "tokinfo/internal/gemini"
+	history "tokinfo/internal/history"
+	preserve "tokinfo/internal/preserve"
+	prompt "tokinfo/internal/prompt"
+	ratelimit "tokinfo/internal/ratelimit"
+	usage "tokinfo/internal/usage"
+
+	"golang.org/x/term"
+)
+
+// usageError marks errors caused by invalid command-line usage. They exit with exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// usageErrorf returns a usageError with a formatted message.
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// isUsageError reports whether err was caused by invalid usage.
+func isUsageError(err error) bool {
+	var target *usageError
+	return errors.As(err, &target)
+}
+
+// --- Prompt Input ---
+
+// promptFlags select where the user's prompt comes from.
+type promptFlags struct {
+	input  *string
+	file   *string
+	path   string  // Set by read to the file the prompt came from, if any
+	preset *string // Prompt given by the program, such as a history rerun; no input is read
+}
+
+// addPromptFlags registers -p and -file on fs.
+func addPromptFlags(fs *flag.FlagSet) *promptFlags {
+	return &promptFlags{
+		input: fs.String("p", "", "Prompt string, path to a prompt file, @path, or - for stdin"),
+		file:  fs.String("file", "", "Read the prompt from this file, whatever its extension"),
+	}
+}
+
+// read returns the user's prompt from -p, -file, the positional arguments or
+// piped standard input, in that order. stdinUsed reports whether the prompt
+// was read from standard input, which then cannot be used to answer questions.
+func (f *promptFlags) read(positional []string, logger *slog.Logger) (text string, stdinUsed bool, err error) {
+	if f.preset != nil {
+		if *f.input != "" || *f.file != "" || len(positional) > 0 {
+			return "", false, usageErrorf("the prompt is given by the command; -p, -file and prompt arguments cannot be used")
+		}
+		return *f.preset, false, nil
+	}
+	input := *f.input
+	if input != "" && len(positional) > 0 {
+		return "", false, usageErrorf("use either -p or a positional prompt, not both")
+	}
+	if input == "" {
+		input = strings.Join(positional, " ")
+	}
+	if input != "" && *f.file != "" {
+		return "", false, usageErrorf("use either -file or a prompt argument, not both")
+	}
+
+	switch {
+	case *f.file != "":
+		f.path = *f.file
+		text, err = prompt.ReadFile(*f.file, logger)
+	case input != "":
+		stdinUsed = input == "-"
+		f.path = prompt.FilePath(input)
+		text, err = prompt.ReadInput(input, logger)
+	case prompt.StdinIsPiped():
+		// Nothing on the command line: the prompt is being piped in
+		stdinUsed = true
+		text, err = prompt.ReadStdin(os.Stdin, logger)
+	default:
+		return "", false, usageErrorf("a prompt is required (argument, -p, -file, or piped standard input)")
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read prompt input: %w", err)
+	}
+	logger.Info("read user prompt", "source", promptSource(f.path, stdinUsed), "bytes", len(text))
+	return text, stdinUsed, nil
+}
+
+// --- Diagnostics ---
+
+// logFlags configure the diagnostics logger. Logs never go to stdout, which
+// carries only the command's result.
+type logFlags struct {
+	verbose *bool
+	level   *string
+	format  *string
+	file    *string
+}
+
+// addLogFlags registers the logging flags on fs.
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		verbose: fs.Bool("verbose", false, "Log progress and request details (same as -log-level debug)"),
+		level:   fs.String("log-level", "warn", "Minimum level logged: debug, info, warn or error"),
+		format:  fs.String("log-format", "text", "Log format: text or json"),
+		file:    fs.String("log-file", "", "Append logs to this file instead of writing them to stderr"),
+	}
+}
+
+// open returns the logger described by the flags, writing to stderr unless
+// -log-file is given, and a function that closes the log file.
+func (f *logFlags) open(stderr io.Writer) (*slog.Logger, func(), error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		return nil, nil, usageErrorf("unknown -log-level value '%s' (expected debug, info, warn or error)", *f.level)
+	}
+	if *f.verbose {
+		level = slog.LevelDebug
+	}
+
+	w, closeFn := stderr, func() {}
+	if *f.file != "" {
+		file, err := os.OpenFile(*f.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, closeFn = file, func() { file.Close() }
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch *f.format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), closeFn, nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), closeFn, nil
+	default:
+		closeFn()
+		return nil, nil, usageErrorf("unknown -log-format value '%s' (expected text or json)", *f.format)
+	}
+}
+
+// --- Terminal Colors ---
+
+// addColorFlag registers -color on fs.
+func addColorFlag(fs *flag.FlagSet) *string {
+	return fs.String("color", "auto", "Color diffs: auto, always or never")
+}
+
+// colorEnabled resolves a -color value for output written to out.
+// "auto" colors only terminals and honors the NO_COLOR convention.
+func colorEnabled(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(out.Fd())), nil
+	default:
+		return false, usageErrorf("unknown -color value '%s' (expected auto, always or never)", mode)
+	}
+}
+
+// --- Clarifying Answers ---
+
+// answerList collects repeated -answer flags.
+type answerList []string
+
+func (a *answerList) String() string {
+	return strings.Join(*a, ", ")
+}
+
+func (a *answerList) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+// answerFlags control how clarifying questions are answered.
+type answerFlags struct {
+	file          *string
+	inline        *answerList
+	noInteractive *bool
+	unanswered    *string
+	preset        *answers.Set // Answers given by the program, overridden by the flags
+	memory        *memoryFlags
+	noMemory      *bool
+}
+
+// addAnswerFlags registers the answer flags on fs.
+func addAnswerFlags(fs *flag.FlagSet) *answerFlags {
+	f := &answerFlags{
+		file:          fs.String("answers", "", "YAML or JSON file mapping questions (or fragments or numbers) to answers"),
+		inline:        &answerList{},
+		noInteractive: fs.Bool("no-interactive", false, "Never ask questions; implied when stdin is not a terminal"),
+		unanswered:    fs.String("unanswered", "example", "What to do with unanswered questions when not interactive: example or skip"),
+		memory:        addMemoryFlags(fs),
+		noMemory:      fs.Bool("no-memory", os.Getenv("TOKINFO_NO_MEMORY") != "", "Neither reuse nor remember answers (default true if $TOKINFO_NO_MEMORY is set)"),
+	}
+	fs.Var(f.inline, "answer", `Answer a clarifying question as "question=value" (repeatable)`)
+	return f
+}
+
+// load returns the provided answers. -answer flags take precedence over the answers file.
+func (f *answerFlags) load() (*answers.Set, error) {
+	if *f.unanswered != "example" && *f.unanswered != "skip" {
+		return nil, usageErrorf("unknown -unanswered value '%s' (expected example or skip)", *f.unanswered)
+	}
+
+	provided := &answers.Set{}
+	if f.preset != nil {
+		provided.Merge(f.preset)
+	}
+	if *f.file != "" {
+		fromFile, err := answers.LoadFile(*f.file)
+		if err != nil {
+			return nil, err
+		}
+		provided.Merge(fromFile)
+	}
+	for _, value := range *f.inline {
+		key, answer, err := answers.ParseFlag(value)
+		if err != nil {
+			return nil, usageErrorf("%v", err)
+		}
+		provided.Add(key, answer)
+	}
+	return provided, nil
+}
+
+// rememberer returns the answer memory, or nil with -no-memory.
+func (f *answerFlags) rememberer() (*answers.Memory, error) {
+	if *f.noMemory {
+		return nil, nil
+	}
+	return f.memory.open()
+}
+
+// interactive reports whether unanswered questions should be asked on the terminal.
+// It is false when standard input carried the prompt or is not a terminal.
+func (f *answerFlags) interactive(stdinUsed bool) bool {
+	return !*f.noInteractive && !stdinUsed && prompt.StdinIsTerminal()
+}
+
+// --- Answer Memory ---
+
+// memoryFlags select the answer memory and the project it is scoped to.
+type memoryFlags struct {
+	file    *string
+	project *string
+}
+
+// addMemoryFlags registers the answer memory flags on fs.
+func addMemoryFlags(fs *flag.FlagSet) *memoryFlags {
+	return &memoryFlags{
+		file:    fs.String("memory-file", "", "Answer memory file (default: $XDG_DATA_HOME/tokinfo/answers.json)"),
+		project: fs.String("project", "", "Project the remembered answers belong to (default: the git root or working directory)"),
+	}
+}
+
+// open returns the answer memory of the project.
+func (f *memoryFlags) open() (*answers.Memory, error) {
+	path := *f.file
+	if path == "" {
+		defaultPath, err := answers.DefaultMemoryPath()
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
+	}
+	project := *f.project
+	if project == "" {
+		var err error
+		if project, err = projectRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return answers.OpenMemory(path, project)
+}
+
+// projectRoot returns the nearest directory above the working directory
+// holding .git, or the working directory itself outside a repository.
+func projectRoot() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate working directory: %w", err)
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return wd, nil
+		}
+	}
+}
+
+// --- History ---
+
+// historyFlags select the history file runs are recorded in.
+type historyFlags struct {
+	file     *string
+	disabled *bool // Nil for commands that only read the history
+}
+
+// addHistoryFlags registers -history-file and -no-history on fs.
+func addHistoryFlags(fs *flag.FlagSet) *historyFlags {
+	f := addHistoryFileFlag(fs)
+	f.disabled = fs.Bool("no-history", os.Getenv("TOKINFO_NO_HISTORY") != "", "Do not record this run in the history (default true if $TOKINFO_NO_HISTORY is set)")
+	return f
+}
+
+// addHistoryFileFlag registers -history-file on fs, for commands that only
+// read the history.
+func addHistoryFileFlag(fs *flag.FlagSet) *historyFlags {
+	return &historyFlags{
+		file: fs.String("history-file", "", "History file (default: $XDG_DATA_HOME/tokinfo/history.jsonl)"),
+	}
+}
+
+// open returns the history store, ignoring -no-history.
+func (f *historyFlags) open() (*history.Store, error) {
+	path := *f.file
+	if path == "" {
+		defaultPath, err := history.DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
+	}
+	return history.Open(path), nil
+}
+
+// recorder returns the store runs are recorded in, or nil with -no-history.
+func (f *historyFlags) recorder() (*history.Store, error) {
+	if *f.disabled {
+		return nil, nil
+	}
+	return f.open()
+}
+
+// --- Response Cache ---
+
+// cacheFlags configure the on-disk response cache.
+type cacheFlags struct {
+	disabled *bool
+	dir      *string
+	ttl      *time.Duration
+	maxMB    *int64
+}
+
+// addCacheFlags registers the cache flags on fs.
+func addCacheFlags(fs *flag.FlagSet) *cacheFlags {
+	return &cacheFlags{
+		disabled: fs.Bool("no-cache", false, "Always call the API and do not store responses"),
+		dir:      fs.String("cache-dir", "", "Directory for cached responses (default: user cache dir/tokinfo)"),
+		ttl:      fs.Duration("cache-ttl", 7*24*time.Hour, "How long cached responses stay valid (0 = forever)"),
+		maxMB:    fs.Int64("cache-max-mb", 100, "Maximum cache size in MB; oldest entries are evicted (0 = unlimited)"),
+	}
+}
+
+// open returns the response cache described by the flags, ignoring -no-cache.
+// Failed evictions are logged to logger.
+func (f *cacheFlags) open(logger *slog.Logger) (*cache.Cache, error) {
+	dir, err := f.directory()
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(dir, *f.ttl, *f.maxMB*1024*1024, logger)
+}
+
+// directory returns -cache-dir or the default cache directory.
+func (f *cacheFlags) directory() (string, error) {
+	if *f.dir != "" {
+		return *f.dir, nil
+	}
+	return cache.DefaultDir()
+}
+
+// --- Gemini Session ---
+
+// clientFlags configure the guidelines, the Gemini client, logging and usage reporting.
+type clientFlags struct {
+	guidelinesPath  *string
+	log             *logFlags
+	analyzeBudget   *int
+	refineBudget    *int
+	maxOutputTokens *int
+	stats           *bool
+	pricesPath      *string
+	rpm             *int
+	tpm             *int
+	rateLimitsPath  *string
+	cache           *cacheFlags
+	replay          *bool
+	preserve        *string
+}
+
+// addGuidelinesFlag registers -guidelines on fs.
+func addGuidelinesFlag(fs *flag.FlagSet) *string {
+	return fs.String("guidelines", "guidelines.json", "Path to the prompt engineering guidelines JSON file")
+}
+
+// addClientFlags registers every flag needed to build a session on fs.
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		guidelinesPath: addGuidelinesFlag(fs),
+		log:            addLogFlags(fs),
+		// Token budgets keep the guideline text sent to each stage under control.
+		analyzeBudget:   fs.Int("analyze-budget", 0, "Max estimated input tokens for the analysis stage; guidelines are trimmed to fit (0 = unlimited)"),
+		refineBudget:    fs.Int("refine-budget", 0, "Max estimated input tokens for the refinement stage; guidelines are trimmed to fit (0 = unlimited)"),
+		maxOutputTokens: fs.Int("max-output-tokens", 0, "Hard cap on the enhanced prompt length in tokens (0 = model default)"),
+		// Usage accounting: token counts per stage and their estimated cost.
+		stats:      fs.Bool("stats", false, "Print token usage and estimated cost per stage to stderr"),
+		pricesPath: fs.String("prices", "", "Optional path to a JSON price table (USD per million tokens per model)"),
+		// Rate limiting: concurrent calls to a model share its quotas.
+		rpm:            fs.Int("rpm", 0, "Max Gemini API requests per minute per model, shared by concurrent calls (0 = unlimited)"),
+		tpm:            fs.Int("tpm", 0, "Max Gemini API tokens per minute per model, shared by concurrent calls (0 = unlimited)"),
+		rateLimitsPath: fs.String("rate-limits", "", "Optional path to a JSON file of limits per provider or provider/model"),
+		// Response cache: repeated runs with the same inputs skip the API.
+		cache:  addCacheFlags(fs),
+		replay: fs.Bool("replay", false, "Answer only from the response cache and fail on requests not recorded by an earlier run (for CI)"),
+		// Code, JSON, URLs, quotes and variables must survive refinement verbatim.
+		preserve: fs.String("preserve", preserve.ModeStrict, "What to do when the enhanced prompt loses code, JSON, URLs, quotes or template variables even after a retry: strict (fail), warn or off"),
+	}
+}
+
+// session bundles everything a command needs to talk to Gemini.
+type session struct {
+	guidelines     *config.Guidelines
+	guidelinesPath string
+	client         *gemini.Client
+	usage          *usage.Tracker
+	prices         usage.PriceTable
+	limits         *ratelimit.Set
+	stats          bool
+	logger         *slog.Logger
+}
+
+// newSession loads the guidelines and price table and initializes the Gemini
+// client, which reports its diagnostics to logger.
+func (f *clientFlags) newSession(ctx context.Context, logger *slog.Logger) (*session, error) {
+	if *f.analyzeBudget < 0 || *f.refineBudget < 0 || *f.maxOutputTokens < 0 {
+		return nil, usageErrorf("token budgets and -max-output-tokens cannot be negative")
+	}
+	if *f.rpm < 0 || *f.tpm < 0 {
+		return nil, usageErrorf("-rpm and -tpm cannot be negative")
+	}
+	switch *f.preserve {
+	case preserve.ModeStrict, preserve.ModeWarn, preserve.ModeOff:
+	default:
+		return nil, usageErrorf("unknown -preserve '%s' (expected strict, warn or off)", *f.preserve)
+	}
+
+	// --- Load Guidelines ---
+	guidelines, err := config.LoadGuidelines(*f.guidelinesPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load guidelines: %w", err)
+	}
+
+	// Load the price table used to convert token usage into cost
+	prices := usage.DefaultPriceTable()
+	if *f.pricesPath != "" {
+		prices, err = usage.LoadPriceTable(*f.pricesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	usageTracker := usage.NewTracker()
+
+	// Rate limits from the file, with -rpm and -tpm overriding the Gemini defaults
+	limits := make(map[string]ratelimit.Limits)
+	if *f.rateLimitsPath != "" {
+		limits, err = ratelimit.LoadLimits(*f.rateLimitsPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	providerLimits := limits[gemini.Provider]
+	if *f.rpm > 0 {
+		providerLimits.RequestsPerMinute = *f.rpm
+	}
+	if *f.tpm > 0 {
+		providerLimits.TokensPerMinute = *f.tpm
+	}
+	limits[gemini.Provider] = providerLimits
+	rateLimits := ratelimit.NewSet(limits)
+
+	// --- Initialize Gemini Client ---
+	apiKey := os.Getenv("GEMINI_API_KEY") // Get API key from environment variable
+	if apiKey == "" && !*f.replay {
+		// Replay never calls the API, so CI jobs without secrets can run it.
+		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
+	}
+	options := gemini.Options{
+		AnalyzeBudget:   *f.analyzeBudget,
+		RefineBudget:    *f.refineBudget,
+		MaxOutputTokens: int32(*f.maxOutputTokens),
+		Usage:           usageTracker,
+		GuidelinesHash:  guidelines.Hash(),
+		Limits:          rateLimits,
+		Preserve:        *f.preserve,
+	}
+	switch {
+	case *f.replay && *f.cache.disabled:
+		return nil, usageErrorf("-replay needs the cache; it cannot be combined with -no-cache")
+	case *f.replay:
+		// Recorded responses are replayed however old they are, and nothing is evicted.
+		dir, err := f.cache.directory()
+		if err != nil {
+			return nil, err
+		}
+		if options.Cache, err = cache.New(dir, 0, 0, logger); err != nil {
+			return nil, fmt.Errorf("failed to open response cache: %w", err)
+		}
+		options.Replay = true
+	case !*f.cache.disabled:
+		options.Cache, err = f.cache.open(logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open response cache: %w", err)
+		}
+		// Eviction failures only leave the cache larger than asked.
+		if err := options.Cache.Prune(); err != nil {
+			logger.Warn("could not prune response cache", "error", err)
+		}
+	}
+	client, err := gemini.NewClient(ctx, apiKey, options, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Gemini client: %w", err)
+	}
+	logger.Debug("Gemini client initialized", "model", gemini.Model, "cache", options.Cache != nil, "replay", options.Replay)
+
+	return &session{
+		guidelines:     guidelines,
+		guidelinesPath: *f.guidelinesPath,
+		client:         client,
+		usage:          usageTracker,
+		prices:         prices,
+		limits:         rateLimits,
+		stats:          *f.stats,
+		logger:         logger,
+	}, nil
+}
+
+// close releases the client and prints the usage and rate limiting reports
+// if -stats was given. They go to stderr so stdout keeps only the command's result.
+func (s *session) close() {
+	s.client.Close() // Ensure resources are released
+	if !s.stats {
+		return
+	}
+	if err := s.usage.Report(s.prices).WriteText(os.Stderr); err != nil {
+		s.logger.Warn("could not print usage report", "error", err)
+	}
+	if stats := s.limits.Stats(); len(stats) > 0 {
+		fmt.Fprintln(os.Stderr)
+		if err := ratelimit.WriteText(os.Stderr, stats); err != nil {
+			s.logger.Warn("could not print rate limit report", "error", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	config "tokinfo/internal/config"
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+)
+
+// analyzeCommand runs only Stage 1 and prints the analysis.
+func analyzeCommand() *command {
+	return &command{
+		name:    "analyze",
+		usage:   "[flags] [prompt | file]",
+		summary: "Run only the analysis stage and print the chosen technique, rationale and clarifying questions.\nNothing is refined; use -format json to feed the report to other tools.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			input := addPromptFlags(fs)
+			client := addClientFlags(fs)
+			format := fs.String("format", "text", "Output format: text or json")
+			return func(args []string) error {
+				return runAnalyze(input, client, *format, args)
+			}
+		},
+	}
+}
+
+// analysisReport is the structured output of the analyze command.
+type analysisReport struct {
+	Prompt              string                      `json:"prompt"`
+	Technique           string                      `json:"technique"`
+	TechniqueSummary    string                      `json:"techniqueSummary"`
+	TechniqueFound      bool                        `json:"techniqueFound"` // False if the model chose a name missing from the guidelines
+	Rationale           string                      `json:"rationale"`
+	ClarifyingQuestions []gemini.ClarifyingQuestion `json:"clarifyingQuestions"`
+	GuidelinesHash      string                      `json:"guidelinesHash"`
+}
+
+// runAnalyze executes the analyze command.
+func runAnalyze(input *promptFlags, client *clientFlags, format string, args []string) error {
+	if format != "text" && format != "json" {
+		return usageErrorf("unknown format '%s' (expected text or json)", format)
+	}
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	userPrompt, _, err := input.read(args, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	s, err := client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	// --- Stage 1: Analysis ---
+	analysisResult, err := enhance.New(s.client, s.guidelines).Analyze(ctx, userPrompt)
+	if err != nil {
+		return err
+	}
+
+	report := analysisReport{
+		Prompt:              userPrompt,
+		Technique:           analysisResult.ChosenTechniqueName,
+		Rationale:           analysisResult.Rationale,
+		ClarifyingQuestions: analysisResult.ClarifyingQuestions,
+		GuidelinesHash:      s.guidelines.Hash(),
+	}
+	if tech, found := config.GetTechniqueByName(s.guidelines.Techniques, report.Technique); found {
+		report.TechniqueSummary = tech.Summarized
+		report.TechniqueFound = true
+	}
+
+	if format == "json" {
+		return writeJSON(os.Stdout, report)
+	}
+	return writeAnalysisText(os.Stdout, report)
+}
+
+// writeAnalysisText prints the analysis report in a human-readable layout.
+func writeAnalysisText(w io.Writer, report analysisReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Technique: %s\n", report.Technique)
+	if report.TechniqueFound {
+		fmt.Fprintf(&b, "  %s\n", report.TechniqueSummary)
+	} else {
+		b.WriteString("  (not found in guidelines)\n")
+	}
+	if report.Rationale != "" {
+		fmt.Fprintf(&b, "\nRationale:\n  %s\n", report.Rationale)
+	}
+	if len(report.ClarifyingQuestions) == 0 {
+		b.WriteString("\nNo clarifying questions.\n")
+	} else {
+		b.WriteString("\nClarifying questions:\n")
+		for i, question := range report.ClarifyingQuestions {
+			fmt.Fprintf(&b, "  %d. %s\n", i+1, question.Question)
+			if question.ExampleAnswer != "" {
+				fmt.Fprintf(&b, "     e.g. %s\n", question.ExampleAnswer)
+			}
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write analysis report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	answers "tokinfo/internal/answers"
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+	history "tokinfo/internal/history"
+	prompt "tokinfo/internal/prompt"
+)
+
+// batchFlags are the flags of the batch command.
+type batchFlags struct {
+	client     *clientFlags
+	answers    *answerFlags
+	workers    *int
+	reportPath *string
+	force      *bool
+	history    *historyFlags
+}
+
+// batchCommand enhances many prompts concurrently.
+func batchCommand() *command {
+	return &command{
+		name:    "batch",
+		usage:   "[flags] <dir | glob | file.jsonl>...",
+		summary: "Enhance many prompts concurrently, without asking questions.\nEach prompt file foo.md is written to foo.enhanced.md, or every result goes to a JSONL report with -report.\nPrompts that are already enhanced are skipped, so an interrupted run can be resumed.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := &batchFlags{
+				client:     addClientFlags(fs),
+				answers:    addAnswerFlags(fs),
+				workers:    fs.Int("workers", 4, "Number of prompts enhanced at the same time"),
+				reportPath: fs.String("report", "", "Append results to this JSONL report instead of writing .enhanced files (required for JSONL input)"),
+				force:      fs.Bool("force", false, "Enhance every prompt again, even those already enhanced"),
+				history:    addHistoryFlags(fs),
+			}
+			return func(args []string) error {
+				return runBatch(f, args)
+			}
+		},
+	}
+}
+
+// batchItem is one prompt to enhance.
+type batchItem struct {
+	id     string // File path, or the id given in a JSONL input
+	path   string // Prompt file, read by the worker; empty for JSONL input
+	prompt string // Prompt text from a JSONL input
+}
+
+// batchResult is one line of the JSONL report.
+type batchResult struct {
+	ID             string             `json:"id"`
+	Prompt         string             `json:"prompt,omitempty"`
+	Technique      string             `json:"technique,omitempty"`
+	Questions      []answers.Question `json:"questions,omitempty"`
+	EnhancedPrompt string             `json:"enhancedPrompt,omitempty"`
+	OutputPath     string             `json:"outputPath,omitempty"`
+	Error          string             `json:"error,omitempty"`
+	DurationMs     int64              `json:"durationMs"`
+
+	userPrompt string // Prompt text, for the history
+	rationale  string
+}
+
+// runBatch executes the batch command.
+func runBatch(f *batchFlags, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("expected at least one directory, glob or JSONL file")
+	}
+	if *f.workers < 1 {
+		return usageErrorf("-workers must be at least 1")
+	}
+	logger, closeLog, err := f.client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	provided, err := f.answers.load()
+	if err != nil {
+		return err
+	}
+	recorder, err := f.history.recorder()
+	if err != nil {
+		return err
+	}
+	memory, err := f.answers.rememberer()
+	if err != nil {
+		return err
+	}
+
+	items, err := collectBatchItems(args)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no prompts found in %s", strings.Join(args, ", "))
+	}
+	reportMode := *f.reportPath != ""
+	for _, item := range items {
+		if item.path == "" && !reportMode {
+			return usageErrorf("-report is required for JSONL input")
+		}
+	}
+
+	// --- Resume ---
+	pending := items
+	if !*f.force {
+		pending, err = pendingBatchItems(items, *f.reportPath)
+		if err != nil {
+			return err
+		}
+	}
+	skipped := len(items) - len(pending)
+	if len(pending) == 0 {
+		fmt.Fprintf(os.Stderr, "All %d prompts are already enhanced; use -force to enhance them again.\n", len(items))
+		return nil
+	}
+
+	// An interrupt stops handing out prompts; finished results are kept, so
+	// running the same command again picks up where this run stopped.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s, err := f.client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	enhancer := enhance.New(s.client, s.guidelines)
+
+	var report *os.File
+	if reportMode {
+		report, err = os.OpenFile(*f.reportPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open report: %w", err)
+		}
+		defer report.Close()
+	}
+
+	// --- Worker Pool ---
+	// dispatch stops handing out prompts when the report cannot be written;
+	// prompts already being enhanced finish and are drained below.
+	dispatch, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+	jobs := make(chan batchItem)
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	for range min(*f.workers, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				answering := enhance.Answering{Provided: provided, Memory: memory, Unanswered: *f.answers.unanswered, Logger: logger.With("id", item.id)}
+				results <- enhanceBatchItem(ctx, enhancer, item, answering, logger)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, item := range pending {
+			select {
+			case jobs <- item:
+			case <-dispatch.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// --- Output ---
+	// Results are written as they arrive, from this goroutine only.
+	done, failed := 0, 0
+	var reportErr error
+	for result := range results {
+		done++
+		if result.Error == "" && !reportMode {
+			result.OutputPath = enhancedPath(result.ID)
+			if err := prompt.HandleOutput(result.EnhancedPrompt, result.OutputPath, logger); err != nil {
+				result.Error = err.Error()
+			}
+		}
+		if reportMode && reportErr == nil {
+			if err := json.NewEncoder(report).Encode(result); err != nil {
+				// Keep draining so the workers can exit; results that miss
+				// the report are still recorded in the history.
+				reportErr = fmt.Errorf("failed to write report: %w", err)
+				stopDispatch()
+			}
+		}
+		if recorder != nil && result.Error == "" {
+			// Usage is left out: the calls of all prompts share one tracker.
+			entry := &history.Entry{
+				Command:        "batch",
+				Prompt:         result.userPrompt,
+				PromptSource:   result.ID,
+				GuidelinesPath: s.guidelinesPath,
+				GuidelinesHash: s.guidelines.Hash(),
+				Technique:      result.Technique,
+				Rationale:      result.rationale,
+				Questions:      result.Questions,
+				EnhancedPrompt: result.EnhancedPrompt,
+				OutputPath:     result.OutputPath,
+				Model:          gemini.Model,
+			}
+			if err := recorder.Add(entry); err != nil {
+				logger.Warn("could not record prompt in history", "id", result.ID, "error", err)
+			}
+		}
+
+		switch {
+		case reportErr != nil:
+			// Counted as failed so that resuming enhances the prompt again.
+			failed++
+			fmt.Fprintf(os.Stderr, "[%d/%d] NOT IN REPORT %s\n", done, len(pending), result.ID)
+		case result.Error != "":
+			failed++
+			fmt.Fprintf(os.Stderr, "[%d/%d] FAILED %s: %s\n", done, len(pending), result.ID, result.Error)
+		case result.OutputPath != "":
+			fmt.Fprintf(os.Stderr, "[%d/%d] ok %s -> %s\n", done, len(pending), result.ID, result.OutputPath)
+		default:
+			fmt.Fprintf(os.Stderr, "[%d/%d] ok %s\n", done, len(pending), result.ID)
+		}
+	}
+
+	if memory != nil {
+		if err := memory.Save(); err != nil {
+			logger.Warn("could not save answer memory", "error", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Enhanced %d, skipped %d, failed %d of %d prompts.\n", done-failed, skipped, failed, len(items))
+	if reportErr != nil {
+		return fmt.Errorf("%w; run the same command again to resume", reportErr)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted with %d prompts left; run the same command again to resume", len(pending)-done+failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d prompts failed", failed, len(pending))
+	}
+	return nil
+}
+
+// enhanceBatchItem runs the enhancement pipeline on one prompt. Questions are
+// answered as configured by answering, never asked.
+func enhanceBatchItem(ctx context.Context, enhancer *enhance.Enhancer, item batchItem, answering enhance.Answering, logger *slog.Logger) batchResult {
+	started := time.Now()
+	result := batchResult{ID: item.id, Prompt: item.prompt}
+	fail := func(err error) batchResult {
+		result.Error = err.Error()
+		result.DurationMs = time.Since(started).Milliseconds()
+		return result
+	}
+
+	userPrompt := item.prompt
+	if item.path != "" {
+		var err error
+		if userPrompt, err = prompt.ReadFile(item.path, logger); err != nil {
+			return fail(err)
+		}
+	}
+
+	enhanced, err := enhancer.Enhance(ctx, userPrompt, answering)
+	if err != nil {
+		return fail(err)
+	}
+	result.userPrompt = userPrompt
+	result.Technique, result.rationale = enhanced.Technique, enhanced.Rationale
+	result.Questions = enhanced.Questions
+	result.EnhancedPrompt = enhanced.EnhancedPrompt
+	result.DurationMs = time.Since(started).Milliseconds()
+	return result
+}
+
+// collectBatchItems expands the command's arguments into prompts. A directory
+// contributes every prompt file below it, a .jsonl file one prompt per line,
+// any other file itself, and anything else is treated as a glob pattern.
+// Enhanced outputs of earlier runs are left out.
+func collectBatchItems(args []string) ([]batchItem, error) {
+	var items []batchItem
+	seen := make(map[string]bool)
+	add := func(item batchItem) {
+		if !seen[item.id] {
+			seen[item.id] = true
+			items = append(items, item)
+		}
+	}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		switch {
+		case err == nil && info.IsDir():
+			err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && path != arg && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir // Skip .git and other hidden directories
+				}
+				if d.Type().IsRegular() && prompt.HasPromptExtension(path) && !isEnhancedPath(path) {
+					add(batchItem{id: path, path: path})
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list prompts in '%s': %w", arg, err)
+			}
+		case err == nil && strings.EqualFold(filepath.Ext(arg), ".jsonl"):
+			fromFile, err := readBatchJSONL(arg)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range fromFile {
+				add(item)
+			}
+		case err == nil:
+			add(batchItem{id: arg, path: arg})
+		default:
+			matches, globErr := filepath.Glob(arg)
+			if globErr != nil {
+				return nil, usageErrorf("invalid pattern '%s': %v", arg, globErr)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no prompt files match '%s'", arg)
+			}
+			for _, path := range matches {
+				if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && !isEnhancedPath(path) {
+					add(batchItem{id: path, path: path})
+				}
+			}
+		}
+	}
+	return items, nil
+}
+
+// readBatchJSONL reads prompts from a JSONL file whose lines look like
+// {"id": "greeting", "prompt": "..."}. Lines without an id are named
+// after their position, as file.jsonl:3.
+func readBatchJSONL(path string) ([]batchItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open prompts file: %w", err)
+	}
+	defer file.Close()
+
+	var items []batchItem
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // Prompts can be long
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry struct {
+			ID     string `json:"id"`
+			Prompt string `json:"prompt"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid JSON: %w", path, line, err)
+		}
+		if strings.TrimSpace(entry.Prompt) == "" {
+			return nil, fmt.Errorf("%s:%d: missing prompt", path, line)
+		}
+		if entry.ID == "" {
+			entry.ID = fmt.Sprintf("%s:%d", path, line)
+		}
+		items = append(items, batchItem{id: entry.ID, prompt: entry.Prompt})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read prompts file: %w", err)
+	}
+	return items, nil
+}
+
+// pendingBatchItems returns the items not enhanced by an earlier run. With a
+// report, those are the items without a successful line in it; otherwise the
+// items whose .enhanced file is missing or older than the prompt.
+func pendingBatchItems(items []batchItem, reportPath string) ([]batchItem, error) {
+	var pending []batchItem
+	if reportPath == "" {
+		for _, item := range items {
+			source, err := os.Stat(item.path)
+			if err != nil {
+				pending = append(pending, item) // Reported as a failure by the worker
+				continue
+			}
+			output, err := os.Stat(enhancedPath(item.path))
+			if err != nil || output.ModTime().Before(source.ModTime()) {
+				pending = append(pending, item)
+			}
+		}
+		return pending, nil
+	}
+
+	done := make(map[string]bool)
+	file, err := os.Open(reportPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var result batchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue // A line cut short by an interrupted run
+		}
+		done[result.ID] = result.Error == "" // The last line for an id wins
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	for _, item := range items {
+		if !done[item.id] {
+			pending = append(pending, item)
+		}
+	}
+	return pending, nil
+}
+
+// enhancedPath returns where the enhanced version of a prompt file is
+// written: foo.md becomes foo.enhanced.md.
+func enhancedPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".enhanced" + ext
+}
+
+// isEnhancedPath reports whether path is the output of an earlier run. Its
+// base name is checked rather than its extension: enhancedPath turns a file
+// without one, such as notes/prompt, into notes/prompt.enhanced.
+func isEnhancedPath(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasSuffix(base, ".enhanced") || strings.Contains(base, ".enhanced.")
+}
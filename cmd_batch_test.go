@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestEnhancedPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"prompt.md", "prompt.enhanced.md"},
+		{"notes/prompt.txt", "notes/prompt.enhanced.txt"},
+		{"notes/prompt", "notes/prompt.enhanced"},
+		{".prompt", ".enhanced.prompt"},
+		{"notes.d/prompt", "notes.d/prompt.enhanced"},
+	}
+	for _, tt := range tests {
+		got := enhancedPath(tt.path)
+		if got != tt.want {
+			t.Errorf("enhancedPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+		if isEnhancedPath(tt.path) {
+			t.Errorf("isEnhancedPath(%q) = true for a source file", tt.path)
+		}
+		if !isEnhancedPath(got) {
+			t.Errorf("isEnhancedPath(%q) = false for the output of %q", got, tt.path)
+		}
+	}
+}
+
+func TestIsEnhancedPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"prompt.enhanced.md", true},
+		{"notes/prompt.enhanced", true},
+		{".enhanced.prompt", true},
+		{"prompt.md", false},
+		{"notes/prompt", false},
+		{".prompt", false},
+		{"enhanced.md", false},
+		{"prompt.enhancedx.md", false},
+		{"out.enhanced/prompt.md", false},
+	}
+	for _, tt := range tests {
+		if got := isEnhancedPath(tt.path); got != tt.want {
+			t.Errorf("isEnhancedPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// cacheCommand manages the on-disk response cache.
+func cacheCommand() *command {
+	return &command{
+		name:    "cache",
+		usage:   "[flags] clear | stats",
+		summary: "Remove every cached response, or show how many responses are cached and their size.",
+		words:   []string{"clear", "stats"},
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			flags := addCacheFlags(fs)
+			return func(args []string) error {
+				return runCache(flags, args)
+			}
+		},
+	}
+}
+
+// runCache handles `tokinfo cache clear` and `tokinfo cache stats`.
+func runCache(flags *cacheFlags, args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("expected clear or stats")
+	}
+	responseCache, err := flags.open(nil) // Clear and stats do not evict
+	if err != nil {
+		return fmt.Errorf("failed to open response cache: %w", err)
+	}
+
+	switch args[0] {
+	case "clear":
+		removed, err := responseCache.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached responses.\n", removed)
+	case "stats":
+		stats, err := responseCache.Stats()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Directory: %s\n", stats.Dir)
+		fmt.Printf("Entries:   %d (%d expired)\n", stats.Entries, stats.Expired)
+		fmt.Printf("Size:      %.1f KB\n", float64(stats.Bytes)/1024)
+	default:
+		return usageErrorf("unknown cache command '%s' (expected clear or stats)", args[0])
+	}
+	return nil
+}
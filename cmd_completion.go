@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// completionCommand prints a shell completion script.
+func completionCommand() *command {
+	return &command{
+		name:    "completion",
+		usage:   "bash | zsh | fish",
+		summary: "Print a shell completion script.\nFor example: tokinfo completion bash > /etc/bash_completion.d/tokinfo",
+		words:   []string{"bash", "zsh", "fish"},
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			return func(args []string) error {
+				if len(args) != 1 {
+					return usageErrorf("expected bash, zsh or fish")
+				}
+				switch args[0] {
+				case "bash":
+					return writeBashCompletion(os.Stdout)
+				case "zsh":
+					return writeZshCompletion(os.Stdout)
+				case "fish":
+					return writeFishCompletion(os.Stdout)
+				default:
+					return usageErrorf("unsupported shell '%s' (expected bash, zsh or fish)", args[0])
+				}
+			}
+		},
+	}
+}
+
+// completionFlag describes one flag for completion scripts.
+type completionFlag struct {
+	name    string
+	usage   string
+	isBool  bool
+	hasFile bool // Value is a path
+}
+
+// commandFlags returns the flags cmd registers, in alphabetical order.
+func commandFlags(cmd *command) []completionFlag {
+	fs := newFlagSet(cmd)
+	cmd.define(fs)
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:    f.Name,
+			usage:   firstLine(f.Usage),
+			isBool:  ok && boolFlag.IsBoolFlag(),
+			hasFile: strings.Contains(strings.ToLower(f.Usage), "path") || strings.Contains(strings.ToLower(f.Usage), "file"),
+		})
+	})
+	return flags
+}
+
+// commandNames returns the names of every command.
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands() {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// writeBashCompletion writes a bash completion script to w.
+func writeBashCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# bash completion for tokinfo\n_tokinfo() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    local flags=\"\" words=\"\"\n")
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	for _, cmd := range commands() {
+		var names []string
+		for _, f := range commandFlags(cmd) {
+			names = append(names, "-"+f.name)
+		}
+		fmt.Fprintf(&b, "        %s) flags=%q; words=%q ;;\n", cmd.name, strings.Join(names, " "), strings.Join(cmd.completionWords(), " "))
+	}
+	// Without a command name, the arguments belong to enhance.
+	var enhanceFlags []string
+	for _, f := range commandFlags(enhanceCommand()) {
+		enhanceFlags = append(enhanceFlags, "-"+f.name)
+	}
+	fmt.Fprintf(&b, "        *) flags=%q ;;\n", strings.Join(enhanceFlags, " "))
+	b.WriteString("    esac\n")
+	b.WriteString("    if [[ $cur == -* ]]; then\n        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	b.WriteString("    elif [[ -n $words && $COMP_CWORD -eq 2 ]]; then\n        COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("    else\n        COMPREPLY=($(compgen -f -- \"$cur\"))\n    fi\n}\n")
+	b.WriteString("complete -o filenames -F _tokinfo tokinfo\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeZshCompletion writes a zsh completion script to w.
+func writeZshCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("#compdef tokinfo\n\n_tokinfo() {\n    local -a commands\n    commands=(\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(&b, "        %s\n", zshQuote(cmd.name+":"+firstLine(cmd.summary)))
+	}
+	b.WriteString("    )\n    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n")
+	b.WriteString("        _describe 'command' commands\n        return\n    fi\n")
+	b.WriteString("    case $words[2] in\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(&b, "        %s)\n            _arguments \\\n", cmd.name)
+		for _, f := range commandFlags(cmd) {
+			fmt.Fprintf(&b, "                %s \\\n", zshQuote(zshFlagSpec(f)))
+		}
+		if words := cmd.completionWords(); len(words) > 0 {
+			fmt.Fprintf(&b, "                %s \\\n", zshQuote("1:argument:("+strings.Join(words, " ")+")"))
+		}
+		b.WriteString("                '*:file:_files'\n            ;;\n")
+	}
+	b.WriteString("        *)\n            _files\n            ;;\n    esac\n}\n\n_tokinfo \"$@\"\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshFlagSpec returns the _arguments specification for f.
+func zshFlagSpec(f completionFlag) string {
+	usage := strings.NewReplacer("[", "(", "]", ")", ":", " ").Replace(f.usage)
+	spec := "-" + f.name + "[" + usage + "]"
+	switch {
+	case f.isBool:
+	case f.hasFile:
+		spec += ":" + f.name + ":_files"
+	default:
+		spec += ":" + f.name + ":"
+	}
+	return spec
+}
+
+// zshQuote single-quotes s for zsh and bash.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeFishCompletion writes a fish completion script to w.
+func writeFishCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for tokinfo\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(&b, "complete -c tokinfo -f -n __fish_use_subcommand -a %s -d %s\n", cmd.name, zshQuote(firstLine(cmd.summary)))
+	}
+	for _, cmd := range commands() {
+		condition := zshQuote("__fish_seen_subcommand_from " + cmd.name)
+		for _, f := range commandFlags(cmd) {
+			line := fmt.Sprintf("complete -c tokinfo -n %s -o %s -d %s", condition, f.name, zshQuote(f.usage))
+			if !f.isBool {
+				line += " -r"
+			}
+			b.WriteString(line + "\n")
+		}
+		if words := cmd.completionWords(); len(words) > 0 {
+			fmt.Fprintf(&b, "complete -c tokinfo -f -n %s -a %s\n", condition, zshQuote(strings.Join(words, " ")))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
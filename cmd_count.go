@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	budget "tokinfo/internal/budget"
+	config "tokinfo/internal/config"
+	gemini "tokinfo/internal/gemini"
+)
+
+// countCommand reports how many tokens a prompt and each stage request use.
+func countCommand() *command {
+	return &command{
+		name:    "count",
+		usage:   "[flags] [prompt | file]",
+		summary: "Count the tokens of a prompt and of the requests each stage would send.\nCounts are estimated offline unless -exact is given.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			input := addPromptFlags(fs)
+			client := addClientFlags(fs)
+			exact := fs.Bool("exact", false, "Ask the Gemini API for exact counts instead of estimating")
+			return func(args []string) error {
+				return runCount(input, client, *exact, args)
+			}
+		},
+	}
+}
+
+// runCount executes the count command.
+func runCount(input *promptFlags, client *clientFlags, exact bool, args []string) error {
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	userPrompt, _, err := input.read(args, logger)
+	if err != nil {
+		return err
+	}
+	guidelines, err := config.LoadGuidelines(*client.guidelinesPath, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load guidelines: %w", err)
+	}
+
+	// The refinement request depends on the chosen technique; report the largest.
+	var largest config.Technique
+	for _, tech := range guidelines.Techniques {
+		if len(tech.Complete) > len(largest.Complete) {
+			largest = tech
+		}
+	}
+	texts := []struct {
+		label string
+		text  string
+	}{
+		{"Prompt", userPrompt},
+		{"Analysis request", gemini.BuildAnalyzePrompt(guidelines.Introduction, guidelines.SummarizedTechniques(), userPrompt)},
+		{fmt.Sprintf("Refine request (%s)", largest.Name), gemini.BuildRefinePrompt(guidelines.Introduction, largest.Complete, userPrompt, nil, *client.preserve)},
+	}
+
+	// Offline estimates need neither an API key nor a network connection.
+	count := func(text string) (int, error) { return budget.EstimateTokens(text), nil }
+	prefix := "~"
+	if exact {
+		ctx := context.Background()
+		s, err := client.newSession(ctx, logger)
+		if err != nil {
+			return err
+		}
+		defer s.close()
+		count = func(text string) (int, error) { return s.client.CountTokens(ctx, text) }
+		prefix = ""
+	}
+
+	for _, t := range texts {
+		n, err := count(t.text)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-*s %s%d tokens\n", 40, t.label+":", prefix, n)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	answers "tokinfo/internal/answers"
+	diff "tokinfo/internal/diff"
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+	history "tokinfo/internal/history"
+	library "tokinfo/internal/library"
+	prompt "tokinfo/internal/prompt"
+	ratelimit "tokinfo/internal/ratelimit"
+	usage "tokinfo/internal/usage"
+	variables "tokinfo/internal/variables"
+)
+
+// enhanceFlags are the flags of the enhance command.
+type enhanceFlags struct {
+	input      *promptFlags
+	client     *clientFlags
+	answers    *answerFlags
+	outputPath *string
+	showDiff   *bool
+	colorMode  *string
+	format     *string
+	history    *historyFlags
+	saveName   *string
+	libraryDir *string
+}
+
+// enhanceCommand runs the full pipeline: analysis, clarifying questions and refinement.
+func enhanceCommand() *command {
+	return &command{
+		name:    "enhance",
+		usage:   "[flags] [prompt | file]",
+		summary: "Analyze a prompt, ask clarifying questions and print the enhanced prompt.\nThis is the default command when no command name is given.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := addEnhanceFlags(fs)
+			return func(args []string) error {
+				return runEnhance(f, args, "enhance")
+			}
+		},
+	}
+}
+
+// addEnhanceFlags registers the flags of the enhance command on fs.
+func addEnhanceFlags(fs *flag.FlagSet) *enhanceFlags {
+	return &enhanceFlags{
+		input:      addPromptFlags(fs),
+		client:     addClientFlags(fs),
+		answers:    addAnswerFlags(fs),
+		outputPath: fs.String("g", "", "Optional path to save the generated prompt"),
+		showDiff:   fs.Bool("diff", false, "Also print a word diff (and a unified diff for files) of the original and enhanced prompt to stderr"),
+		colorMode:  addColorFlag(fs),
+		format:     fs.String("format", "text", "Output format: text (the enhanced prompt) or json (a full report of the run)"),
+		history:    addHistoryFlags(fs),
+		saveName:   fs.String("save", "", "Save the prompt and the enhanced prompt as versions of this prompt in the library"),
+		libraryDir: addLibraryFlag(fs),
+	}
+}
+
+// enhanceReport is the JSON document written by enhance -format json.
+type enhanceReport struct {
+	Prompt         string               `json:"prompt"`
+	PromptSource   string               `json:"promptSource"` // File path, "stdin" or "argument"
+	Guidelines     guidelinesInfo       `json:"guidelines"`
+	Technique      string               `json:"technique"`
+	Rationale      string               `json:"rationale"`
+	Techniques     []string             `json:"techniques"` // Techniques applied during refinement, in order
+	Questions      []answers.Question   `json:"questions"`
+	Variables      []variables.Variable `json:"variables,omitempty"` // Template variables kept from the prompt
+	EnhancedPrompt string               `json:"enhancedPrompt"`
+	OutputPath     string               `json:"outputPath,omitempty"`
+	Models         map[string]string    `json:"models"`
+	Usage          usage.Report         `json:"usage"`
+	RateLimits     []ratelimit.Stats    `json:"rateLimits,omitempty"`
+	TimingsMs      map[string]int64     `json:"timingsMs"`
+	HistoryID      string               `json:"historyId,omitempty"`
+}
+
+// guidelinesInfo identifies the guidelines a run used.
+type guidelinesInfo struct {
+	Source string `json:"source"`
+	Hash   string `json:"hash"`
+}
+
+// runEnhance executes the enhance command; command names the command that
+// started the run in the history.
+func runEnhance(f *enhanceFlags, args []string, command string) error {
+	if *f.format != "text" && *f.format != "json" {
+		return usageErrorf("unknown format '%s' (expected text or json)", *f.format)
+	}
+	jsonOutput := *f.format == "json"
+	useColor, err := colorEnabled(*f.colorMode, os.Stderr)
+	if err != nil {
+		return err
+	}
+	logger, closeLog, err := f.client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	started := time.Now()
+
+	// --- Read User Prompt ---
+	userPrompt, stdinUsed, err := f.input.read(args, logger)
+	if err != nil {
+		return err
+	}
+	provided, err := f.answers.load()
+	if err != nil {
+		return err
+	}
+	recorder, err := f.history.recorder()
+	if err != nil {
+		return err
+	}
+	memory, err := f.answers.rememberer()
+	if err != nil {
+		return err
+	}
+	if *f.saveName != "" {
+		if _, version, err := library.ParseRef(*f.saveName); err != nil || version != 0 {
+			return usageErrorf("-save needs a prompt name without a version, such as support-reply")
+		}
+	}
+
+	// Create a context
+	ctx := context.Background()
+	s, err := f.client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	enhancer := enhance.New(s.client, s.guidelines)
+
+	// --- Stage 1: Analysis & Clarification ---
+	// This sends the introduction, summarized techniques, and user prompt to the Gemini model
+	// for analysis and to get clarifying questions.
+	stageStarted := time.Now()
+	analysisResult, err := enhancer.Analyze(ctx, userPrompt)
+	if err != nil {
+		return err
+	}
+	analyzeDuration := time.Since(stageStarted)
+	logger.Info("stage 1 analysis complete", "technique", analysisResult.ChosenTechniqueName, "questions", len(analysisResult.ClarifyingQuestions), "duration", analyzeDuration)
+
+	// --- User Interaction ---
+	// Questions are asked on stderr so stdout carries only the result.
+	stageStarted = time.Now()
+	answering := enhance.Answering{Provided: provided, Memory: memory, Unanswered: *f.answers.unanswered, Logger: logger}
+	answered := collectAnswers(analysisResult.ClarifyingQuestions, answering, f.answers.interactive(stdinUsed), os.Stderr)
+	if memory != nil {
+		// A memory that cannot be saved does not stop the run.
+		if err := memory.Save(); err != nil {
+			logger.Warn("could not save answer memory", "error", err)
+		}
+	}
+	answersDuration := time.Since(stageStarted)
+
+	// --- Stage 2: Refinement ---
+	technique := analysisResult.ChosenTechniqueName
+	stageStarted = time.Now()
+	enhancedPrompt, err := enhancer.Refine(ctx, userPrompt, technique, answers.Map(answered))
+	if err != nil {
+		return err
+	}
+	refineDuration := time.Since(stageStarted)
+	logger.Info("stage 2 refinement complete", "technique", technique, "duration", refineDuration)
+
+	// --- History ---
+	// A run that cannot be recorded still prints its result.
+	var historyID string
+	if recorder != nil {
+		report := s.usage.Report(s.prices)
+		entry := &history.Entry{
+			Command:        command,
+			Prompt:         userPrompt,
+			PromptSource:   promptSource(f.input.path, stdinUsed),
+			GuidelinesPath: s.guidelinesPath,
+			GuidelinesHash: s.guidelines.Hash(),
+			Technique:      analysisResult.ChosenTechniqueName,
+			Rationale:      analysisResult.Rationale,
+			Questions:      answered,
+			EnhancedPrompt: enhancedPrompt,
+			OutputPath:     *f.outputPath,
+			Model:          gemini.Model,
+			Usage:          &report,
+		}
+		if err := recorder.Add(entry); err != nil {
+			logger.Warn("could not record run in history", "error", err)
+		} else {
+			historyID = entry.ID
+			logger.Debug("run recorded in history", "id", entry.ID, "path", recorder.Path())
+		}
+	}
+
+	// --- Output ---
+	if jsonOutput {
+		// The prompt is still saved with -g; stdout gets the report instead.
+		if *f.outputPath != "" {
+			if err := prompt.HandleOutput(enhancedPrompt, *f.outputPath, logger); err != nil {
+				return err
+			}
+		}
+		report := enhanceReport{
+			Prompt:         userPrompt,
+			PromptSource:   promptSource(f.input.path, stdinUsed),
+			Guidelines:     guidelinesInfo{Source: s.guidelinesPath, Hash: s.guidelines.Hash()},
+			Technique:      analysisResult.ChosenTechniqueName,
+			Rationale:      analysisResult.Rationale,
+			Techniques:     []string{technique},
+			Questions:      answered,
+			Variables:      variables.Find(userPrompt),
+			EnhancedPrompt: enhancedPrompt,
+			OutputPath:     *f.outputPath,
+			Models:         map[string]string{gemini.StageAnalyze: gemini.Model, gemini.StageRefine: gemini.Model},
+			Usage:          s.usage.Report(s.prices),
+			RateLimits:     s.limits.Stats(),
+			TimingsMs: map[string]int64{
+				"analyze": analyzeDuration.Milliseconds(),
+				"answers": answersDuration.Milliseconds(),
+				"refine":  refineDuration.Milliseconds(),
+				"total":   time.Since(started).Milliseconds(),
+			},
+			HistoryID: historyID,
+		}
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		// The final result is always written, whatever the log level.
+		if err := prompt.HandleOutput(enhancedPrompt, *f.outputPath, logger); err != nil {
+			return err
+		}
+	}
+
+	// --- Library ---
+	if *f.saveName != "" {
+		if err := saveEnhanced(library.Open(*f.libraryDir), *f.saveName, userPrompt, enhancedPrompt, technique, s.guidelines.Hash(), logger); err != nil {
+			return err
+		}
+	}
+
+	// The diff goes to stderr so stdout keeps only the result.
+	if *f.showDiff {
+		return writePromptDiff(os.Stderr, userPrompt, enhancedPrompt, f.input.path, *f.outputPath, useColor)
+	}
+	return nil
+}
+
+// saveEnhanced saves userPrompt, unless it is already a version of name,
+// and enhancedPrompt as versions of name, linking the enhanced version to
+// the version it was refined from and to its technique. Enhancing a saved
+// version again thus refers back to it instead of copying it.
+func saveEnhanced(lib *library.Library, name string, userPrompt string, enhancedPrompt string, technique string, guidelinesHash string, logger *slog.Logger) error {
+	source, found, err := lib.Find(name, userPrompt)
+	if err != nil {
+		return fmt.Errorf("failed to save prompt in library: %w", err)
+	}
+	if !found {
+		if source, _, err = lib.Save(name, userPrompt, library.Version{Note: "source prompt"}, library.Update{}); err != nil {
+			return fmt.Errorf("failed to save prompt in library: %w", err)
+		}
+	}
+	enhanced, _, err := lib.Save(name, enhancedPrompt, library.Version{Technique: technique, EnhancedFrom: source.Version, GuidelinesHash: guidelinesHash}, library.Update{})
+	if err != nil {
+		return fmt.Errorf("failed to save enhanced prompt in library: %w", err)
+	}
+	logger.Info("saved in library", "name", name, "source", source.Version, "enhanced", enhanced.Version, "library", lib.Dir())
+	return nil
+}
+
+// promptSource describes where the prompt came from for reports.
+func promptSource(path string, stdinUsed bool) string {
+	switch {
+	case path != "":
+		return path
+	case stdinUsed:
+		return "stdin"
+	default:
+		return "argument"
+	}
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
+	}
+	return nil
+}
+
+// writePromptDiff writes a word diff of the original and enhanced prompt to w,
+// so the user can check the refinement did not add, remove or reinterpret
+// concepts. When the prompt came from a file, a unified diff follows.
+func writePromptDiff(w io.Writer, original string, enhanced string, sourcePath string, outputPath string, useColor bool) error {
+	edits := diff.Words(original, enhanced)
+	inserted, deleted := diff.Stats(edits)
+	if _, err := fmt.Fprintf(w, "\n--- Word diff: +%d / -%d words ---\n", inserted, deleted); err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	if err := diff.WriteWords(w, edits, useColor); err != nil {
+		return err
+	}
+
+	if sourcePath == "" {
+		return nil
+	}
+	toName := outputPath
+	if toName == "" {
+		toName = sourcePath + " (enhanced)"
+	}
+	unified := diff.Unified(sourcePath, toName, original, enhanced, 3, useColor)
+	if _, err := fmt.Fprintf(w, "\n%s", unified); err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	return nil
+}
+
+// collectAnswers answers each clarifying question as configured by a. When
+// interactive, the questions nothing else answers are asked on the terminal,
+// with the question written to out.
+func collectAnswers(questions []gemini.ClarifyingQuestion, a enhance.Answering, interactive bool, out io.Writer) []answers.Question {
+	if len(questions) == 0 {
+		a.Logger.Info("no clarifying questions needed based on the analysis")
+		return []answers.Question{}
+	}
+	if !interactive {
+		return enhance.Answer(questions, a)
+	}
+
+	fmt.Fprintln(out, "\nPlease answer the following questions to help refine the prompt:")
+	reader := bufio.NewReader(os.Stdin) // Create a reader for input
+	a.Ask = func(_ int, question gemini.ClarifyingQuestion, remembered string) (string, error) {
+		// Show the example so the user knows what kind of answer is expected
+		switch {
+		case remembered != "":
+			fmt.Fprintf(out, "- %s [%s]: ", question.Question, remembered)
+		case question.ExampleAnswer != "":
+			fmt.Fprintf(out, "- %s (e.g. %s): ", question.Question, question.ExampleAnswer)
+		default:
+			fmt.Fprintf(out, "- %s: ", question.Question) // Print the question text
+		}
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		// Trim newline characters (\r\n on Windows, \n on Unix)
+		return strings.TrimSpace(answer), nil
+	}
+	answered := enhance.Answer(questions, a)
+	fmt.Fprintln(out, "Thank you for your answers.")
+	return answered
+}
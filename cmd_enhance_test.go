@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	library "tokinfo/internal/library"
+)
+
+func TestSaveEnhanced(t *testing.T) {
+	lib := library.Open(filepath.Join(t.TempDir(), "library"))
+	logger := slog.New(slog.DiscardHandler)
+	// Each run enhances the source; the third run's output differs.
+	runs := []struct {
+		enhanced string
+		want     []library.Version // Version, EnhancedFrom and Technique only
+	}{
+		{"enhanced", []library.Version{{Version: 1}, {Version: 2, EnhancedFrom: 1, Technique: "cot"}}},
+		{"enhanced", []library.Version{{Version: 1}, {Version: 2, EnhancedFrom: 1, Technique: "cot"}}},
+		{"enhanced again", []library.Version{{Version: 1}, {Version: 2, EnhancedFrom: 1, Technique: "cot"}, {Version: 3, EnhancedFrom: 1, Technique: "cot"}}},
+	}
+	for i, run := range runs {
+		if err := saveEnhanced(lib, "reply", "source", run.enhanced, "cot", "hash", logger); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		p, err := lib.Load("reply")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Versions) != len(run.want) {
+			t.Fatalf("run %d: %d versions, want %d: %+v", i, len(p.Versions), len(run.want), p.Versions)
+		}
+		for j, want := range run.want {
+			got := p.Versions[j]
+			if got.Version != want.Version || got.EnhancedFrom != want.EnhancedFrom || got.Technique != want.Technique {
+				t.Errorf("run %d: version %d = %+v, want %+v", i, j, got, want)
+			}
+		}
+	}
+
+	// Enhancing an enhanced version refers back to it rather than copying it.
+	if err := saveEnhanced(lib, "reply", "enhanced", "enhanced twice", "cot", "hash", logger); err != nil {
+		t.Fatal(err)
+	}
+	p, err := lib.Load("reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := p.Latest(); len(p.Versions) != 4 || latest.EnhancedFrom != 2 {
+		t.Errorf("latest = %+v of %d versions, want version 4 enhanced from 2", latest, len(p.Versions))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	enhance "tokinfo/internal/enhance"
+	eval "tokinfo/internal/eval"
+	judge "tokinfo/internal/judge"
+)
+
+// evalCommand runs a prompt evaluation suite.
+func evalCommand() *command {
+	return &command{
+		name:    "eval",
+		usage:   "[flags] suite.yaml",
+		summary: "Run a suite of prompt templates against a target model, before and after enhancement,\nand report how many assertions (contains, regex, JSON schema, LLM judge) each passes.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			client := addClientFlags(fs)
+			model := fs.String("model", "", "Target model the prompts are run against (default: the suite's model, or tokinfo's)")
+			format := fs.String("format", "text", "Output format: text or json")
+			failOnRegression := fs.Bool("fail-on-regression", false, "Exit with status 1 if the enhanced prompts pass fewer assertions than the originals")
+			return func(args []string) error {
+				if len(args) != 1 {
+					return usageErrorf("eval takes exactly one suite file")
+				}
+				return runEval(client, args[0], *model, *format, *failOnRegression)
+			}
+		},
+	}
+}
+
+// runEval executes the eval command.
+func runEval(client *clientFlags, suitePath string, model string, format string, failOnRegression bool) error {
+	if format != "text" && format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", format)
+	}
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	suite, err := eval.LoadSuite(suitePath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s, err := client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	runner := eval.NewRunner(enhance.New(s.client, s.guidelines), s.client, judge.New(s.client, s.guidelines), logger)
+	report, err := runner.Run(ctx, suite, model)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		err = writeJSON(os.Stdout, report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.Errors > 0 {
+		return fmt.Errorf("%d of %d cases could not be enhanced", report.Errors, len(report.Cases))
+	}
+	if failOnRegression && report.Enhanced.Passed < report.Original.Passed {
+		return fmt.Errorf("enhanced prompts passed %d of %d assertions, the originals %d", report.Enhanced.Passed, report.Enhanced.Assertions, report.Original.Passed)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	config "tokinfo/internal/config"
+)
+
+// guidelinesCommand inspects the guidelines file.
+func guidelinesCommand() *command {
+	return &command{
+		name:    "guidelines",
+		usage:   "[flags] list | show <technique> | hash",
+		summary: "List the techniques in the guidelines, show one technique in full, or print the guidelines hash.",
+		words:   []string{"list", "show", "hash"},
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			guidelinesPath := addGuidelinesFlag(fs)
+			logOpts := addLogFlags(fs)
+			return func(args []string) error {
+				return runGuidelines(*guidelinesPath, logOpts, args)
+			}
+		},
+	}
+}
+
+// runGuidelines executes the guidelines command.
+func runGuidelines(guidelinesPath string, logOpts *logFlags, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("expected list, show or hash")
+	}
+	logger, closeLog, err := logOpts.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	guidelines, err := config.LoadGuidelines(guidelinesPath, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load guidelines: %w", err)
+	}
+
+	switch args[0] {
+	case "list":
+		for _, tech := range guidelines.Techniques {
+			fmt.Printf("%s\n    %s\n", tech.Name, tech.Summarized)
+		}
+	case "show":
+		if len(args) != 2 {
+			return usageErrorf("usage: tokinfo guidelines show <technique>")
+		}
+		tech, found := config.GetTechniqueByName(guidelines.Techniques, args[1])
+		if !found {
+			return fmt.Errorf("technique '%s' not found in guidelines", args[1])
+		}
+		fmt.Printf("%s\n\n%s\n", tech.Name, tech.Complete)
+	case "hash":
+		fmt.Println(guidelines.Hash())
+	default:
+		return usageErrorf("unknown guidelines command '%s' (expected list, show or hash)", args[0])
+	}
+	return nil
+}
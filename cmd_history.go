@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	answers "tokinfo/internal/answers"
+	history "tokinfo/internal/history"
+)
+
+// historyCommandFlags hold the flags of the history command's read-only
+// subcommands; rerun and export have flags of their own.
+type historyCommandFlags struct {
+	history *historyFlags
+	limit   *int
+	format  *string
+}
+
+// historyCommand lists, searches, shows, reruns and exports recorded runs.
+func historyCommand() *command {
+	return &command{
+		name:    "history",
+		usage:   "[flags] list | show ID | search QUERY | rerun ID [flags] | export [flags]",
+		summary: "Browse the runs recorded by enhance and batch: list the latest, search them, show one in full,\nrun one again with the same prompt and answers, or export them all. IDs may be shortened to any\nunambiguous prefix. Run 'tokinfo help history rerun' or 'tokinfo help history export' for their flags.",
+		words:   []string{"list", "show", "search", "rerun", "export"},
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := &historyCommandFlags{
+				history: addHistoryFileFlag(fs),
+				limit:   fs.Int("n", 20, "Number of entries list and search print, newest first (0 = all)"),
+				format:  fs.String("format", "text", "Output format of list, search and show: text or json"),
+			}
+			return func(args []string) error {
+				return runHistory(f, args)
+			}
+		},
+		subcommands: []*command{historyRerunCommand(), historyExportCommand()},
+	}
+}
+
+// runHistory executes the read-only history subcommands.
+func runHistory(f *historyCommandFlags, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("expected list, show, search, rerun or export")
+	}
+	format := *f.format
+	if format != "text" && format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", format)
+	}
+	store, err := f.history.open()
+	if err != nil {
+		return err
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "list", "search":
+		var entries []history.Entry
+		if command == "list" {
+			if len(rest) != 0 {
+				return usageErrorf("list takes no arguments")
+			}
+			entries, err = store.List()
+		} else {
+			if len(rest) == 0 {
+				return usageErrorf("search needs a query")
+			}
+			entries, err = store.Search(strings.Join(rest, " "))
+		}
+		if err != nil {
+			return err
+		}
+		return writeHistoryList(os.Stdout, latest(entries, *f.limit), format)
+	case "show":
+		if len(rest) != 1 {
+			return usageErrorf("show needs one history ID")
+		}
+		entry, err := store.Get(rest[0])
+		if err != nil {
+			return err
+		}
+		if format == "json" {
+			return writeJSON(os.Stdout, entry)
+		}
+		return writeHistoryEntry(os.Stdout, entry)
+	case "rerun", "export":
+		// Only reached when flags come before the subcommand's name.
+		return usageErrorf("put the flags of %s after its name, as in 'tokinfo history %s ...'", command, command)
+	default:
+		return usageErrorf("unknown history command '%s' (expected list, show, search, rerun or export)", command)
+	}
+}
+
+// historyRerunCommand runs a recorded prompt again with its answers.
+func historyRerunCommand() *command {
+	return &command{
+		name:    "history rerun",
+		usage:   "[flags] ID",
+		summary: "Enhance the prompt of a recorded run again with the same answers, unless -answers or -answer\ngive others. The enhance flags apply, and the new run is recorded in the history too.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := addEnhanceFlags(fs)
+			return func(args []string) error {
+				if len(args) != 1 {
+					return usageErrorf("rerun needs one history ID")
+				}
+				store, err := f.history.open()
+				if err != nil {
+					return err
+				}
+				entry, err := store.Get(args[0])
+				if err != nil {
+					return err
+				}
+				// The recorded answers are used unless -answers or -answer give others.
+				f.input.preset = &entry.Prompt
+				f.answers.preset = answers.FromMap(entry.Answers())
+				return runEnhance(f, nil, "history rerun")
+			}
+		},
+	}
+}
+
+// historyExportCommand writes every recorded run to a file or stdout.
+func historyExportCommand() *command {
+	return &command{
+		name:    "history export",
+		usage:   "[flags]",
+		summary: "Export every recorded run, oldest first, as JSON lines or as one JSON array.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			historyFile := addHistoryFileFlag(fs)
+			exportPath := fs.String("o", "", "File to write to (default: stdout)")
+			format := fs.String("format", "jsonl", "Output format: jsonl (one run per line) or json (an array)")
+			return func(args []string) error {
+				if len(args) != 0 {
+					return usageErrorf("export takes no arguments")
+				}
+				if *format != "jsonl" && *format != "json" {
+					return usageErrorf("unknown -format '%s' (expected jsonl or json)", *format)
+				}
+				store, err := historyFile.open()
+				if err != nil {
+					return err
+				}
+				entries, err := store.List()
+				if err != nil {
+					return err
+				}
+				return exportHistory(entries, *exportPath, *format)
+			}
+		},
+	}
+}
+
+// latest returns the last n entries, newest first, or all of them if n is 0.
+func latest(entries []history.Entry, n int) []history.Entry {
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	reversed := make([]history.Entry, len(entries))
+	for i, entry := range entries {
+		reversed[len(entries)-1-i] = entry
+	}
+	return reversed
+}
+
+// writeHistoryList prints one line per entry, or a JSON array.
+func writeHistoryList(w io.Writer, entries []history.Entry, format string) error {
+	if format == "json" {
+		return writeJSON(w, entries)
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		firstLine, _, _ := strings.Cut(strings.TrimSpace(entry.Prompt), "\n")
+		fmt.Fprintf(&b, "%s  %s  %-22s %s\n", entry.ID, entry.Time.Local().Format("2006-01-02 15:04"), entry.Technique, truncate(firstLine, 60))
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// writeHistoryEntry prints every field of entry.
+func writeHistoryEntry(w io.Writer, entry *history.Entry) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID:         %s\n", entry.ID)
+	fmt.Fprintf(&b, "Time:       %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "Command:    %s\n", entry.Command)
+	fmt.Fprintf(&b, "Source:     %s\n", entry.PromptSource)
+	fmt.Fprintf(&b, "Guidelines: %s (%s)\n", entry.GuidelinesPath, entry.GuidelinesHash)
+	fmt.Fprintf(&b, "Model:      %s\n", entry.Model)
+	fmt.Fprintf(&b, "Technique:  %s\n", entry.Technique)
+	if entry.Rationale != "" {
+		fmt.Fprintf(&b, "Rationale:  %s\n", entry.Rationale)
+	}
+	if entry.OutputPath != "" {
+		fmt.Fprintf(&b, "Output:     %s\n", entry.OutputPath)
+	}
+	fmt.Fprintf(&b, "\n--- Prompt ---\n%s\n", strings.TrimRight(entry.Prompt, "\n"))
+	if len(entry.Questions) > 0 {
+		b.WriteString("\n--- Questions ---\n")
+		for _, q := range entry.Questions {
+			fmt.Fprintf(&b, "Q: %s\nA: %s (%s)\n", q.Question, q.Answer, q.Source)
+		}
+	}
+	fmt.Fprintf(&b, "\n--- Enhanced prompt ---\n%s\n", strings.TrimRight(entry.EnhancedPrompt, "\n"))
+	if entry.Usage != nil {
+		b.WriteString("\n--- Usage ---\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write history entry: %w", err)
+	}
+	if entry.Usage != nil {
+		return entry.Usage.WriteText(w)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// exportHistory writes every entry as JSON lines with the jsonl format, or
+// as a JSON array with the json format, to path or stdout.
+func exportHistory(entries []history.Entry, path string, format string) error {
+	if path == "" {
+		return writeHistory(os.Stdout, entries, format)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	if err := writeHistory(file, entries, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return nil
+}
+
+// writeHistory writes entries to w in format; see exportHistory.
+func writeHistory(w io.Writer, entries []history.Entry, format string) error {
+	if format == "json" {
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		return writeJSON(w, entries)
+	}
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to export history: %w", err)
+		}
+	}
+	return nil
+}
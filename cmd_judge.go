@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	judge "tokinfo/internal/judge"
+	prompt "tokinfo/internal/prompt"
+)
+
+// judgeFlags hold the flags specific to the judge command.
+type judgeFlags struct {
+	enhancedPath *string
+	technique    *string
+	responsePath *string
+	criteriaPath *string
+	minScore     *int
+	format       *string
+}
+
+// judgeCommand scores a prompt, or a response to it, with an LLM judge.
+func judgeCommand() *command {
+	return &command{
+		name:    "judge",
+		usage:   "[flags] [prompt | file]",
+		summary: "Score a prompt from 1 to 5 per criterion with an LLM judge, with a justification for each score.\nBy default the criteria are clarity and specificity, plus preservation of intent with -enhanced\nand adherence to the technique with -technique. -response scores a response to the prompt instead.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			input := addPromptFlags(fs)
+			client := addClientFlags(fs)
+			f := &judgeFlags{
+				enhancedPath: fs.String("enhanced", "", "File with an enhanced version of the prompt to score against the original"),
+				technique:    fs.String("technique", "", "Technique the enhanced prompt should apply, scored against its description in the guidelines"),
+				responsePath: fs.String("response", "", "File with a model's response to the prompt to score instead (needs -criteria)"),
+				criteriaPath: fs.String("criteria", "", "JSON or YAML file listing the criteria (name and description) to score against"),
+				minScore:     fs.Int("min-score", 0, "Exit with status 1 if any criterion scores below this (0 = never)"),
+				format:       fs.String("format", "text", "Output format: text or json"),
+			}
+			return func(args []string) error {
+				return runJudge(input, client, f, args)
+			}
+		},
+	}
+}
+
+// runJudge executes the judge command.
+func runJudge(input *promptFlags, client *clientFlags, f *judgeFlags, args []string) error {
+	if *f.format != "text" && *f.format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", *f.format)
+	}
+	if *f.minScore < 0 || *f.minScore > judge.MaxScore {
+		return usageErrorf("-min-score must be between 0 and %d", judge.MaxScore)
+	}
+	if *f.responsePath != "" && (*f.enhancedPath != "" || *f.technique != "") {
+		return usageErrorf("-response cannot be combined with -enhanced or -technique")
+	}
+	if *f.responsePath != "" && *f.criteriaPath == "" {
+		return usageErrorf("-response needs -criteria to say what the response is scored against")
+	}
+
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	var criteria []judge.Criterion
+	if *f.criteriaPath != "" {
+		if criteria, err = judge.LoadCriteria(*f.criteriaPath); err != nil {
+			return err
+		}
+	}
+	userPrompt, _, err := input.read(args, logger)
+	if err != nil {
+		return err
+	}
+	var enhanced, response string
+	if *f.enhancedPath != "" {
+		if enhanced, err = prompt.ReadFile(*f.enhancedPath, logger); err != nil {
+			return err
+		}
+	}
+	if *f.responsePath != "" {
+		if response, err = prompt.ReadFile(*f.responsePath, logger); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	s, err := client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	j := judge.New(s.client, s.guidelines)
+	var result *judge.Result
+	if *f.responsePath != "" {
+		result, err = j.ScoreResponse(ctx, userPrompt, response, criteria)
+	} else {
+		result, err = j.ScorePrompt(ctx, judge.PromptInput{Original: userPrompt, Enhanced: enhanced, Technique: *f.technique}, criteria)
+	}
+	if err != nil {
+		return fmt.Errorf("judge Gemini call failed: %w", err)
+	}
+
+	if *f.format == "json" {
+		err = writeJSON(os.Stdout, result)
+	} else {
+		err = result.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	if *f.minScore > 0 && result.Lowest() < *f.minScore {
+		return fmt.Errorf("lowest score %d is below the minimum of %d", result.Lowest(), *f.minScore)
+	}
+	return nil
+}
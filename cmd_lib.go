@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	diff "tokinfo/internal/diff"
+	library "tokinfo/internal/library"
+)
+
+// libFlags hold the flags of the lib command.
+type libFlags struct {
+	input       *promptFlags
+	logs        *logFlags
+	dir         *string
+	description *string
+	tags        *string
+	note        *string
+	color       *string
+	format      *string
+}
+
+// libCommand manages the named prompt library.
+func libCommand() *command {
+	return &command{
+		name:    "lib",
+		usage:   "[flags] save NAME [prompt | file] | get NAME[@vN] | list | show NAME | diff NAME[@vN] [NAME@vN]",
+		summary: "Keep named prompts with their versions, descriptions and tags as plain files that can be\ncommitted to git. Saving a prompt adds a version when its text changed; enhance -save adds\nthe enhanced prompt as a new version linked to the technique used.",
+		words:   []string{"save", "get", "list", "show", "diff"},
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := &libFlags{
+				input:       addPromptFlags(fs),
+				logs:        addLogFlags(fs),
+				dir:         addLibraryFlag(fs),
+				description: fs.String("description", "", "Description of the prompt, set by save"),
+				tags:        fs.String("tag", "", "Comma-separated tags added by save, or matched by list"),
+				note:        fs.String("note", "", "Note recorded with the version save adds"),
+				color:       addColorFlag(fs),
+				format:      fs.String("format", "text", "Output format: text or json"),
+			}
+			return func(args []string) error {
+				return runLib(f, args)
+			}
+		},
+	}
+}
+
+// addLibraryFlag registers -library on fs.
+func addLibraryFlag(fs *flag.FlagSet) *string {
+	dir := os.Getenv("TOKINFO_LIBRARY")
+	if dir == "" {
+		dir = library.DefaultDir
+	}
+	return fs.String("library", dir, "Prompt library directory (default from $TOKINFO_LIBRARY)")
+}
+
+// runLib executes the lib command.
+func runLib(f *libFlags, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("expected save, get, list, show or diff")
+	}
+	if *f.format != "text" && *f.format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", *f.format)
+	}
+	lib := library.Open(*f.dir)
+	command, rest := args[0], args[1:]
+	switch command {
+	case "save":
+		if len(rest) == 0 {
+			return usageErrorf("save needs a prompt name")
+		}
+		return libSave(f, lib, rest[0], rest[1:])
+	case "get":
+		if len(rest) != 1 {
+			return usageErrorf("get needs one prompt reference, such as NAME or NAME@v2")
+		}
+		p, v, text, err := lib.Get(rest[0])
+		if err != nil {
+			return err
+		}
+		if *f.format == "json" {
+			return writeJSON(os.Stdout, libVersion{Name: p.Name, Version: v, Text: text})
+		}
+		_, err = io.WriteString(os.Stdout, text)
+		return err
+	case "list":
+		if len(rest) != 0 {
+			return usageErrorf("list takes no arguments; filter with -tag")
+		}
+		prompts, err := lib.List()
+		if err != nil {
+			return err
+		}
+		prompts = filterByTags(prompts, splitTags(*f.tags))
+		if *f.format == "json" {
+			if prompts == nil {
+				prompts = []*library.Prompt{}
+			}
+			return writeJSON(os.Stdout, prompts)
+		}
+		var b strings.Builder
+		for _, p := range prompts {
+			fmt.Fprintf(&b, "%-24s v%-3d %-24s %s\n", p.Name, p.Latest().Version, strings.Join(p.Tags, ","), p.Description)
+		}
+		_, err = io.WriteString(os.Stdout, b.String())
+		return err
+	case "show":
+		if len(rest) != 1 {
+			return usageErrorf("show needs one prompt name")
+		}
+		p, err := lib.Load(rest[0])
+		if err != nil {
+			return err
+		}
+		if *f.format == "json" {
+			return writeJSON(os.Stdout, p)
+		}
+		return writePromptVersions(os.Stdout, p)
+	case "diff":
+		if len(rest) == 0 || len(rest) > 2 {
+			return usageErrorf("diff needs one or two prompt references, such as NAME@v1 NAME@v3")
+		}
+		useColor, err := colorEnabled(*f.color, os.Stdout)
+		if err != nil {
+			return err
+		}
+		return libDiff(lib, rest, useColor)
+	default:
+		return usageErrorf("unknown lib command '%s' (expected save, get, list, show or diff)", command)
+	}
+}
+
+// libVersion is the JSON document written by lib get -format json.
+type libVersion struct {
+	Name    string          `json:"name"`
+	Version library.Version `json:"version"`
+	Text    string          `json:"text"`
+}
+
+// libSave saves the prompt given by args or -p/-file as a new version of name.
+func libSave(f *libFlags, lib *library.Library, name string, args []string) error {
+	logger, closeLog, err := f.logs.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	text, _, err := f.input.read(args, logger)
+	if err != nil {
+		return err
+	}
+	update := library.Update{Description: *f.description, Tags: splitTags(*f.tags)}
+	v, added, err := lib.Save(name, text, library.Version{Note: *f.note}, update)
+	if err != nil {
+		return err
+	}
+	if added {
+		fmt.Fprintf(os.Stderr, "Saved %s@v%d.\n", name, v.Version)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s@v%d already has this text; no version added.\n", name, v.Version)
+	}
+	return nil
+}
+
+// libDiff prints a unified diff of two versions. A single reference is
+// compared with the version before it, or a bare name with its latest two.
+func libDiff(lib *library.Library, refs []string, color bool) error {
+	var fromRef, toRef string
+	if len(refs) == 2 {
+		fromRef, toRef = refs[0], refs[1]
+	} else {
+		p, v, _, err := lib.Get(refs[0])
+		if err != nil {
+			return err
+		}
+		if v.Version == p.Versions[0].Version {
+			return fmt.Errorf("%s@v%d is the first version; nothing to compare it with", p.Name, v.Version)
+		}
+		fromRef, toRef = fmt.Sprintf("%s@v%d", p.Name, v.Version-1), fmt.Sprintf("%s@v%d", p.Name, v.Version)
+	}
+	from, fromVersion, fromText, err := lib.Get(fromRef)
+	if err != nil {
+		return err
+	}
+	to, toVersion, toText, err := lib.Get(toRef)
+	if err != nil {
+		return err
+	}
+	fromName := fmt.Sprintf("%s@v%d", from.Name, fromVersion.Version)
+	toName := fmt.Sprintf("%s@v%d", to.Name, toVersion.Version)
+	_, err = io.WriteString(os.Stdout, diff.Unified(fromName, toName, fromText, toText, 3, color))
+	return err
+}
+
+// writePromptVersions prints the metadata and versions of p.
+func writePromptVersions(w io.Writer, p *library.Prompt) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Name:        %s\n", p.Name)
+	if p.Description != "" {
+		fmt.Fprintf(&b, "Description: %s\n", p.Description)
+	}
+	if len(p.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags:        %s\n", strings.Join(p.Tags, ", "))
+	}
+	b.WriteString("\n")
+	for _, v := range p.Versions {
+		fmt.Fprintf(&b, "v%-3d %s", v.Version, v.Created.Local().Format("2006-01-02 15:04"))
+		if v.Technique != "" {
+			fmt.Fprintf(&b, "  enhanced from v%d with %s", v.EnhancedFrom, v.Technique)
+		}
+		if v.Note != "" {
+			fmt.Fprintf(&b, "  %s", v.Note)
+		}
+		b.WriteString("\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write prompt versions: %w", err)
+	}
+	return nil
+}
+
+// splitTags splits a comma-separated list of tags.
+func splitTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// filterByTags returns the prompts that have every tag of tags.
+func filterByTags(prompts []*library.Prompt, tags []string) []*library.Prompt {
+	if len(tags) == 0 {
+		return prompts
+	}
+	var matches []*library.Prompt
+	for _, p := range prompts {
+		matched := true
+		for _, tag := range tags {
+			matched = matched && p.HasTag(tag)
+		}
+		if matched {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	lint "tokinfo/internal/lint"
+)
+
+// lintCommand checks a prompt offline for common problems.
+func lintCommand() *command {
+	return &command{
+		name:    "lint",
+		usage:   "[flags] [prompt | file]",
+		summary: "Check a prompt offline for missing elements (instruction, context, input data, output indicator),\nvague verbs, conflicting instructions, unbalanced delimiters and excessive length.\nNeeds neither an API key nor a network connection.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			input := addPromptFlags(fs)
+			logs := addLogFlags(fs)
+			format := fs.String("format", "text", "Output format: text or json")
+			maxTokens := fs.Int("max-tokens", lint.DefaultMaxTokens, "Estimated token count above which a prompt is too long")
+			disable := fs.String("disable", "", "Comma-separated rules to skip: "+strings.Join(lint.Rules, ", "))
+			failOn := fs.String("fail-on", "warning", "Exit with status 1 when a finding is at least this severe: error, warning, info or none")
+			return func(args []string) error {
+				return runLint(input, logs, *format, *maxTokens, *disable, *failOn, args)
+			}
+		},
+	}
+}
+
+// runLint executes the lint command.
+func runLint(input *promptFlags, logs *logFlags, format string, maxTokens int, disable string, failOn string, args []string) error {
+	if format != "text" && format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", format)
+	}
+	if maxTokens <= 0 {
+		return usageErrorf("-max-tokens must be positive")
+	}
+	options := lint.Options{MaxTokens: maxTokens, Disabled: make(map[string]bool)}
+	for _, rule := range strings.Split(disable, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		if !isLintRule(rule) {
+			return usageErrorf("unknown rule '%s' in -disable (expected %s)", rule, strings.Join(lint.Rules, ", "))
+		}
+		options.Disabled[rule] = true
+	}
+	threshold := lint.Severity(-1)
+	if failOn != "none" {
+		var err error
+		if threshold, err = lint.ParseSeverity(failOn); err != nil {
+			return usageErrorf("-fail-on: %v", err)
+		}
+	}
+
+	logger, closeLog, err := logs.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	text, stdinUsed, err := input.read(args, logger)
+	if err != nil {
+		return err
+	}
+
+	findings := lint.Lint(text, options)
+	if format == "json" {
+		if findings == nil {
+			findings = []lint.Finding{} // Encode as [] rather than null
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		name := input.path
+		switch {
+		case name != "":
+		case stdinUsed:
+			name = "<stdin>"
+		default:
+			name = "<argument>"
+		}
+		for _, f := range findings {
+			fmt.Printf("%s:%d:%d: %s: %s [%s]\n", name, f.Line, f.Column, f.Severity, f.Message, f.Rule)
+		}
+	}
+
+	failing := 0
+	for _, f := range findings {
+		if threshold >= 0 && f.Severity >= threshold {
+			failing++
+		}
+	}
+	if failing > 0 {
+		return fmt.Errorf("%d of %d findings are %s or worse", failing, len(findings), threshold)
+	}
+	return nil
+}
+
+// isLintRule reports whether name is a lint rule.
+func isLintRule(name string) bool {
+	for _, rule := range lint.Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	enhance "tokinfo/internal/enhance"
+	lint "tokinfo/internal/lint"
+	lsp "tokinfo/internal/lsp"
+)
+
+// lspCommand runs the Language Server Protocol server.
+func lspCommand() *command {
+	return &command{
+		name:    "lsp",
+		usage:   "[flags]",
+		summary: "Serve prompt files (.prompt, .md, .txt, ...) to editors as a Language Server Protocol server over stdio.\nOffers diagnostics from the offline linter and the Stage 1 analysis, hover with the recommended technique and an \"Enhance prompt\" code action.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			client := addClientFlags(fs)
+			noAnalysis := fs.Bool("no-analysis", false, "Do not run the Stage 1 analysis when a prompt is opened or saved")
+			noLint := fs.Bool("no-lint", false, "Do not report findings of the offline linter as the prompt is edited")
+			return func(args []string) error {
+				if len(args) > 0 {
+					return usageErrorf("lsp takes no arguments")
+				}
+				options := lsp.Options{Analyze: !*noAnalysis}
+				if !*noLint {
+					options.Checks = lintDiagnostics
+				}
+				return runLSP(client, options)
+			}
+		},
+	}
+}
+
+// runLSP executes the lsp command until the editor sends exit.
+// Standard output carries the protocol, so logs always go to stderr or -log-file.
+func runLSP(client *clientFlags, options lsp.Options) error {
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	ctx := context.Background()
+	s, err := client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	server := lsp.New(enhance.New(s.client, s.guidelines), logger, options)
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// lintDiagnostics converts the linter's findings for text into diagnostics.
+func lintDiagnostics(text string) []lsp.Diagnostic {
+	var diagnostics []lsp.Diagnostic
+	for _, f := range lint.Lint(text, lint.Options{}) {
+		severity := lsp.SeverityInformation
+		switch f.Severity {
+		case lint.Error:
+			severity = lsp.SeverityError
+		case lint.Warning:
+			severity = lsp.SeverityWarning
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    lsp.Range{Start: lsp.PositionAt(text, f.Start), End: lsp.PositionAt(text, f.End)},
+			Severity: severity,
+			Code:     f.Rule,
+			Source:   "tokinfo lint",
+			Message:  f.Message,
+		})
+	}
+	return diagnostics
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"runtime/debug"
+
+	enhance "tokinfo/internal/enhance"
+	mcp "tokinfo/internal/mcp"
+)
+
+// mcpCommand runs the Model Context Protocol server.
+func mcpCommand() *command {
+	return &command{
+		name:    "mcp",
+		usage:   "[flags]",
+		summary: "Serve the enhancer as a Model Context Protocol server over stdio.\nTools: analyze_prompt, enhance_prompt and list_techniques; resources: technique://<name> for each technique.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			client := addClientFlags(fs)
+			return func(args []string) error {
+				if len(args) > 0 {
+					return usageErrorf("mcp takes no arguments")
+				}
+				return runMCP(client)
+			}
+		},
+	}
+}
+
+// runMCP executes the mcp command until standard input is closed.
+// Standard output carries the protocol, so logs always go to stderr or -log-file.
+func runMCP(client *clientFlags) error {
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s, err := client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	server := mcp.New(enhance.New(s.client, s.guidelines), logger, buildVersion())
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// buildVersion returns the module version tokinfo was built from.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	answers "tokinfo/internal/answers"
+)
+
+// memoryCommand lists or forgets the answers remembered for a project.
+func memoryCommand() *command {
+	return &command{
+		name:    "memory",
+		usage:   "[flags] list | forget",
+		summary: "List the answers to clarifying questions remembered for the current project, which enhance,\nbatch and tui reuse for similar questions, or forget them all. -project selects another project.",
+		words:   []string{"list", "forget"},
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := addMemoryFlags(fs)
+			format := fs.String("format", "text", "Output format: text or json")
+			return func(args []string) error {
+				return runMemory(f, *format, args)
+			}
+		},
+	}
+}
+
+// runMemory executes the memory command.
+func runMemory(f *memoryFlags, format string, args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("expected list or forget")
+	}
+	if format != "text" && format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", format)
+	}
+	memory, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		list := memory.List()
+		if format == "json" {
+			if list == nil {
+				list = []answers.Remembered{}
+			}
+			return writeJSON(os.Stdout, list)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Project: %s\n", memory.Project())
+		for _, r := range list {
+			fmt.Fprintf(&b, "- %s\n  %s (used %d times, last %s)\n", r.Question, r.Answer, r.Count, r.Used.Local().Format("2006-01-02"))
+		}
+		_, err := io.WriteString(os.Stdout, b.String())
+		return err
+	case "forget":
+		n := memory.Forget()
+		if err := memory.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Forgot %d answers for %s.\n", n, memory.Project())
+		return nil
+	default:
+		return usageErrorf("unknown memory command '%s' (expected list or forget)", args[0])
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	enhance "tokinfo/internal/enhance"
+	judge "tokinfo/internal/judge"
+	prompt "tokinfo/internal/prompt"
+	regress "tokinfo/internal/regress"
+)
+
+// regressFlags hold the flags specific to the regress command.
+type regressFlags struct {
+	client    *clientFlags
+	goldenDir *string
+	compare   *string
+	threshold *float64
+	update    *bool
+	showDiff  *bool
+	color     *string
+	format    *string
+	// thresholdSet is true if -threshold was given, so that 0 can be chosen.
+	thresholdSet bool
+}
+
+// regressCommand compares enhanced prompts with stored golden outputs.
+func regressCommand() *command {
+	return &command{
+		name:    "regress",
+		usage:   "[flags] <dir | glob | file.jsonl>...",
+		summary: "Enhance a fixed corpus of prompts with the current guidelines and compare the results with golden\noutputs stored by an earlier run, reporting the prompts that changed. Exits with status 1 if any\nprompt changed, has no golden output or failed; -update stores the current outputs instead.\nWith -replay and a committed -cache-dir, it runs in CI without calling the API.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := &regressFlags{
+				client:    addClientFlags(fs),
+				goldenDir: fs.String("golden", "golden", "Directory of the golden outputs, one JSON file per prompt"),
+				compare:   fs.String("compare", regress.ModeExact, "How outputs are compared: exact, words (cosine similarity of word counts, not embeddings) or judge (LLM judge score)"),
+				threshold: fs.Float64("threshold", 0, "Similarity (0-1) or judge score (1-5) below which a prompt changed (default 0.85 or 4)"),
+				update:    fs.Bool("update", false, "Store the current outputs as the new golden outputs for new and changed prompts"),
+				showDiff:  fs.Bool("diff", false, "Print a unified diff of every changed prompt"),
+				color:     addColorFlag(fs),
+				format:    fs.String("format", "text", "Output format: text or json"),
+			}
+			return func(args []string) error {
+				if len(args) == 0 {
+					return usageErrorf("regress needs at least one directory, glob or JSONL file of prompts")
+				}
+				fs.Visit(func(fl *flag.Flag) {
+					if fl.Name == "threshold" {
+						f.thresholdSet = true
+					}
+				})
+				return runRegress(f, args)
+			}
+		},
+	}
+}
+
+// runRegress executes the regress command.
+func runRegress(f *regressFlags, args []string) error {
+	if *f.format != "text" && *f.format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", *f.format)
+	}
+	comparer := &regress.Comparer{Mode: *f.compare, Threshold: *f.threshold}
+	switch comparer.Mode {
+	case regress.ModeExact, regress.ModeWords, regress.ModeJudge:
+	default:
+		return usageErrorf("unknown -compare '%s' (expected exact, words or judge)", comparer.Mode)
+	}
+	if !f.thresholdSet {
+		comparer.Threshold = regress.DefaultThreshold(comparer.Mode)
+	}
+	useColor, err := colorEnabled(*f.color, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	logger, closeLog, err := f.client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	items, err := collectBatchItems(args)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no prompts found")
+	}
+	goldenPaths, err := goldenPaths(*f.goldenDir, items)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s, err := f.client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	enhancer := enhance.New(s.client, s.guidelines)
+	comparer.Judge = judge.New(s.client, s.guidelines)
+
+	report := &regress.Report{
+		Mode:           comparer.Mode,
+		Threshold:      comparer.Threshold,
+		GuidelinesHash: s.guidelines.Hash(),
+		Cases:          []regress.Case{},
+		Counts:         make(map[string]int),
+	}
+	for i, item := range items {
+		c := regressItem(ctx, f, enhancer, comparer, item, goldenPaths[i], report.GuidelinesHash, logger)
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted after %d of %d prompts", len(report.Cases), len(items))
+		}
+		report.Cases = append(report.Cases, c)
+		report.Counts[c.Status]++
+	}
+
+	if *f.format == "json" {
+		err = writeJSON(os.Stdout, report)
+	} else {
+		err = report.WriteText(os.Stdout, *f.showDiff, useColor)
+	}
+	if err != nil {
+		return err
+	}
+	if errors := report.Counts[regress.StatusError]; errors > 0 {
+		return fmt.Errorf("%d of %d prompts failed", errors, len(report.Cases))
+	}
+	if report.Failed() {
+		return fmt.Errorf("%d of %d prompts changed or are new; run with -update to accept the current outputs", report.Counts[regress.StatusChanged]+report.Counts[regress.StatusNew], len(report.Cases))
+	}
+	return nil
+}
+
+// goldenPaths returns the golden file of each item under dir. GoldenPath
+// flattens ids, so distinct ids such as a/b and a_b can share a file; that
+// is an error rather than letting one prompt's golden output replace another's.
+func goldenPaths(dir string, items []batchItem) ([]string, error) {
+	paths := make([]string, len(items))
+	used := make(map[string]string, len(items))
+	for i, item := range items {
+		paths[i] = regress.GoldenPath(dir, item.id)
+		if other, ok := used[paths[i]]; ok {
+			return nil, fmt.Errorf("prompts '%s' and '%s' share the golden file '%s'; rename one of them", other, item.id, paths[i])
+		}
+		used[paths[i]] = item.id
+	}
+	return paths, nil
+}
+
+// regressItem enhances one prompt of the corpus and compares it with its
+// golden output at goldenPath, updating the golden file if requested.
+func regressItem(ctx context.Context, f *regressFlags, enhancer *enhance.Enhancer, comparer *regress.Comparer, item batchItem, goldenPath string, guidelinesHash string, logger *slog.Logger) regress.Case {
+	c := regress.Case{ID: item.id}
+	fail := func(err error) regress.Case {
+		c.Status, c.Detail = regress.StatusError, err.Error()
+		return c
+	}
+
+	userPrompt := item.prompt
+	if item.path != "" {
+		var err error
+		if userPrompt, err = prompt.ReadFile(item.path, logger); err != nil {
+			return fail(err)
+		}
+	}
+	golden, found, err := regress.LoadGolden(goldenPath)
+	if err != nil {
+		return fail(err)
+	}
+	logger.Info("enhancing corpus prompt", "id", item.id)
+	result, err := enhancer.Enhance(ctx, userPrompt, enhance.Answering{})
+	if err != nil {
+		return fail(err)
+	}
+	c.Technique, c.EnhancedPrompt = result.Technique, result.EnhancedPrompt
+
+	switch {
+	case !found:
+		c.Status = regress.StatusNew
+	case golden.Prompt != userPrompt:
+		// The corpus prompt itself was edited, so the golden output no longer applies.
+		c.Status, c.GoldenTechnique, c.Golden = regress.StatusChanged, golden.Technique, golden.EnhancedPrompt
+		c.Detail = "prompt differs from the one the golden output was stored for"
+	default:
+		c.GoldenTechnique, c.Golden = golden.Technique, golden.EnhancedPrompt
+		changed, score, detail, err := comparer.Compare(ctx, golden.EnhancedPrompt, result.EnhancedPrompt)
+		if err != nil {
+			return fail(fmt.Errorf("comparison failed: %w", err))
+		}
+		c.Score, c.Detail = score, detail
+		c.Status = regress.StatusUnchanged
+		if changed || golden.Technique != result.Technique {
+			c.Status = regress.StatusChanged
+		}
+	}
+
+	if *f.update && c.Status != regress.StatusUnchanged {
+		updated := &regress.Golden{ID: item.id, Prompt: userPrompt, Technique: result.Technique, EnhancedPrompt: result.EnhancedPrompt, GuidelinesHash: guidelinesHash}
+		if err := updated.Write(goldenPath); err != nil {
+			return fail(err)
+		}
+		c.Updated = true
+	}
+	return c
+}
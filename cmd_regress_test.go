@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoldenPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		err  string // Expected error fragment, if any
+	}{
+		{"distinct", []string{"a/b", "a/c", "b"}, ""},
+		{"slash and underscore", []string{"a/b", "a_b"}, "prompts 'a/b' and 'a_b' share"},
+		{"slash and colon", []string{"a/b", "a:b"}, "prompts 'a/b' and 'a:b' share"},
+		{"leading underscore", []string{"a/b", "_a_b"}, "prompts 'a/b' and '_a_b' share"},
+		{"same id twice", []string{"a", "a"}, "prompts 'a' and 'a' share"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]batchItem, len(tt.ids))
+			for i, id := range tt.ids {
+				items[i] = batchItem{id: id}
+			}
+			paths, err := goldenPaths("golden", items)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("goldenPaths error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != len(items) {
+				t.Fatalf("goldenPaths returned %d paths, want %d", len(paths), len(items))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	prompt "tokinfo/internal/prompt"
+	variables "tokinfo/internal/variables"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renderFlags hold the flags of the render command.
+type renderFlags struct {
+	input      *promptFlags
+	logs       *logFlags
+	dataPath   *string
+	style      *string
+	list       *bool
+	outputPath *string
+	format     *string
+}
+
+// renderCommand fills in the variables of a prompt template.
+func renderCommand() *command {
+	return &command{
+		name:    "render",
+		usage:   "[flags] [prompt | file]",
+		summary: "Fill in the variables of a prompt template from a JSON or YAML data file. Go templates\n({{.Name}}), Mustache ({{name}}, {{#items}}...{{/items}}) and {name} placeholders are supported;\n-list prints the variables found instead.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			f := &renderFlags{
+				input:      addPromptFlags(fs),
+				logs:       addLogFlags(fs),
+				dataPath:   fs.String("data", "", "JSON or YAML file with the values of the variables"),
+				style:      fs.String("style", "auto", "Template style: auto, go, mustache or brace"),
+				list:       fs.Bool("list", false, "Print the variables of the template instead of rendering it"),
+				outputPath: fs.String("g", "", "Optional path to save the rendered prompt"),
+				format:     fs.String("format", "text", "Output format of -list: text or json"),
+			}
+			return func(args []string) error {
+				return runRender(f, args)
+			}
+		},
+	}
+}
+
+// runRender executes the render command.
+func runRender(f *renderFlags, args []string) error {
+	style := variables.Style(*f.style)
+	switch style {
+	case "auto":
+		style = ""
+	case variables.Go, variables.Mustache, variables.Brace:
+	default:
+		return usageErrorf("unknown -style '%s' (expected auto, go, mustache or brace)", *f.style)
+	}
+	if *f.format != "text" && *f.format != "json" {
+		return usageErrorf("unknown -format '%s' (expected text or json)", *f.format)
+	}
+	if !*f.list && *f.dataPath == "" {
+		return usageErrorf("render needs -data with the values of the variables, or -list")
+	}
+
+	logger, closeLog, err := f.logs.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	template, _, err := f.input.read(args, logger)
+	if err != nil {
+		return err
+	}
+
+	if *f.list {
+		vars := variables.Find(template)
+		if *f.format == "json" {
+			if vars == nil {
+				vars = []variables.Variable{}
+			}
+			return writeJSON(os.Stdout, vars)
+		}
+		var b strings.Builder
+		for _, v := range vars {
+			fmt.Fprintf(&b, "%-9s %s\n", v.Style, v.Text)
+		}
+		_, err := io.WriteString(os.Stdout, b.String())
+		return err
+	}
+
+	data, err := loadTemplateData(*f.dataPath)
+	if err != nil {
+		return err
+	}
+	rendered, err := variables.Render(template, data, style)
+	if err != nil {
+		return err
+	}
+	return prompt.HandleOutput(rendered, *f.outputPath, logger)
+}
+
+// loadTemplateData reads the values of template variables from a JSON or
+// YAML file holding one object.
+func loadTemplateData(path string) (map[string]any, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file '%s': %w", path, err)
+	}
+	// YAML is a superset of JSON, so one decoder reads both.
+	var data map[string]any
+	if err := yaml.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse data file '%s': %w", path, err)
+	}
+	if data == nil {
+		data = make(map[string]any)
+	}
+	return data, nil
+}
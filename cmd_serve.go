@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	enhance "tokinfo/internal/enhance"
+	server "tokinfo/internal/server"
+)
+
+// serveCommand runs the HTTP API server.
+func serveCommand() *command {
+	return &command{
+		name:    "serve",
+		usage:   "[flags]",
+		summary: "Serve prompt analysis and enhancement over an HTTP JSON API.\nEndpoints: POST /v1/analyze, /v1/refine, /v1/enhance and /v1/sessions (then /v1/sessions/{id}/answers), GET /v1/techniques.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			client := addClientFlags(fs)
+			addr := fs.String("addr", "localhost:8080", "Address to listen on")
+			token := fs.String("token", os.Getenv("TOKINFO_API_TOKEN"), "Bearer token clients must send (default $TOKINFO_API_TOKEN; empty = no authentication)")
+			sessionTTL := fs.Duration("session-ttl", 30*time.Minute, "How long a session waits for the answers to its questions")
+			return func(args []string) error {
+				if len(args) > 0 {
+					return usageErrorf("serve takes no arguments")
+				}
+				return runServe(client, *addr, server.Options{Token: *token, SessionTTL: *sessionTTL})
+			}
+		},
+	}
+}
+
+// runServe executes the serve command until interrupted.
+func runServe(client *clientFlags, addr string, options server.Options) error {
+	logger, closeLog, err := client.log.open(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s, err := client.newSession(context.Background(), logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	httpServer := &http.Server{
+		Handler:           server.New(enhance.New(s.client, s.guidelines), logger, options).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// The address goes to stderr whatever the log level, like a result of the command.
+	fmt.Fprintf(os.Stderr, "Listening on http://%s\n", listener.Addr())
+	if options.Token == "" && !isLoopback(listener.Addr()) {
+		logger.Warn("serving without a token on a non-loopback address; anyone who can reach it can spend the Gemini quota")
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- httpServer.Serve(listener) }()
+	select {
+	case err := <-served:
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Let requests in flight finish before exiting.
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return nil
+}
+
+// isLoopback reports whether addr only accepts local connections.
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	config "tokinfo/internal/config"
+	enhance "tokinfo/internal/enhance"
+	prompt "tokinfo/internal/prompt"
+	tui "tokinfo/internal/tui"
+)
+
+// tuiCommand runs an enhancement session in a full-screen terminal interface.
+func tuiCommand() *command {
+	return &command{
+		name:    "tui",
+		usage:   "[flags] [prompt | file]",
+		summary: "Run an enhancement session in a full-screen terminal interface.\nEdit the answers, switch technique and re-run while watching a live diff of the enhanced prompt.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			input := addPromptFlags(fs)
+			client := addClientFlags(fs)
+			answerOpts := addAnswerFlags(fs)
+			outputPath := fs.String("g", "", "Default path offered when saving the enhanced prompt")
+			return func(args []string) error {
+				return runTUI(input, client, answerOpts, *outputPath, args)
+			}
+		},
+	}
+}
+
+// runTUI executes the tui command.
+func runTUI(input *promptFlags, client *clientFlags, answerOpts *answerFlags, outputPath string, args []string) error {
+	// Logs written to the terminal would garble the interface, so they are
+	// held back while it is on screen and written out when it closes.
+	held := &heldWriter{w: os.Stderr}
+	logger, closeLog, err := client.log.open(held)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	userPrompt, stdinUsed, err := input.read(args, logger)
+	if err != nil {
+		return err
+	}
+	if stdinUsed || !prompt.StdinIsTerminal() {
+		return usageErrorf("the terminal UI needs standard input to be a terminal; pass the prompt as an argument or with -p")
+	}
+	provided, err := answerOpts.load()
+	if err != nil {
+		return err
+	}
+	memory, err := answerOpts.rememberer()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	s, err := client.newSession(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	enhancer := enhance.New(s.client, s.guidelines)
+
+	// --- Stage 1: Analysis & Clarification ---
+	fmt.Fprintln(os.Stderr, "Analyzing prompt...")
+	analysisResult, err := enhancer.Analyze(ctx, userPrompt)
+	if err != nil {
+		return err
+	}
+
+	session := tui.Session{
+		Prompt:   userPrompt,
+		SavePath: outputPath,
+	}
+	for i, tech := range s.guidelines.Techniques {
+		session.Techniques = append(session.Techniques, tui.Technique{Name: tech.Name, Summary: tech.Summarized})
+		if tech.Name == analysisResult.ChosenTechniqueName {
+			session.Technique = i
+		}
+	}
+	if _, found := config.GetTechniqueByName(s.guidelines.Techniques, analysisResult.ChosenTechniqueName); !found {
+		return fmt.Errorf("chosen technique '%s' not found in guidelines", analysisResult.ChosenTechniqueName)
+	}
+	// Pre-fill the answer fields with any answers given on the command line,
+	// or else given earlier to similar questions; the others start empty.
+	prefilled := enhance.Answer(analysisResult.ClarifyingQuestions, enhance.Answering{Provided: provided, Memory: memory, Unanswered: "skip"})
+	for i, question := range analysisResult.ClarifyingQuestions {
+		session.Questions = append(session.Questions, tui.Question{Text: question.Question, Example: question.ExampleAnswer})
+		session.Answers = append(session.Answers, prefilled[i].Answer)
+	}
+
+	// The answers of each refinement are remembered, like those enhance
+	// collects; saving remembers the answers the saved prompt was refined with.
+	var refinedWith []string
+	remember := func(answers []string) {
+		if memory == nil {
+			return // -no-memory
+		}
+		for i, question := range analysisResult.ClarifyingQuestions {
+			if answers[i] != "" {
+				memory.Remember(question.Question, answers[i])
+			}
+		}
+		// A memory that cannot be saved does not stop the session.
+		if err := memory.Save(); err != nil {
+			logger.Warn("could not save answer memory", "error", err)
+		}
+	}
+
+	// --- Stage 2: Refinement, re-run from the interface ---
+	session.Refine = func(technique int, answers []string) (string, error) {
+		refinedWith = slices.Clone(answers)
+		remember(refinedWith)
+		userAnswers := make(map[string]string)
+		for i, question := range analysisResult.ClarifyingQuestions {
+			// Empty fields fall back to the example answer, as in non-interactive mode.
+			userAnswers[question.Question] = answers[i]
+			if answers[i] == "" {
+				userAnswers[question.Question] = question.ExampleAnswer
+			}
+		}
+		return enhancer.Refine(ctx, userPrompt, s.guidelines.Techniques[technique].Name, userAnswers)
+	}
+	session.Save = func(path string, content string) error {
+		if err := prompt.HandleOutput(content, path, logger); err != nil {
+			return err
+		}
+		if refinedWith != nil {
+			remember(refinedWith)
+		}
+		return nil
+	}
+
+	held.hold()
+	result, err := tui.Run(session)
+	if flushErr := held.release(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// --- Output ---
+	// Like enhance, print the result unless it was saved to a file.
+	if result.SavedTo == "" && result.Enhanced != "" {
+		return prompt.HandleOutput(result.Enhanced, "", logger)
+	}
+	return nil
+}
+
+// heldWriter passes writes through to w, except between hold and release,
+// when they are buffered.
+type heldWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	holding bool
+	buf     bytes.Buffer
+}
+
+func (h *heldWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holding {
+		return h.buf.Write(p)
+	}
+	return h.w.Write(p)
+}
+
+// hold starts buffering writes.
+func (h *heldWriter) hold() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.holding = true
+}
+
+// release writes out the buffered writes and stops buffering.
+func (h *heldWriter) release() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.holding = false
+	_, err := h.buf.WriteTo(h.w)
+	return err
+}
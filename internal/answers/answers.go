@@ -0,0 +1,189 @@
+// Package answers resolves answers to clarifying questions that were provided
+// ahead of time, from an answers file or from the command line, so the
+// enhancement pipeline can run without prompting the user. It also remembers
+// the answers given in a project, to offer them again for similar questions.
+package answers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Question is a clarifying question and how a run answered it.
+type Question struct {
+	Question      string `json:"question"`
+	ExampleAnswer string `json:"exampleAnswer"`
+	Answer        string `json:"answer"`
+	Source        string `json:"source"` // provided, interactive, remembered, example or skipped
+}
+
+// Map returns the answers to questions keyed by question text, as the
+// refinement stage takes them, leaving out the skipped questions.
+func Map(questions []Question) map[string]string {
+	answers := make(map[string]string)
+	for _, q := range questions {
+		if q.Source != "skipped" {
+			answers[q.Question] = q.Answer
+		}
+	}
+	return answers
+}
+
+// entry is one provided answer. key is matched against the question text.
+type entry struct {
+	key    string
+	answer string
+}
+
+// Set holds answers provided ahead of time, in the order they were added.
+// Later answers take precedence over earlier ones for the same question.
+type Set struct {
+	entries []entry
+}
+
+// LoadFile reads a JSON or YAML file mapping questions (or fragments of
+// questions, or 1-based question numbers) to answers, for example:
+//
+//	"What is the target audience?": "Backend developers"
+//	tone: formal
+func LoadFile(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read answers file '%s': %w", path, err)
+	}
+
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse answers file '%s': %w", path, err)
+	}
+
+	// Sort the keys so precedence between overlapping fragments is stable.
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := &Set{}
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case string:
+			set.Add(key, v)
+		case nil:
+			set.Add(key, "")
+		default:
+			// Numbers and booleans are accepted as their text form.
+			set.Add(key, fmt.Sprint(v))
+		}
+	}
+	return set, nil
+}
+
+// FromMap returns a set holding the answers in m, keyed like an answers file.
+func FromMap(m map[string]string) *Set {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Stable precedence between overlapping fragments
+
+	set := &Set{}
+	for _, key := range keys {
+		set.Add(key, m[key])
+	}
+	return set
+}
+
+// ParseFlag splits a command-line answer of the form "question=value".
+func ParseFlag(value string) (key string, answer string, err error) {
+	key, answer, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return "", "", fmt.Errorf("invalid answer '%s' (expected \"question=value\")", value)
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(answer), nil
+}
+
+// Add records answer for the questions matching key.
+func (s *Set) Add(key string, answer string) {
+	s.entries = append(s.entries, entry{key: key, answer: answer})
+}
+
+// Merge appends every answer in other to s, so other takes precedence.
+func (s *Set) Merge(other *Set) {
+	if other != nil {
+		s.entries = append(s.entries, other.entries...)
+	}
+}
+
+// Len returns the number of provided answers.
+func (s *Set) Len() int {
+	return len(s.entries)
+}
+
+// Lookup returns the answer for the question at the 1-based position index.
+// A key matches when it equals the question, equals its position, or is a
+// fragment of the question ("audience" matches "What is the target audience?"),
+// ignoring case and punctuation. Keys made only of digits are positions and
+// never fragments, and fragments match whole words only, so "1" does not
+// answer a question about "12 months" and "age" does not answer one about
+// "language". Exact matches win over fragment matches, and longer fragments
+// over shorter ones. A nil *Set has no answers.
+func (s *Set) Lookup(index int, question string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	normalizedQuestion := Normalize(question)
+	padded := " " + normalizedQuestion + " "
+	position := strconv.Itoa(index)
+
+	fragment, fragmentLen := "", 0
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		e := s.entries[i]
+		key := Normalize(e.key)
+		if key == normalizedQuestion || key == position {
+			return e.answer, true
+		}
+		if key == "" || isNumber(key) {
+			continue
+		}
+		// Later entries come first, so they win ties between equal lengths.
+		if len(key) > fragmentLen && strings.Contains(padded, " "+key+" ") {
+			fragment, fragmentLen = e.answer, len(key)
+		}
+	}
+	return fragment, fragmentLen > 0
+}
+
+// isNumber reports whether key is made only of digits.
+func isNumber(key string) bool {
+	return strings.IndexFunc(key, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+// Normalize lowercases text, drops punctuation and collapses whitespace so that
+// small differences in how a question is phrased do not prevent a match.
+func Normalize(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
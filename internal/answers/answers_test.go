@@ -0,0 +1,60 @@
+package answers
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"What is the target audience?", "what is the target audience"},
+		{"  Tone,  please!  ", "tone please"},
+		{"What's the TONE?", "what s the tone"},
+		{"Últimos 12 meses", "últimos 12 meses"},
+		{"", ""},
+		{"?!", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.text); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  map[string]string
+		index    int
+		question string
+		want     string
+		found    bool
+	}{
+		{"exact question", map[string]string{"What is the target audience?": "developers"}, 1, "what is the target audience", "developers", true},
+		{"position", map[string]string{"2": "formal"}, 2, "What tone should it use?", "formal", true},
+		{"other position", map[string]string{"1": "first"}, 2, "What tone should it use?", "", false},
+		{"digits are not fragments", map[string]string{"1": "first"}, 2, "Should the summary cover the last 12 months?", "", false},
+		{"fragment", map[string]string{"audience": "developers"}, 1, "What is the target audience?", "developers", true},
+		{"fragment of several words", map[string]string{"target audience": "developers"}, 1, "What is the target audience?", "developers", true},
+		{"fragment inside a word", map[string]string{"age": "42"}, 1, "Which language should the message use?", "", false},
+		{"longest fragment wins", map[string]string{"audience": "everyone", "target audience": "developers"}, 1, "Who is the target audience?", "developers", true},
+		{"exact wins over fragment", map[string]string{"tone": "casual", "What tone should it use": "formal"}, 1, "What tone should it use?", "formal", true},
+		{"no match", map[string]string{"tone": "formal"}, 1, "What is the target audience?", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := FromMap(tt.answers).Lookup(tt.index, tt.question)
+			if got != tt.want || found != tt.found {
+				t.Errorf("Lookup(%d, %q) = %q, %v; want %q, %v", tt.index, tt.question, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestLookupLaterAnswerWins(t *testing.T) {
+	set := FromMap(map[string]string{"tone": "formal"})
+	set.Merge(FromMap(map[string]string{"tone": "casual"}))
+	if got, _ := set.Lookup(1, "What tone should it use?"); got != "casual" {
+		t.Errorf("Lookup = %q, want the later answer %q", got, "casual")
+	}
+}
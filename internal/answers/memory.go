@@ -0,0 +1,304 @@
+package answers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	datadir "tokinfo/internal/datadir"
+)
+
+// MinSimilarity is the lowest similarity at which a remembered question
+// matches a new one.
+const MinSimilarity = 0.6
+
+// Remembered is an answer given earlier to a clarifying question.
+type Remembered struct {
+	Question string    `json:"question"`
+	Answer   string    `json:"answer"`
+	Used     time.Time `json:"used"`
+	Count    int       `json:"count"` // Times the answer was given or reused
+}
+
+// memoryFile is the JSON document a memory is stored in. Answers are kept
+// per project, so the audience of one project is not offered in another.
+type memoryFile struct {
+	Projects map[string][]Remembered `json:"projects"`
+}
+
+// Memory remembers the answers given to clarifying questions in a project,
+// so they can be offered again when a similar question comes up. It is safe
+// for concurrent use.
+type Memory struct {
+	path      string
+	project   string
+	mu        sync.Mutex
+	file      memoryFile
+	changed   bool
+	forgotten bool // Forget was called; answers saved by other runs are dropped too
+}
+
+// DefaultMemoryPath returns the answer memory file under $XDG_DATA_HOME, or
+// ~/.local/share when it is not set.
+func DefaultMemoryPath() (string, error) {
+	return datadir.File("answers.json")
+}
+
+// OpenMemory reads the answers remembered for project from the file at path,
+// which is created on the first Save.
+func OpenMemory(path string, project string) (*Memory, error) {
+	file, err := readMemoryFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{path: path, project: project, file: file}, nil
+}
+
+// readMemoryFile reads the memory file at path; a missing file is empty.
+func readMemoryFile(path string) (memoryFile, error) {
+	file := memoryFile{Projects: make(map[string][]Remembered)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("failed to read answer memory '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("failed to parse answer memory '%s' (delete it to start over): %w", path, err)
+	}
+	if file.Projects == nil {
+		file.Projects = make(map[string][]Remembered)
+	}
+	return file, nil
+}
+
+// Project returns the project the memory is scoped to.
+func (m *Memory) Project() string {
+	return m.project
+}
+
+// List returns the answers remembered for the project, most recently used first.
+func (m *Memory) List() []Remembered {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := append([]Remembered(nil), m.file.Projects[m.project]...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Used.After(list[j].Used) })
+	return list
+}
+
+// Lookup returns the remembered answer whose question is most similar to
+// question, with its similarity, if any reaches MinSimilarity. Ties go to
+// the most recently used answer.
+func (m *Memory) Lookup(question string) (Remembered, float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var best Remembered
+	bestScore := 0.0
+	for _, r := range m.file.Projects[m.project] {
+		score := QuestionSimilarity(question, r.Question)
+		if score > bestScore || (score == bestScore && r.Used.After(best.Used)) {
+			best, bestScore = r, score
+		}
+	}
+	if bestScore < MinSimilarity {
+		return Remembered{}, 0, false
+	}
+	return best, bestScore, true
+}
+
+// Remember records answer for question, replacing an earlier answer to a
+// question with the same words. Empty answers are not remembered.
+func (m *Memory) Remember(question string, answer string) {
+	if strings.TrimSpace(answer) == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changed = true
+	list := m.file.Projects[m.project]
+	for i := range list {
+		if QuestionSimilarity(list[i].Question, question) == 1 {
+			list[i].Answer, list[i].Used = answer, time.Now().UTC()
+			list[i].Count++
+			return
+		}
+	}
+	m.file.Projects[m.project] = append(list, Remembered{Question: question, Answer: answer, Used: time.Now().UTC(), Count: 1})
+}
+
+// Forget removes every answer remembered for the project and returns how
+// many there were.
+func (m *Memory) Forget() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.file.Projects[m.project])
+	delete(m.file.Projects, m.project)
+	m.changed, m.forgotten = true, true
+	return n
+}
+
+// Save writes the memory back to its file if anything changed. Other runs
+// may have saved answers since the memory was opened, for this project or
+// others, so the file is read again under a lock and only this project's
+// answers are merged into it, keeping the most recently used answer to each
+// question. The file is replaced atomically, so a crash never leaves it
+// truncated.
+func (m *Memory) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.changed {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
+		return fmt.Errorf("failed to create answer memory directory: %w", err)
+	}
+	unlock, err := lockFile(m.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := readMemoryFile(m.path)
+	if err != nil {
+		return err
+	}
+	list := m.file.Projects[m.project]
+	if !m.forgotten {
+		list = mergeRemembered(list, file.Projects[m.project])
+	}
+	if len(list) > 0 {
+		file.Projects[m.project] = list
+	} else {
+		delete(file.Projects, m.project)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Answers can describe private projects, so only the user can read them.
+	if err := writeFileAtomic(m.path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write answer memory '%s': %w", m.path, err)
+	}
+	m.file, m.changed, m.forgotten = file, false, false
+	return nil
+}
+
+// mergeRemembered adds the answers of saved to those of current, keeping the
+// most recently used answer when both hold the same question.
+func mergeRemembered(current []Remembered, saved []Remembered) []Remembered {
+	merged := append([]Remembered(nil), current...)
+	for _, s := range saved {
+		i := slices.IndexFunc(merged, func(r Remembered) bool { return QuestionSimilarity(r.Question, s.Question) == 1 })
+		switch {
+		case i < 0:
+			merged = append(merged, s)
+		case s.Used.After(merged[i].Used):
+			merged[i] = s
+		}
+	}
+	return merged
+}
+
+// Save waits up to lockWait for another run to release the memory; lock
+// files older than staleLock were left by a run that crashed.
+const (
+	lockWait  = 5 * time.Second
+	staleLock = time.Minute
+)
+
+// lockFile creates the lock file at path, waiting while another run holds
+// it, and returns the function that releases it.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to lock answer memory: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("answer memory is locked by another run; if none is running, delete '%s'", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// stopWords are left out when comparing questions, so "What is the target
+// audience?" and "Who is the target audience?" match.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "be": true, "s": true,
+	"what": true, "which": true, "who": true, "whom": true, "how": true, "do": true, "does": true,
+	"you": true, "your": true, "should": true, "would": true, "will": true, "can": true,
+	"of": true, "for": true, "to": true, "in": true, "on": true, "this": true, "that": true, "it": true,
+}
+
+// QuestionSimilarity returns how alike two questions are, from 0 to 1: 1
+// when they are equal once normalized, and otherwise the overlap (Jaccard
+// index) of their words, leaving out common words that do not carry the
+// subject of the question.
+func QuestionSimilarity(a string, b string) float64 {
+	a, b = Normalize(a), Normalize(b)
+	if a == b {
+		return 1
+	}
+	wordsA, wordsB := contentWords(a), contentWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared)
+}
+
+// contentWords returns the set of words of normalized text, without stop words.
+func contentWords(normalized string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		if !stopWords[word] {
+			words[word] = true
+		}
+	}
+	return words
+}
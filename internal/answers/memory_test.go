@@ -0,0 +1,119 @@
+package answers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuestionSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64 // Inclusive
+		max  float64 // Inclusive
+	}{
+		{"What is the target audience?", "what is the target audience", 1, 1},
+		{"What's the target audience?", "What is the target audience?", 1, 1},
+		{"What is the target audience?", "Who is the target audience?", 1, 1},
+		{"What is the target audience?", "Who is the intended audience?", 0.3, 0.4},
+		{"What tone should the email have?", "Which tone should the email use?", 0.5, 0.5},
+		{"What is the target audience?", "How long should the summary be?", 0, 0},
+		{"What is it?", "Who is it?", 0, 0}, // Only stop words
+		{"?", "What is the tone?", 0, 0},
+	}
+	for _, tt := range tests {
+		got := QuestionSimilarity(tt.a, tt.b)
+		if got < tt.min || got > tt.max {
+			t.Errorf("QuestionSimilarity(%q, %q) = %.2f, want between %.2f and %.2f", tt.a, tt.b, got, tt.min, tt.max)
+		}
+		if back := QuestionSimilarity(tt.b, tt.a); back != got {
+			t.Errorf("QuestionSimilarity is not symmetric for %q and %q: %.2f and %.2f", tt.a, tt.b, got, back)
+		}
+	}
+}
+
+func TestMemoryLookup(t *testing.T) {
+	m, err := OpenMemory(filepath.Join(t.TempDir(), "answers.json"), "/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Remember("What is the target audience?", "Backend developers")
+	m.Remember("Which tone should the email use?", "Formal")
+	m.Remember("What is the deadline?", "") // Empty answers are not remembered
+
+	tests := []struct {
+		question string
+		want     string
+		found    bool
+	}{
+		{"Who is the target audience?", "Backend developers", true},
+		{"What tone should the email use?", "Formal", true},
+		{"What tone should the email have?", "", false}, // Below MinSimilarity
+		{"What is the deadline?", "", false},
+		{"How long should it be?", "", false},
+	}
+	for _, tt := range tests {
+		r, _, found := m.Lookup(tt.question)
+		if found != tt.found || r.Answer != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q, %v", tt.question, r.Answer, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestMemorySaveMergesConcurrentRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answers.json")
+	first, err := OpenMemory(path, "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenMemory(path, "/two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := OpenMemory(path, "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.Remember("What is the target audience?", "Developers")
+	second.Remember("What is the tone?", "Casual")
+	same.Remember("What is the output format?", "Markdown")
+	for _, m := range []*Memory{first, second, same} {
+		if err := m.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	one, err := OpenMemory(path, "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(one.List()); got != 2 {
+		t.Errorf("project /one has %d answers after concurrent saves, want 2", got)
+	}
+	two, err := OpenMemory(path, "/two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(two.List()); got != 1 {
+		t.Errorf("project /two has %d answers after concurrent saves, want 1", got)
+	}
+
+	// Forget drops the answers other runs saved for the project too.
+	one.Forget()
+	if err := one.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenMemory(path, "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(reopened.List()); got != 0 {
+		t.Errorf("project /one has %d answers after Forget, want 0", got)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	if _, err := os.Stat(path + ".lock"); err == nil || len(leftovers) > 0 {
+		t.Errorf("Save left a lock or temporary files behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,97 @@
+// Package budget estimates token usage and trims guideline text so that each
+// Gemini request stays within a configurable token budget.
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// charsPerToken is the rough number of characters per token used for estimates.
+// Gemini tokenizes English text at roughly four characters per token, which is
+// accurate enough to keep requests under a budget without a network round trip.
+const charsPerToken = 4
+
+// trimMarker is appended to any section that had to be shortened to fit.
+const trimMarker = "\n[... trimmed to fit token budget]"
+
+// ErrPromptExceedsBudget is returned when the text that cannot be trimmed
+// (the user prompt and the request template) is already larger than the budget.
+var ErrPromptExceedsBudget = errors.New("prompt exceeds token budget")
+
+// EstimateTokens returns an approximate token count for the given text.
+func EstimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	return (n + charsPerToken - 1) / charsPerToken
+}
+
+// Truncate shortens text so that its estimated token count (including the trim
+// marker) does not exceed maxTokens. It cuts at a whitespace boundary when possible.
+// Text that already fits is returned unchanged; an empty string is returned if
+// not even the marker fits.
+func Truncate(text string, maxTokens int) string {
+	if EstimateTokens(text) <= maxTokens {
+		return text
+	}
+	markerTokens := EstimateTokens(trimMarker)
+	if maxTokens <= markerTokens {
+		return ""
+	}
+
+	// Keep as many runes as the remaining budget allows.
+	runes := []rune(text)
+	keep := (maxTokens - markerTokens) * charsPerToken
+	if keep > len(runes) {
+		keep = len(runes)
+	}
+	cut := keep
+	// Back off to the last whitespace so we don't split a word in half.
+	for cut > 0 && !unicode.IsSpace(runes[cut-1]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = keep // A single very long word; cut it anyway.
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + trimMarker
+}
+
+// Fit trims the given sections so that fixed plus all sections fit within limit
+// estimated tokens. fixed is the text that must be sent verbatim (the rendered
+// request template including the user prompt). Sections are listed from most
+// to least expendable: the first section is trimmed first, and later sections
+// are only touched if trimming the earlier ones is not enough.
+// A limit of zero or less disables the budget and returns the sections unchanged.
+func Fit(limit int, fixed string, sections []string) ([]string, error) {
+	if limit <= 0 {
+		return sections, nil
+	}
+
+	fixedTokens := EstimateTokens(fixed)
+	if fixedTokens > limit {
+		return nil, fmt.Errorf("%w: the prompt and request template need ~%d tokens but the budget is %d", ErrPromptExceedsBudget, fixedTokens, limit)
+	}
+
+	// Work out how many tokens the sections use in total.
+	fitted := make([]string, len(sections))
+	copy(fitted, sections)
+	used := 0
+	for _, s := range fitted {
+		used += EstimateTokens(s)
+	}
+	excess := used - (limit - fixedTokens)
+
+	// Trim sections in order until the excess is gone.
+	for i := 0; i < len(fitted) && excess > 0; i++ {
+		before := EstimateTokens(fitted[i])
+		target := before - excess
+		if target < 0 {
+			target = 0
+		}
+		fitted[i] = Truncate(fitted[i], target)
+		excess -= before - EstimateTokens(fitted[i])
+	}
+	return fitted, nil
+}
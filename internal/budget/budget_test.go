@@ -0,0 +1,93 @@
+package budget
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"ñññññ", 2}, // Runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		want      string
+	}{
+		{"fits", "short text", 10, "short text"},
+		{"marker does not fit", long, EstimateTokens(trimMarker), ""},
+		{"cut at a space", long, EstimateTokens(trimMarker) + 3, "word word" + trimMarker},
+		{"one long word", strings.Repeat("x", 100), EstimateTokens(trimMarker) + 2, "xxxxxxxx" + trimMarker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.text, tt.maxTokens)
+			if got != tt.want {
+				t.Errorf("Truncate = %q, want %q", got, tt.want)
+			}
+			if EstimateTokens(got) > tt.maxTokens {
+				t.Errorf("Truncate result uses %d tokens, more than %d", EstimateTokens(got), tt.maxTokens)
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	intro := strings.Repeat("intro ", 100)     // 150 tokens
+	techniques := strings.Repeat("tech ", 100) // 125 tokens
+	fixed := strings.Repeat("f", 40)           // 10 tokens
+
+	tests := []struct {
+		name          string
+		limit         int
+		wantIntro     bool // Whether intro is left whole
+		wantTechnique bool // Whether techniques is left whole
+	}{
+		{"unlimited", 0, true, true},
+		{"everything fits", 1000, true, true},
+		{"trims the first section first", 10 + 125 + 50, false, true},
+		{"trims both when needed", 10 + 60, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fitted, err := Fit(tt.limit, fixed, []string{intro, techniques})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (fitted[0] == intro) != tt.wantIntro || (fitted[1] == techniques) != tt.wantTechnique {
+				t.Errorf("Fit left intro whole = %v and techniques whole = %v, want %v and %v", fitted[0] == intro, fitted[1] == techniques, tt.wantIntro, tt.wantTechnique)
+			}
+			if tt.limit > 0 {
+				total := EstimateTokens(fixed) + EstimateTokens(fitted[0]) + EstimateTokens(fitted[1])
+				if total > tt.limit {
+					t.Errorf("Fit result uses %d tokens, more than the limit %d", total, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestFitPromptExceedsBudget(t *testing.T) {
+	_, err := Fit(5, strings.Repeat("f", 40), []string{"intro"})
+	if !errors.Is(err, ErrPromptExceedsBudget) {
+		t.Errorf("Fit error = %v, want ErrPromptExceedsBudget", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package cache provides an on-disk, content-addressed cache for Gemini responses.
+// Entries are keyed by a hash of everything that influences the response, so a
+// repeated request with the same inputs can be answered without calling the API.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// pruneEvery is how many writes pass between evictions, so a busy batch
+// does not walk the whole directory after every response.
+const pruneEvery = 64
+
+// staleTemp is how old a temporary file must be before Prune removes it.
+// Put renames its temporary file away within moments, so an older one was
+// left behind by a process that died mid-write.
+const staleTemp = 10 * time.Minute
+
+// entry is the on-disk representation of a cached response.
+type entry struct {
+	Created time.Time `json:"created"`
+	Value   string    `json:"value"`
+}
+
+// Cache stores responses as JSON files under a directory.
+type Cache struct {
+	dir      string
+	ttl      time.Duration // Entries older than this are ignored (0 = never expire)
+	maxBytes int64         // Oldest entries are evicted above this size (0 = unlimited)
+	writes   atomic.Int64  // Puts since the cache was opened
+	logger   *slog.Logger
+}
+
+// Stats summarizes the contents of the cache directory.
+type Stats struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Expired int    `json:"expired"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// DefaultDir returns the default cache directory under the user's cache directory.
+func DefaultDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(base, "tokinfo"), nil
+}
+
+// New returns a cache rooted at dir. The directory is created if needed.
+// Failed evictions during Put are logged to logger; a nil logger discards them.
+func New(dir string, ttl time.Duration, maxBytes int64, logger *slog.Logger) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory '%s': %w", dir, err)
+	}
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	return &Cache{dir: dir, ttl: ttl, maxBytes: maxBytes, logger: logger}, nil
+}
+
+// Key hashes the given parts into a cache key. Each part is length-prefixed
+// so that different splits of the same bytes produce different keys.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:%s;", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// path returns the file path for key, sharded by its first two characters.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// Get returns the cached value for key. The boolean is false on a miss or
+// when the entry has expired.
+func (c *Cache) Get(key string) (string, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		// A corrupt entry is treated as a miss; it will be overwritten.
+		return "", false, nil
+	}
+	if c.expired(e.Created) {
+		return "", false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Put stores value under key. Every few writes, expired entries and the
+// oldest entries above the size limit are evicted; see Prune. The entry is
+// stored even if eviction fails, so that failure is only logged.
+func (c *Cache) Put(key string, value string) error {
+	data, err := json.Marshal(entry{Created: time.Now(), Value: value})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// Write to a temporary file of its own first, so concurrent readers never
+	// see a partial entry and concurrent writers of the same key do not mix.
+	tmp, err := os.CreateTemp(filepath.Dir(p), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if c.writes.Add(1)%pruneEvery == 0 {
+		if err := c.Prune(); err != nil {
+			c.logger.Warn("could not prune response cache", "error", err)
+		}
+	}
+	return nil
+}
+
+// Clear removes every entry and returns how many were deleted.
+func (c *Cache) Clear() (int, error) {
+	files, err := c.files()
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to remove cache entry '%s': %w", f.path, err)
+		}
+	}
+	return len(files), nil
+}
+
+// Stats reports how many entries the cache holds and how much space they use.
+func (c *Cache) Stats() (Stats, error) {
+	files, err := c.files()
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{Dir: c.dir, Entries: len(files)}
+	for _, f := range files {
+		stats.Bytes += f.size
+		if c.expired(f.modTime) {
+			stats.Expired++
+		}
+	}
+	return stats, nil
+}
+
+// expired reports whether an entry created at created is past the TTL.
+func (c *Cache) expired(created time.Time) bool {
+	return c.ttl > 0 && time.Since(created) > c.ttl
+}
+
+// file describes one entry on disk.
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists every cache entry on disk, oldest first.
+func (c *Cache) files() ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, file{path: p, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache directory '%s': %w", c.dir, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files, nil
+}
+
+// Prune removes expired entries, then the oldest entries until the cache
+// fits its size limit, and temporary files left behind by interrupted
+// writes. It walks the whole directory, so it runs when a session opens
+// the cache and every few writes rather than on each Put.
+func (c *Cache) Prune() error {
+	temps, err := filepath.Glob(filepath.Join(c.dir, "*", "*.tmp"))
+	if err != nil {
+		return fmt.Errorf("failed to list cache directory '%s': %w", c.dir, err)
+	}
+	for _, p := range temps {
+		info, err := os.Stat(p)
+		if err != nil || time.Since(info.ModTime()) < staleTemp {
+			continue // Renamed away meanwhile, or still being written
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove temporary cache file '%s': %w", p, err)
+		}
+	}
+
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for _, f := range files {
+		if !c.expired(f.modTime) && (c.maxBytes <= 0 || total <= c.maxBytes) {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to evict cache entry '%s': %w", f.path, err)
+		}
+		total -= f.size
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPutConcurrentSameKey(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key("model", "prompt")
+	values := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := range 16 {
+		value := fmt.Sprintf("response %d %0500d", i, i)
+		values[value] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Put(key, value); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, ok, err := c.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("Get = %q, %v, %v; want a hit", got, ok, err)
+	}
+	if !values[got] {
+		t.Errorf("Get returned a value no writer put: %q", got)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(c.dir, key[:2], "*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(Key("a"), "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(Key("a")); !ok {
+		t.Fatal("entry evicted before Prune")
+	}
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.path(Key("a"))); !os.IsNotExist(err) {
+		t.Errorf("entry above the size limit was not evicted: %v", err)
+	}
+}
+
+func TestPruneStaleTemporaryFiles(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard := filepath.Join(c.dir, "ab")
+	if err := os.MkdirAll(shard, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(shard, "stale.123.tmp")
+	fresh := filepath.Join(shard, "fresh.456.tmp")
+	for _, p := range []string{stale, fresh} {
+		if err := os.WriteFile(p, []byte("{"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTemp)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file was not removed: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("temporary file still being written was removed: %v", err)
+	}
+}
@@ -2,9 +2,13 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 )
 
 // Technique defines the structure for a single prompt engineering technique.
@@ -22,7 +26,7 @@ type Guidelines struct {
 
 // LoadGuidelines reads the specified JSON file and parses it into a Guidelines struct.
 // It returns the populated struct or an error if reading/parsing fails.
-func LoadGuidelines(filePath string, verbose bool) (*Guidelines, error) {
+func LoadGuidelines(filePath string, logger *slog.Logger) (*Guidelines, error) {
 	// Implementation details:
 	// 1. Use os.ReadFile to read the file content.
 	// 2. Use json.Unmarshal to parse the content into the Guidelines struct.
@@ -45,9 +49,7 @@ func LoadGuidelines(filePath string, verbose bool) (*Guidelines, error) {
 		return nil, fmt.Errorf("guidelines file '%s' is missing introduction or techniques", filePath)
 	}
 
-	if verbose {
-		fmt.Printf("Successfully loaded guidelines from '%s'\n", filePath)
-	}
+	logger.Info("loaded guidelines", "path", filePath, "techniques", len(guidelines.Techniques))
 	return &guidelines, nil
 }
 
@@ -61,3 +63,25 @@ func GetTechniqueByName(techniques []Technique, name string) (*Technique, bool)
 	}
 	return nil, false
 }
+
+// SummarizedTechniques lists every technique with its summary, one per line,
+// in the form sent to the analysis stage.
+func (g *Guidelines) SummarizedTechniques() string {
+	var summarized strings.Builder
+	for _, tech := range g.Techniques {
+		fmt.Fprintf(&summarized, "- %s: %s\n", tech.Name, tech.Summarized)
+	}
+	return summarized.String()
+}
+
+// Hash returns a stable SHA-256 hash of the guidelines content.
+// It changes whenever the introduction or any technique is edited.
+func (g *Guidelines) Hash() string {
+	data, err := json.Marshal(g)
+	if err != nil {
+		// Marshaling plain strings cannot fail; keep the signature simple.
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
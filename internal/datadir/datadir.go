@@ -0,0 +1,23 @@
+// Package datadir locates the files tokinfo keeps in the user's data
+// directory, such as the history and the answer memory.
+package datadir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// File returns the path of name under $XDG_DATA_HOME/tokinfo, or
+// ~/.local/share/tokinfo when XDG_DATA_HOME is not set.
+func File(name string) (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate home directory: %w", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "tokinfo", name), nil
+}
@@ -0,0 +1,181 @@
+// Package diff computes word-level differences between the original prompt
+// and the enhanced prompt.
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Op is the kind of change an Edit represents.
+type Op int
+
+const (
+	Equal  Op = iota // Text present in both versions
+	Insert           // Text only in the new version
+	Delete           // Text only in the old version
+)
+
+// Edit is a run of text with the same Op.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Words returns the edits that turn a into b, comparing word by word.
+// Whitespace runs are kept as their own tokens so the edits can be
+// concatenated back into either text.
+func Words(a string, b string) []Edit {
+	return merge(tokens(Tokenize(a), Tokenize(b)))
+}
+
+// Tokenize splits text into alternating word and whitespace tokens.
+func Tokenize(text string) []string {
+	var tokens []string
+	start := 0
+	inSpace := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if i > start && space != inSpace {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+// tokens diffs two token slices with Myers' O(ND) algorithm and returns one
+// edit per token.
+func tokens(a []string, b []string) []Edit {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit == 0 {
+		return nil
+	}
+
+	// v[k+offset] is the furthest x reached on diagonal k. trace[d] keeps the
+	// diagonals -d-1..d+1 of v as they were before step d, which is all the
+	// backtracking needs, so memory grows with the edit distance only.
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset] // Move down: insertion from b
+			} else {
+				x = v[k-1+offset] + 1 // Move right: deletion from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return nil // Unreachable: d = n+m always reaches the end
+}
+
+// backtrack walks the saved traces from the end to recover the edit script.
+func backtrack(trace [][]int, a []string, b []string) []Edit {
+	x, y := len(a), len(b)
+	var edits []Edit
+	for d := len(trace) - 1; d >= 0; d-- {
+		// at returns the furthest x on diagonal k before step d.
+		at := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, Edit{Op: Equal, Text: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, Edit{Op: Insert, Text: b[y]})
+			} else {
+				x--
+				edits = append(edits, Edit{Op: Delete, Text: a[x]})
+			}
+		}
+	}
+	// Edits were collected from the end; reverse them.
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// merge joins adjacent edits with the same Op.
+func merge(edits []Edit) []Edit {
+	var merged []Edit
+	for _, e := range edits {
+		if len(merged) > 0 && merged[len(merged)-1].Op == e.Op {
+			merged[len(merged)-1].Text += e.Text
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+// Changed reports whether the edits contain any insertion or deletion.
+func Changed(edits []Edit) bool {
+	for _, e := range edits {
+		if e.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats counts the words inserted and deleted by the edits.
+func Stats(edits []Edit) (inserted int, deleted int) {
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			inserted += len(strings.Fields(e.Text))
+		case Delete:
+			deleted += len(strings.Fields(e.Text))
+		}
+	}
+	return inserted, deleted
+}
+
+// Lines returns the edits that turn a into b, comparing line by line.
+// Unlike Words, every Edit holds exactly one line, including its newline.
+func Lines(a string, b string) []Edit {
+	return tokens(splitLines(a), splitLines(b))
+}
+
+// splitLines splits text into lines that keep their trailing newline.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
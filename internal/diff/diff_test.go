@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// join rebuilds the old or new text from edits.
+func join(edits []Edit, skip Op) string {
+	var b strings.Builder
+	for _, e := range edits {
+		if e.Op != skip {
+			b.WriteString(e.Text)
+		}
+	}
+	return b.String()
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"one", []string{"one"}},
+		{"one two", []string{"one", " ", "two"}},
+		{"  lead\n\ntrail ", []string{"  ", "lead", "\n\n", "trail", " "}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Edit
+	}{
+		{"equal", "same text", "same text", []Edit{{Equal, "same text"}}},
+		{"both empty", "", "", nil},
+		{"insert", "write a poem", "write a short poem", []Edit{{Equal, "write a "}, {Insert, "short "}, {Equal, "poem"}}},
+		{"delete", "write a short poem", "write a poem", []Edit{{Equal, "write a "}, {Delete, "short "}, {Equal, "poem"}}},
+		{"replace", "be brief", "be thorough", []Edit{{Equal, "be "}, {Delete, "brief"}, {Insert, "thorough"}}},
+		{"from empty", "", "new", []Edit{{Insert, "new"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Words(tt.a, tt.b)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Words(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if join(got, Insert) != tt.a || join(got, Delete) != tt.b {
+				t.Errorf("edits do not rebuild both texts: %v", got)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	inserted, deleted := Stats(Words("write a poem about cats", "write a short poem about dogs"))
+	if inserted != 2 || deleted != 1 {
+		t.Errorf("Stats = %d inserted, %d deleted; want 2 and 1", inserted, deleted)
+	}
+}
+
+func TestWriteWords(t *testing.T) {
+	var b strings.Builder
+	if err := WriteWords(&b, Words("be brief", "be thorough"), false); err != nil {
+		t.Fatal(err)
+	}
+	if want := "be [-brief-]{+thorough+}\n"; b.String() != want {
+		t.Errorf("WriteWords = %q, want %q", b.String(), want)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 3, ""},
+		{
+			"change with context", "a\nb\nc\nd\n", "a\nB\nc\nd\n", 1,
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n", "1\nX\n3\n4\n5\n6\nY\n8\n", 1,
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n 1\n-2\n+X\n 3\n@@ -6,3 +6,3 @@\n 6\n-7\n+Y\n 8\n",
+		},
+		{
+			"insert into empty", "", "new\n", 3,
+			"--- old\n+++ new\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			"no newline at end", "a\n", "a\nb", 3,
+			"--- old\n+++ new\n@@ -1,1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.a, tt.b, tt.context, false); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ANSI colors used when rendering diffs for a terminal.
+const (
+	colorReset  = "\x1b[0m"
+	colorInsert = "\x1b[32m"
+	colorDelete = "\x1b[31m"
+	colorHunk   = "\x1b[36m"
+)
+
+// WriteWords writes word edits to w. With color, insertions are green and
+// deletions red; without color they are marked {+like this+} and [-like this-],
+// as git's --word-diff does.
+func WriteWords(w io.Writer, edits []Edit, color bool) error {
+	var b strings.Builder
+	for _, e := range edits {
+		switch {
+		case e.Op == Equal:
+			b.WriteString(e.Text)
+		case color && e.Op == Insert:
+			b.WriteString(colorInsert + e.Text + colorReset)
+		case color && e.Op == Delete:
+			b.WriteString(colorDelete + e.Text + colorReset)
+		case e.Op == Insert:
+			b.WriteString("{+" + e.Text + "+}")
+		case e.Op == Delete:
+			b.WriteString("[-" + e.Text + "-]")
+		}
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	return nil
+}
+
+// Unified returns a unified diff of a and b with context lines around each
+// change, labeled with fromName and toName. It returns "" if the texts are equal.
+func Unified(fromName string, toName string, a string, b string, context int, color bool) string {
+	edits := Lines(a, b)
+	if !Changed(edits) {
+		return ""
+	}
+
+	paint := func(c string, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	var out strings.Builder
+	out.WriteString(paint(colorDelete, "--- "+fromName) + "\n")
+	out.WriteString(paint(colorInsert, "+++ "+toName) + "\n")
+
+	// Walk the edits, opening a hunk at each change and closing it once
+	// more than 2*context unchanged lines follow.
+	for start := 0; start < len(edits); {
+		if edits[start].Op == Equal {
+			start++
+			continue
+		}
+		first := max(0, start-context)
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].Op != Equal {
+				end = i
+				continue
+			}
+			if i-end > 2*context {
+				break
+			}
+		}
+		last := min(len(edits), end+context+1)
+		writeHunk(&out, edits, first, last, paint)
+		start = last
+	}
+	return out.String()
+}
+
+// writeHunk writes edits[first:last] as one hunk with its @@ header.
+func writeHunk(out *strings.Builder, edits []Edit, first int, last int, paint func(string, string) string) {
+	// Line numbers are 1-based positions in a and b at the start of the hunk.
+	aLine, bLine := 1, 1
+	for _, e := range edits[:first] {
+		if e.Op != Insert {
+			aLine++
+		}
+		if e.Op != Delete {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	var body strings.Builder
+	for _, e := range edits[first:last] {
+		text := e.Text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n\\ No newline at end of file\n"
+		}
+		switch e.Op {
+		case Equal:
+			aCount++
+			bCount++
+			body.WriteString(" " + text)
+		case Delete:
+			aCount++
+			body.WriteString(paint(colorDelete, "-"+strings.TrimSuffix(text, "\n")) + "\n")
+		case Insert:
+			bCount++
+			body.WriteString(paint(colorInsert, "+"+strings.TrimSuffix(text, "\n")) + "\n")
+		}
+	}
+	// An empty range starts at the line before it, as in GNU diff.
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+	out.WriteString(paint(colorHunk, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount)) + "\n")
+	out.WriteString(body.String())
+}
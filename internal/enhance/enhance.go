@@ -0,0 +1,181 @@
+// Package enhance runs the two-stage enhancement pipeline: analysis, answers
+// to the clarifying questions, and refinement. The commands and the servers
+// that expose it to other tools all run prompts through it.
+package enhance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	answers "tokinfo/internal/answers"
+	config "tokinfo/internal/config"
+	gemini "tokinfo/internal/gemini"
+)
+
+// ErrUnknownTechnique is returned when a technique is not in the guidelines.
+var ErrUnknownTechnique = errors.New("technique not found in guidelines")
+
+// Result is the outcome of enhancing one prompt.
+type Result struct {
+	Technique      string             `json:"technique"`
+	Rationale      string             `json:"rationale"`
+	Questions      []answers.Question `json:"questions"`
+	EnhancedPrompt string             `json:"enhancedPrompt"`
+}
+
+// Enhancer analyzes and refines prompts with a Gemini client and guidelines.
+// It is safe for concurrent use.
+type Enhancer struct {
+	client     *gemini.Client
+	guidelines *config.Guidelines
+}
+
+// New returns an enhancer using client and guidelines.
+func New(client *gemini.Client, guidelines *config.Guidelines) *Enhancer {
+	return &Enhancer{client: client, guidelines: guidelines}
+}
+
+// Guidelines returns the guidelines prompts are enhanced with.
+func (e *Enhancer) Guidelines() *config.Guidelines {
+	return e.guidelines
+}
+
+// Answering says how clarifying questions are answered. The zero value
+// gives every question the model's example answer.
+type Answering struct {
+	// Provided are answers given ahead of time, keyed like an answers file:
+	// by question text, a fragment of it, or the 1-based question number.
+	// They always take precedence.
+	Provided *answers.Set
+	// Memory, if set, offers the answers given earlier to similar questions
+	// and remembers the answers of this run. The caller saves it.
+	Memory *answers.Memory
+	// Ask, if set, asks the user the questions nothing else answered.
+	// remembered is the recalled answer, if any, offered as the default.
+	Ask func(index int, question gemini.ClarifyingQuestion, remembered string) (string, error)
+	// Unanswered is "example" (or empty) to use the model's example answer
+	// for questions that are not asked, or "skip" to leave them out.
+	Unanswered string
+	// Logger receives the answers; nil discards them.
+	Logger *slog.Logger
+}
+
+// ValidUnanswered reports whether unanswered is a policy Complete accepts:
+// "example" (or empty) to use the model's example answers, or "skip".
+func ValidUnanswered(unanswered string) bool {
+	return unanswered == "" || unanswered == "example" || unanswered == "skip"
+}
+
+// Analyze runs Stage 1 on prompt. ClarifyingQuestions is never nil.
+func (e *Enhancer) Analyze(ctx context.Context, prompt string) (*gemini.AnalysisResult, error) {
+	analysis, err := e.client.AnalyzePrompt(ctx, e.guidelines.Introduction, e.guidelines.SummarizedTechniques(), prompt)
+	if err != nil {
+		return nil, fmt.Errorf("stage 1 Gemini call failed: %w", err)
+	}
+	if analysis.ClarifyingQuestions == nil {
+		analysis.ClarifyingQuestions = []gemini.ClarifyingQuestion{} // Encode as [] rather than null
+	}
+	return analysis, nil
+}
+
+// Refine runs Stage 2 on prompt with the named technique. Answers map the
+// question text to its answer.
+func (e *Enhancer) Refine(ctx context.Context, prompt string, technique string, answers map[string]string) (string, error) {
+	tech, found := config.GetTechniqueByName(e.guidelines.Techniques, technique)
+	if !found {
+		return "", fmt.Errorf("%w: '%s'", ErrUnknownTechnique, technique)
+	}
+	enhanced, err := e.client.RefinePrompt(ctx, e.guidelines.Introduction, tech.Complete, prompt, answers)
+	if err != nil {
+		return "", fmt.Errorf("stage 2 Gemini call failed: %w", err)
+	}
+	return enhanced, nil
+}
+
+// Answer answers each clarifying question in order: with a provided answer,
+// then, when not asking, with a remembered one, and otherwise by asking or
+// falling back to the unanswered policy. An empty line typed at Ask accepts
+// the remembered answer. Answers that were provided, typed or remembered are
+// remembered in the memory.
+func Answer(questions []gemini.ClarifyingQuestion, a Answering) []answers.Question {
+	logger := a.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	answered := []answers.Question{}
+	for i, question := range questions {
+		q := answers.Question{Question: question.Question, ExampleAnswer: question.ExampleAnswer}
+		// An answer given earlier to a similar question replaces the example,
+		// and is offered as the default when asking.
+		var remembered answers.Remembered
+		recalled := false
+		if a.Memory != nil {
+			var similarity float64
+			if remembered, similarity, recalled = a.Memory.Lookup(question.Question); recalled {
+				logger.Debug("recalled answer", "index", i+1, "question", question.Question, "rememberedQuestion", remembered.Question, "similarity", similarity)
+			}
+		}
+		switch answer, ok := a.Provided.Lookup(i+1, question.Question); {
+		case ok:
+			q.Answer, q.Source = answer, "provided"
+		case a.Ask == nil && recalled:
+			q.Answer, q.Source = remembered.Answer, "remembered"
+		case a.Ask == nil && a.Unanswered == "skip":
+			q.Source = "skipped"
+			logger.Warn("no answer provided; skipping question", "index", i+1, "question", question.Question)
+		case a.Ask == nil:
+			q.Answer, q.Source = question.ExampleAnswer, "example"
+		default:
+			answer, err := a.Ask(i, question, remembered.Answer)
+			if err != nil {
+				logger.Warn("could not read answer; skipping question", "index", i+1, "question", question.Question, "error", err)
+				q.Source = "skipped"
+				break
+			}
+			q.Answer, q.Source = answer, "interactive"
+			if q.Answer == "" && recalled {
+				q.Answer, q.Source = remembered.Answer, "remembered"
+			}
+		}
+		if q.Source != "skipped" {
+			logger.Info("answered question", "index", i+1, "question", question.Question, "answer", q.Answer, "source", q.Source)
+		}
+		if a.Memory != nil && (q.Source == "provided" || q.Source == "interactive" || q.Source == "remembered") {
+			a.Memory.Remember(question.Question, q.Answer)
+		}
+		answered = append(answered, q)
+	}
+	return answered
+}
+
+// Complete answers the questions of analysis and runs Stage 2; see Answer.
+func (e *Enhancer) Complete(ctx context.Context, prompt string, analysis *gemini.AnalysisResult, a Answering) (*Result, error) {
+	if !ValidUnanswered(a.Unanswered) {
+		return nil, fmt.Errorf("unknown unanswered value '%s' (expected example or skip)", a.Unanswered)
+	}
+	result := &Result{
+		Technique: analysis.ChosenTechniqueName,
+		Rationale: analysis.Rationale,
+		Questions: Answer(analysis.ClarifyingQuestions, a),
+	}
+	enhanced, err := e.Refine(ctx, prompt, analysis.ChosenTechniqueName, answers.Map(result.Questions))
+	if err != nil {
+		return nil, err
+	}
+	result.EnhancedPrompt = enhanced
+	return result, nil
+}
+
+// Enhance runs the whole pipeline on prompt; see Answer for the answers.
+func (e *Enhancer) Enhance(ctx context.Context, prompt string, a Answering) (*Result, error) {
+	if !ValidUnanswered(a.Unanswered) {
+		return nil, fmt.Errorf("unknown unanswered value '%s' (expected example or skip)", a.Unanswered)
+	}
+	analysis, err := e.Analyze(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return e.Complete(ctx, prompt, analysis, a)
+}
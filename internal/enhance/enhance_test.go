@@ -0,0 +1,91 @@
+package enhance
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	answers "tokinfo/internal/answers"
+	gemini "tokinfo/internal/gemini"
+)
+
+func TestAnswer(t *testing.T) {
+	questions := []gemini.ClarifyingQuestion{
+		{Question: "Who is the target audience?", ExampleAnswer: "developers"},
+		{Question: "What tone should it use?", ExampleAnswer: "formal"},
+	}
+	// ask answers with the given lines, in order; an error line fails.
+	ask := func(lines ...string) func(int, gemini.ClarifyingQuestion, string) (string, error) {
+		return func(index int, _ gemini.ClarifyingQuestion, _ string) (string, error) {
+			if lines[index] == "error" {
+				return "", errors.New("end of input")
+			}
+			return lines[index], nil
+		}
+	}
+	type answer struct{ answer, source string }
+	tests := []struct {
+		name       string
+		provided   map[string]string
+		remembered map[string]string
+		ask        func(int, gemini.ClarifyingQuestion, string) (string, error)
+		unanswered string
+		want       []answer
+	}{
+		{"examples", nil, nil, nil, "", []answer{{"developers", "example"}, {"formal", "example"}}},
+		{"skip", nil, nil, nil, "skip", []answer{{"", "skipped"}, {"", "skipped"}}},
+		{"provided", map[string]string{"tone": "casual"}, nil, nil, "", []answer{{"developers", "example"}, {"casual", "provided"}}},
+		{"remembered", nil, map[string]string{"What is the target audience?": "students"}, nil, "skip", []answer{{"students", "remembered"}, {"", "skipped"}}},
+		{"provided wins over remembered", map[string]string{"1": "admins"}, map[string]string{"What is the target audience?": "students"}, nil, "", []answer{{"admins", "provided"}, {"formal", "example"}}},
+		{"asked", map[string]string{"2": "casual"}, nil, ask("testers", ""), "", []answer{{"testers", "interactive"}, {"casual", "provided"}}},
+		{"empty line accepts remembered", nil, map[string]string{"What is the target audience?": "students"}, ask("", ""), "", []answer{{"students", "remembered"}, {"", "interactive"}}},
+		{"read error skips", nil, nil, ask("error", "casual"), "", []answer{{"", "skipped"}, {"casual", "interactive"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory, err := answers.OpenMemory(filepath.Join(t.TempDir(), "answers.json"), "project")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for question, answer := range tt.remembered {
+				memory.Remember(question, answer)
+			}
+			got := Answer(questions, Answering{Provided: answers.FromMap(tt.provided), Memory: memory, Ask: tt.ask, Unanswered: tt.unanswered})
+			if len(got) != len(tt.want) {
+				t.Fatalf("Answer returned %d questions, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got[i].Answer != want.answer || got[i].Source != want.source {
+					t.Errorf("question %d = %q (%s), want %q (%s)", i+1, got[i].Answer, got[i].Source, want.answer, want.source)
+				}
+				if got[i].Question != questions[i].Question || got[i].ExampleAnswer != questions[i].ExampleAnswer {
+					t.Errorf("question %d = %q, %q; want the analysis question", i+1, got[i].Question, got[i].ExampleAnswer)
+				}
+			}
+		})
+	}
+}
+
+func TestAnswerRemembers(t *testing.T) {
+	memory, err := answers.OpenMemory(filepath.Join(t.TempDir(), "answers.json"), "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	questions := []gemini.ClarifyingQuestion{
+		{Question: "Who is the target audience?", ExampleAnswer: "developers"},
+		{Question: "What tone should it use?", ExampleAnswer: "formal"},
+	}
+	Answer(questions, Answering{Provided: answers.FromMap(map[string]string{"audience": "students"}), Memory: memory})
+
+	// Provided answers are remembered; example answers are not.
+	list := memory.List()
+	if len(list) != 1 || list[0].Question != questions[0].Question || list[0].Answer != "students" {
+		t.Errorf("remembered %+v, want only the provided answer", list)
+	}
+}
+
+func TestAnswerNoQuestions(t *testing.T) {
+	if got := Answer(nil, Answering{}); got == nil || len(got) != 0 {
+		t.Errorf("Answer(nil) = %#v, want an empty slice", got)
+	}
+}
@@ -0,0 +1,307 @@
+// Package eval runs prompt evaluation suites: each case's prompt template is
+// enhanced, then the original and enhanced prompts are rendered with the
+// case's inputs, run against a target model and their responses checked
+// with assertions, so the pass rates of both can be compared.
+package eval
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	answers "tokinfo/internal/answers"
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+	judge "tokinfo/internal/judge"
+)
+
+// Runner runs suites with a Gemini client.
+type Runner struct {
+	enhancer *enhance.Enhancer
+	client   *gemini.Client
+	judge    *judge.Judge
+	logger   *slog.Logger
+}
+
+// NewRunner returns a runner that enhances prompts with enhancer, runs them
+// with client and checks the judge assertions with j.
+func NewRunner(enhancer *enhance.Enhancer, client *gemini.Client, j *judge.Judge, logger *slog.Logger) *Runner {
+	return &Runner{enhancer: enhancer, client: client, judge: j, logger: logger}
+}
+
+// Report is the outcome of running a suite.
+type Report struct {
+	Model    string       `json:"model"`
+	Cases    []CaseResult `json:"cases"`
+	Original Summary      `json:"original"`
+	Enhanced Summary      `json:"enhanced"`
+	Errors   int          `json:"errors"` // Cases whose template could not be enhanced
+}
+
+// Summary counts the assertions and runs that passed for one prompt variant.
+type Summary struct {
+	Assertions int     `json:"assertions"`
+	Passed     int     `json:"passed"`
+	Runs       int     `json:"runs"`
+	RunsPassed int     `json:"runsPassed"` // Runs where every assertion passed
+	PassRate   float64 `json:"passRate"`   // Passed / Assertions
+}
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	Name           string `json:"name"`
+	Technique      string `json:"technique,omitempty"`
+	EnhancedPrompt string `json:"enhancedPrompt,omitempty"`
+	// Scores are the judge's scores of the enhanced template against the
+	// original; they are left out if the judge call failed.
+	Scores *judge.Result `json:"scores,omitempty"`
+	Runs   []RunResult   `json:"runs"`
+	// Error is set when the template could not be enhanced; the case then
+	// has no runs.
+	Error string `json:"error,omitempty"`
+}
+
+// RunResult is the outcome of one set of inputs for both variants.
+type RunResult struct {
+	Inputs   map[string]any `json:"inputs,omitempty"`
+	Original Outcome        `json:"original"`
+	Enhanced Outcome        `json:"enhanced"`
+}
+
+// Outcome is the response of one rendered prompt and its checks.
+type Outcome struct {
+	Prompt     string            `json:"prompt"`
+	Response   string            `json:"response"`
+	Assertions []AssertionResult `json:"assertions"`
+	// Error is set when the prompt could not be rendered or the target
+	// model could not be called; every assertion then fails.
+	Error string `json:"error,omitempty"`
+}
+
+// AssertionResult is the outcome of one assertion.
+type AssertionResult struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Pass        bool   `json:"pass"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// Run runs every case of suite against its target model, or model if not
+// empty. Failed API calls are recorded in the report; only a cancelled
+// context stops the run.
+func (r *Runner) Run(ctx context.Context, suite *Suite, model string) (*Report, error) {
+	if model == "" {
+		model = suite.Model
+	}
+	if model == "" {
+		model = gemini.Model
+	}
+	report := &Report{Model: model, Cases: []CaseResult{}}
+	for _, c := range suite.Cases {
+		result, err := r.runCase(ctx, suite, c, model)
+		if err != nil {
+			return nil, err
+		}
+		report.Cases = append(report.Cases, result)
+	}
+
+	for _, c := range report.Cases {
+		if c.Error != "" {
+			report.Errors++
+		}
+		for _, run := range c.Runs {
+			report.Original.add(run.Original)
+			report.Enhanced.add(run.Enhanced)
+		}
+	}
+	report.Original.finish()
+	report.Enhanced.finish()
+	return report, nil
+}
+
+// runCase enhances the case's template and runs both variants with every set of inputs.
+func (r *Runner) runCase(ctx context.Context, suite *Suite, c Case, model string) (CaseResult, error) {
+	result := CaseResult{Name: c.Name, Runs: []RunResult{}}
+	r.logger.Info("enhancing case template", "case", c.Name)
+	enhanced, err := r.enhancer.Enhance(ctx, c.Prompt, enhance.Answering{Provided: answers.FromMap(suite.Answers), Unanswered: suite.Unanswered})
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Technique = enhanced.Technique
+	result.EnhancedPrompt = enhanced.EnhancedPrompt
+	input := judge.PromptInput{Original: c.Prompt, Enhanced: enhanced.EnhancedPrompt, Technique: enhanced.Technique}
+	if result.Scores, err = r.judge.ScorePrompt(ctx, input, nil); err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		r.logger.Warn("could not score enhanced template", "case", c.Name, "error", err)
+	}
+
+	inputSets := c.Inputs
+	if len(inputSets) == 0 {
+		inputSets = []map[string]any{nil}
+	}
+	for _, inputs := range inputSets {
+		run := RunResult{Inputs: inputs}
+		// The suite was validated, so the original template renders.
+		original, _ := Render(c.Prompt, inputs)
+		if run.Original, err = r.runPrompt(ctx, c, model, original); err != nil {
+			return result, err
+		}
+		// An enhanced template that invented variables has no inputs for
+		// them, so it is not run; its outcome records why.
+		rendered, err := Render(enhanced.EnhancedPrompt, inputs)
+		if err != nil {
+			run.Enhanced = failedOutcome(c, enhanced.EnhancedPrompt, fmt.Errorf("failed to render enhanced template: %w", err))
+		} else if run.Enhanced, err = r.runPrompt(ctx, c, model, rendered); err != nil {
+			return result, err
+		}
+		result.Runs = append(result.Runs, run)
+	}
+	return result, nil
+}
+
+// failedOutcome is the outcome of a prompt that could not be sent: every
+// assertion fails.
+func failedOutcome(c Case, prompt string, err error) Outcome {
+	outcome := Outcome{Prompt: prompt, Error: err.Error(), Assertions: []AssertionResult{}}
+	for i := range c.Assert {
+		a := &c.Assert[i]
+		outcome.Assertions = append(outcome.Assertions, AssertionResult{Type: a.Type(), Description: a.String(), Detail: "no response"})
+	}
+	return outcome
+}
+
+// runPrompt sends prompt to the target model and checks the response.
+func (r *Runner) runPrompt(ctx context.Context, c Case, model string, prompt string) (Outcome, error) {
+	outcome := Outcome{Prompt: prompt, Assertions: []AssertionResult{}}
+	response, err := r.client.Generate(ctx, model, prompt)
+	if err != nil {
+		if ctx.Err() != nil {
+			return outcome, ctx.Err()
+		}
+		outcome.Error = err.Error()
+	}
+	outcome.Response = response
+	for i := range c.Assert {
+		a := &c.Assert[i]
+		result := AssertionResult{Type: a.Type(), Description: a.String()}
+		if outcome.Error != "" {
+			result.Detail = "no response"
+		} else if result.Pass, result.Detail, err = r.check(ctx, a, prompt, response); err != nil {
+			return outcome, err
+		}
+		outcome.Assertions = append(outcome.Assertions, result)
+	}
+	return outcome, nil
+}
+
+// check evaluates one assertion on response. Only a cancelled context is
+// returned as an error; a failed judge call fails the assertion.
+func (r *Runner) check(ctx context.Context, a *Assertion, prompt string, response string) (bool, string, error) {
+	switch a.Type() {
+	case "contains":
+		return strings.Contains(strings.ToLower(response), strings.ToLower(a.Contains)), "", nil
+	case "not-contains":
+		return !strings.Contains(strings.ToLower(response), strings.ToLower(a.NotContains)), "", nil
+	case "regex":
+		return a.regex.MatchString(response), "", nil
+	case "json-schema":
+		violations := validateJSON(response, a.JSONSchema)
+		return len(violations) == 0, strings.Join(violations, "; "), nil
+	default:
+		scores, err := r.judge.ScoreResponse(ctx, prompt, response, []judge.Criterion{{Name: "rubric", Description: a.Judge}})
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, "", ctx.Err()
+			}
+			return false, fmt.Sprintf("judge call failed: %v", err), nil
+		}
+		score := scores.Scores[0]
+		return score.Score >= a.minScore(), fmt.Sprintf("score %d/%d: %s", score.Score, judge.MaxScore, score.Justification), nil
+	}
+}
+
+// add counts outcome in the summary.
+func (s *Summary) add(outcome Outcome) {
+	s.Runs++
+	passed := 0
+	for _, a := range outcome.Assertions {
+		if a.Pass {
+			passed++
+		}
+	}
+	s.Assertions += len(outcome.Assertions)
+	s.Passed += passed
+	if outcome.Error == "" && passed == len(outcome.Assertions) {
+		s.RunsPassed++
+	}
+}
+
+// finish computes the pass rate.
+func (s *Summary) finish() {
+	if s.Assertions > 0 {
+		s.PassRate = float64(s.Passed) / float64(s.Assertions)
+	}
+}
+
+// WriteText prints the results of every assertion and the pass rates to w.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, c := range r.Cases {
+		fmt.Fprintf(&b, "%s", c.Name)
+		if c.Technique != "" {
+			fmt.Fprintf(&b, " (%s)", c.Technique)
+		}
+		if c.Scores != nil {
+			fmt.Fprintf(&b, " judge %.1f/%d", c.Scores.Overall, judge.MaxScore)
+		}
+		b.WriteString("\n")
+		if c.Error != "" {
+			fmt.Fprintf(&b, "  error: %s\n", c.Error)
+		}
+		for i, run := range c.Runs {
+			if len(c.Runs) > 1 {
+				fmt.Fprintf(&b, "  inputs %d:\n", i+1)
+			}
+			writeOutcome(&b, "original", run.Original)
+			writeOutcome(&b, "enhanced", run.Enhanced)
+		}
+	}
+	fmt.Fprintf(&b, "\n%-10s %12s %10s %10s\n", "PROMPT", "ASSERTIONS", "RUNS", "PASS RATE")
+	for _, s := range []struct {
+		label string
+		Summary
+	}{{"original", r.Original}, {"enhanced", r.Enhanced}} {
+		fmt.Fprintf(&b, "%-10s %5d/%-6d %4d/%-5d %9.1f%%\n", s.label, s.Passed, s.Assertions, s.RunsPassed, s.Runs, 100*s.PassRate)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write eval report: %w", err)
+	}
+	return nil
+}
+
+// writeOutcome writes the assertion results of one variant.
+func writeOutcome(b *strings.Builder, label string, outcome Outcome) {
+	fmt.Fprintf(b, "  %s:\n", label)
+	if outcome.Error != "" {
+		fmt.Fprintf(b, "    error: %s\n", outcome.Error)
+	}
+	for _, a := range outcome.Assertions {
+		mark := "FAIL"
+		if a.Pass {
+			mark = "pass"
+		}
+		fmt.Fprintf(b, "    %s  %s", mark, a.Description)
+		if a.Detail != "" && (!a.Pass || a.Type == "judge") {
+			fmt.Fprintf(b, " — %s", a.Detail)
+		}
+		b.WriteString("\n")
+	}
+}
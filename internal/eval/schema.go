@@ -0,0 +1,194 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validateJSON parses text as JSON and validates it against schema. It
+// returns the violations found, or a single one if text is not JSON.
+//
+// The common subset of JSON Schema is supported: type, enum, const,
+// properties, required, additionalProperties, items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum and maximum.
+func validateJSON(text string, schema map[string]any) []string {
+	var value any
+	if err := json.Unmarshal([]byte(stripCodeFence(text)), &value); err != nil {
+		return []string{fmt.Sprintf("response is not valid JSON: %v", err)}
+	}
+	var violations []string
+	validateValue(value, schema, "$", &violations)
+	return violations
+}
+
+// stripCodeFence removes a Markdown code fence around text, which models
+// often add to JSON responses.
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+	text = strings.TrimSuffix(text[3:], "```")
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+		text = text[newline+1:] // Drop the language tag, such as "json"
+	}
+	return text
+}
+
+// validateValue appends the violations of value against schema at path.
+func validateValue(value any, schema map[string]any, path string, violations *[]string) {
+	fail := func(format string, args ...any) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(value, t) {
+		fail("expected %s, got %s", typeNames(t), jsonType(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsValue(enum, value) {
+		fail("value %s is not one of the allowed values", compact(value))
+	}
+	if c, ok := schema["const"]; ok && !equalValues(c, value) {
+		fail("value %s is not %s", compact(value), compact(c))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						fail("missing required property '%s'", key)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if sub, ok := properties[key].(map[string]any); ok {
+				validateValue(v[key], sub, path+"."+key, violations)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				fail("unexpected property '%s'", key)
+			} else if sub, ok := schema["additionalProperties"].(map[string]any); ok {
+				validateValue(v[key], sub, path+"."+key, violations)
+			}
+		}
+	case []any:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			fail("expected at least %g items, got %d", n, len(v))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			fail("expected at most %g items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(item, items, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			fail("expected at least %g characters, got %g", n, length)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			fail("expected at most %g characters, got %g", n, length)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil {
+				fail("invalid pattern in schema: %v", err)
+			} else if !re.MatchString(v) {
+				fail("%q does not match /%s/", v, pattern)
+			}
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			fail("%g is less than the minimum %g", v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			fail("%g is greater than the maximum %g", v, n)
+		}
+	}
+}
+
+// matchesType reports whether value has the type, or one of the types, t.
+func matchesType(value any, t any) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonType(value)
+		return actual == t || (t == "number" && actual == "integer")
+	case []any:
+		for _, each := range t {
+			if matchesType(value, each) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeNames formats the type keyword of a schema.
+func typeNames(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, len(list))
+		for i, each := range list {
+			names[i] = fmt.Sprint(each)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value.
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// number returns v as a float64 if it is a JSON number.
+func number(v any) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func containsValue(list []any, value any) bool {
+	for _, each := range list {
+		if equalValues(each, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalValues(a any, b any) bool {
+	return compact(a) == compact(b)
+}
+
+// compact encodes v as JSON for comparisons and messages.
+func compact(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,218 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	judge "tokinfo/internal/judge"
+	variables "tokinfo/internal/variables"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of test cases read from a YAML file, for example:
+//
+//	model: gemini-2.0-flash
+//	cases:
+//	  - name: summary
+//	    prompt: "Summarize this review: {{review}}"
+//	    inputs:
+//	      - review: "Great battery, poor screen."
+//	    assert:
+//	      - contains: battery
+//	      - regex: "(?i)screen"
+//	      - judge: Mentions both a strength and a weakness.
+type Suite struct {
+	// Model is the target model the prompts are run against; empty means
+	// the model tokinfo itself uses.
+	Model string `yaml:"model" json:"model,omitempty"`
+	// Answers answer the clarifying questions when the templates are
+	// enhanced, keyed like an answers file.
+	Answers map[string]string `yaml:"answers" json:"answers,omitempty"`
+	// Unanswered is "example" (the default) or "skip"; see enhance.Answering.
+	Unanswered string `yaml:"unanswered" json:"unanswered,omitempty"`
+	Cases      []Case `yaml:"cases" json:"cases"`
+}
+
+// Case is one prompt template, the inputs it is rendered with and the
+// assertions every response must pass.
+type Case struct {
+	Name   string           `yaml:"name" json:"name"`
+	Prompt string           `yaml:"prompt" json:"prompt"`
+	Inputs []map[string]any `yaml:"inputs" json:"inputs,omitempty"`
+	Assert []Assertion      `yaml:"assert" json:"assert"`
+}
+
+// Assertion checks a response. Exactly one of its fields is set.
+type Assertion struct {
+	// Contains requires the response to contain the text, ignoring case.
+	Contains string `yaml:"contains" json:"contains,omitempty"`
+	// NotContains requires the response not to contain the text, ignoring case.
+	NotContains string `yaml:"not-contains" json:"notContains,omitempty"`
+	// Regex requires the response to match the regular expression.
+	Regex string `yaml:"regex" json:"regex,omitempty"`
+	// JSONSchema requires the response to be JSON valid against the schema.
+	JSONSchema map[string]any `yaml:"json-schema" json:"jsonSchema,omitempty"`
+	// Judge is a rubric an LLM judge scores the response against.
+	Judge string `yaml:"judge" json:"judge,omitempty"`
+	// MinScore is the judge score, from 1 to 5, needed to pass (default 4).
+	MinScore int `yaml:"min-score" json:"minScore,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// Type names the kind of assertion.
+func (a *Assertion) Type() string {
+	switch {
+	case a.Contains != "":
+		return "contains"
+	case a.NotContains != "":
+		return "not-contains"
+	case a.Regex != "":
+		return "regex"
+	case a.JSONSchema != nil:
+		return "json-schema"
+	case a.Judge != "":
+		return "judge"
+	default:
+		return ""
+	}
+}
+
+// String describes the assertion in reports.
+func (a *Assertion) String() string {
+	switch a.Type() {
+	case "contains":
+		return fmt.Sprintf("contains %q", a.Contains)
+	case "not-contains":
+		return fmt.Sprintf("does not contain %q", a.NotContains)
+	case "regex":
+		return fmt.Sprintf("matches /%s/", a.Regex)
+	case "json-schema":
+		return "valid against JSON schema"
+	default:
+		return fmt.Sprintf("judge (>= %d): %s", a.minScore(), a.Judge)
+	}
+}
+
+// minScore returns the judge score needed to pass.
+func (a *Assertion) minScore() int {
+	if a.MinScore == 0 {
+		return defaultMinScore
+	}
+	return a.MinScore
+}
+
+// defaultMinScore is the judge score needed to pass when none is given.
+const defaultMinScore = 4
+
+// LoadSuite reads and validates the suite at path.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eval suite '%s': %w", path, err)
+	}
+	var suite Suite
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&suite); err != nil {
+		return nil, fmt.Errorf("failed to parse eval suite '%s': %w", path, err)
+	}
+	if err := suite.validate(); err != nil {
+		return nil, fmt.Errorf("invalid eval suite '%s': %w", path, err)
+	}
+	return &suite, nil
+}
+
+// validate checks the suite and compiles its regular expressions.
+func (s *Suite) validate() error {
+	if s.Unanswered != "" && s.Unanswered != "example" && s.Unanswered != "skip" {
+		return fmt.Errorf("unknown unanswered value '%s' (expected example or skip)", s.Unanswered)
+	}
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("no cases")
+	}
+	names := make(map[string]bool)
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case-%d", i+1)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate case name '%s'", c.Name)
+		}
+		names[c.Name] = true
+		if strings.TrimSpace(c.Prompt) == "" {
+			return fmt.Errorf("case '%s': prompt is empty", c.Name)
+		}
+		for k, inputs := range c.Inputs {
+			if _, err := Render(c.Prompt, inputs); err != nil {
+				return fmt.Errorf("case '%s', inputs %d: %w", c.Name, k+1, err)
+			}
+		}
+		if len(c.Inputs) == 0 {
+			if _, err := Render(c.Prompt, nil); err != nil {
+				return fmt.Errorf("case '%s': %w", c.Name, err)
+			}
+		}
+		if len(c.Assert) == 0 {
+			return fmt.Errorf("case '%s': no assertions", c.Name)
+		}
+		for k := range c.Assert {
+			if err := c.Assert[k].compile(); err != nil {
+				return fmt.Errorf("case '%s', assertion %d: %w", c.Name, k+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// compile checks that exactly one field is set and compiles the regex.
+func (a *Assertion) compile() error {
+	set := 0
+	for _, ok := range []bool{a.Contains != "", a.NotContains != "", a.Regex != "", a.JSONSchema != nil, a.Judge != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("set exactly one of contains, not-contains, regex, json-schema or judge")
+	}
+	if a.MinScore != 0 && (a.Judge == "" || a.MinScore < judge.MinScore || a.MinScore > judge.MaxScore) {
+		return fmt.Errorf("min-score must be %d-%d and is only used with judge", judge.MinScore, judge.MaxScore)
+	}
+	if a.Regex != "" {
+		re, err := regexp.Compile(a.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		a.regex = re
+	}
+	if a.JSONSchema != nil {
+		// The schema must survive a JSON round trip to be used by the validator.
+		data, err := json.Marshal(a.JSONSchema)
+		if err != nil {
+			return fmt.Errorf("invalid JSON schema: %w", err)
+		}
+		a.JSONSchema = nil
+		if err := json.Unmarshal(data, &a.JSONSchema); err != nil {
+			return fmt.Errorf("invalid JSON schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// --- Templates ---
+
+// Render fills in the variables of template with inputs, in any of the
+// template styles of package variables. Every variable needs an input.
+func Render(template string, inputs map[string]any) (string, error) {
+	if inputs == nil {
+		inputs = map[string]any{}
+	}
+	return variables.Render(template, inputs, "")
+}
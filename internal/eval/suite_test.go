@@ -0,0 +1,38 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSuiteTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		suite   string
+		wantErr string
+	}{
+		{"mustache", "cases:\n  - prompt: 'Review: {{review}}'\n    inputs:\n      - review: Great\n    assert:\n      - contains: great\n", ""},
+		{"mustache section with a list", "cases:\n  - prompt: '{{#items}}- {{.}}\n{{/items}}'\n    inputs:\n      - items: [a, b]\n    assert:\n      - contains: a\n", ""},
+		{"go template", "cases:\n  - prompt: 'Hi {{.Name}}'\n    inputs:\n      - Name: Ana\n    assert:\n      - contains: Ana\n", ""},
+		{"no variables", "cases:\n  - prompt: Write a haiku.\n    assert:\n      - contains: a\n", ""},
+		{"missing input", "cases:\n  - name: c\n    prompt: 'Review: {{review}}'\n    inputs:\n      - other: x\n    assert:\n      - contains: a\n", "case 'c', inputs 1: no value for review"},
+		{"variables without inputs", "cases:\n  - name: c\n    prompt: 'Review: {review}'\n    assert:\n      - contains: a\n", "case 'c': no value for review"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suite.yaml")
+			if err := os.WriteFile(path, []byte(tt.suite), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadSuite(path)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("LoadSuite error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("LoadSuite error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,7 +4,16 @@ package gemini
 import (
 	"context"       // Gemini client likely requires context
 	"encoding/json" // For JSON parsing
+	"errors"        // For sentinel errors
 	"fmt"           // For error formatting
+	"log/slog"
+	"strings"
+
+	budget "tokinfo/internal/budget"
+	cache "tokinfo/internal/cache"
+	preserve "tokinfo/internal/preserve"
+	ratelimit "tokinfo/internal/ratelimit"
+	usage "tokinfo/internal/usage"
 
 	// Official Gemini Go client package import path needs to be added here.
 	// Example: "google.golang.org/api/option"
@@ -12,42 +21,119 @@ import (
 	"google.golang.org/genai"
 )
 
+// Model is the Gemini model used for both the analysis and refinement stages.
+const Model = "gemini-2.5-flash-preview-04-17"
+
+// Stage names used when recording token usage.
+const (
+	StageAnalyze = "analyze"
+	StageRefine  = "refine"
+	StageEval    = "eval"  // Prompts under evaluation, sent to a target model
+	StageJudge   = "judge" // Scores of prompts and responses against criteria
+)
+
 // Client wraps the official Gemini client and provides specific methods for tokinfo.
 type Client struct {
 	*genai.Client // Embed the official client
 	analyzeConfig *genai.GenerateContentConfig
 	refineConfig  *genai.GenerateContentConfig
-	verbose       bool // Add verbose flag to the client
+	judgeConfig   *genai.GenerateContentConfig
+	options       Options
+	logger        *slog.Logger // Diagnostics; never writes to stdout
+}
+
+// Options holds optional settings for the client.
+// The zero value disables every limit.
+type Options struct {
+	AnalyzeBudget   int   // Max estimated input tokens for Stage 1 (0 = unlimited)
+	RefineBudget    int   // Max estimated input tokens for Stage 2 (0 = unlimited)
+	MaxOutputTokens int32 // Hard cap on the enhanced prompt length (0 = model default)
+	// Usage receives the token usage of every call. It may be nil.
+	Usage *usage.Tracker
+	// Cache stores responses so repeated requests skip the API. It may be nil.
+	Cache *cache.Cache
+	// Replay answers every request from Cache and never calls the API; a
+	// request that was not recorded fails with ErrNotRecorded.
+	Replay bool
+	// GuidelinesHash identifies the guidelines the requests are built from;
+	// it is part of the cache key.
+	GuidelinesHash string
+	// Limits paces API requests per model; clients sharing a quota should
+	// share one set. It may be nil.
+	Limits *ratelimit.Set
+	// Preserve is what RefinePrompt does when the enhanced prompt lost
+	// protected content even after a retry: preserve.ModeStrict (or empty)
+	// fails, preserve.ModeWarn logs a warning and preserve.ModeOff skips the check.
+	Preserve string
+	// BaseURL, if set, replaces the Gemini API endpoint, e.g. with a proxy
+	// or a test server.
+	BaseURL string
 }
 
+// Provider names the API backend in cache keys and rate limits.
+const Provider = "gemini"
+
+// ErrNotRecorded is returned in replay mode for requests missing from the cache.
+var ErrNotRecorded = errors.New("response not recorded in the cache")
+
 // AnalysisResult holds the structured data returned from the Stage 1 analysis call.
 type AnalysisResult struct {
-	ChosenTechniqueName string   `json:"ChoseTechnique"`      // Match JSON key "ChoseTechnique"
-	ClarifyingQuestions []string `json:"ClarifyingQuestions"` // Match JSON key "ClarifyingQuestions"
-	// Add any other relevant fields from the analysis, e.g., Gemini's reasoning.
+	ChosenTechniqueName string               `json:"ChoseTechnique"`      // Match JSON key "ChoseTechnique"
+	ClarifyingQuestions []ClarifyingQuestion `json:"ClarifyingQuestions"` // Match JSON key "ClarifyingQuestions"
+	Rationale           string               `json:"Rationale"`           // Why the technique fits the prompt
+}
+
+// ClarifyingQuestion is a question the model needs answered before refining,
+// together with an example of an appropriate answer.
+type ClarifyingQuestion struct {
+	Question      string `json:"question"`
+	ExampleAnswer string `json:"exampleAnswer"`
+}
+
+// Judgement holds the structured scores returned from a judge call.
+type Judgement struct {
+	Scores  []CriterionScore `json:"scores"`
+	Summary string           `json:"summary"`
+}
+
+// CriterionScore is the score given for one criterion of a rubric.
+type CriterionScore struct {
+	Criterion     string `json:"criterion"`
+	Score         int    `json:"score"` // 1 (does not meet the criterion) to 5 (fully meets it)
+	Justification string `json:"justification"`
 }
 
 // NewClient initializes and returns a new Gemini client wrapper.
-// It requires the API key for authentication and the verbose flag.
-func NewClient(ctx context.Context, apiKey string, verbose bool) (*Client, error) {
+// It requires the API key for authentication, the client options and the logger
+// for diagnostics. A nil logger discards them. In replay mode the API is never
+// called, so the key may be empty and no official client is created.
+func NewClient(ctx context.Context, apiKey string, options Options, logger *slog.Logger) (*Client, error) {
 	// Use the official genai package to create a new client instance.
 	// Handle potential initialization errors.
 	// Return a new instance of our wrapper Client struct.
 
-	if apiKey == "" {
+	if apiKey == "" && !options.Replay {
 		return nil, fmt.Errorf("API key cannot be empty")
 	}
-
-	// Create ClientConfig
-	cfg := &genai.ClientConfig{
-		APIKey: apiKey,
-		// Add other config options if needed, e.g., Backend, Project, Location
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
 	}
 
-	// Create the official client
-	officialClient, err := genai.NewClient(ctx, cfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create genai client: %w", err)
+	var officialClient *genai.Client
+	if !options.Replay {
+		// Create ClientConfig
+		cfg := &genai.ClientConfig{
+			APIKey:      apiKey,
+			HTTPOptions: genai.HTTPOptions{BaseURL: options.BaseURL},
+			// Add other config options if needed, e.g., Backend, Project, Location
+		}
+
+		// Create the official client
+		var err error
+		officialClient, err = genai.NewClient(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create genai client: %w", err)
+		}
 	}
 
 	// Define the GenerateContentConfig for the AnalyzePrompt function, using the schema.
@@ -63,10 +149,19 @@ func NewClient(ctx context.Context, apiKey string, verbose bool) (*Client, error
 			Properties: map[string]*genai.Schema{
 				"ChoseTechnique": {Type: genai.TypeString},
 				"ClarifyingQuestions": {
-					Type:  genai.TypeArray,
-					Items: &genai.Schema{Type: genai.TypeString},
+					Type: genai.TypeArray,
+					Items: &genai.Schema{
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"question":      {Type: genai.TypeString},
+							"exampleAnswer": {Type: genai.TypeString},
+						},
+						Required: []string{"question", "exampleAnswer"},
+					},
 				},
+				"Rationale": {Type: genai.TypeString},
 			},
+			Required: []string{"ChoseTechnique", "ClarifyingQuestions", "Rationale"},
 		},
 	}
 
@@ -78,7 +173,38 @@ func NewClient(ctx context.Context, apiKey string, verbose bool) (*Client, error
 				{Text: "You are a prompt refinement tool. Your only task is to refine the user's raw prompt based on the provided context and output the improved prompt as plain text in English. Output ONLY the refined prompt. Do NOT include code, explanations, comments, or any extra text. Any additional content is an error."},
 			},
 		},
-		// Add any simple configurations needed for refinement, or leave empty.
+		// Cap the length of the enhanced prompt if requested.
+		MaxOutputTokens: options.MaxOutputTokens,
+	}
+
+	// Define the GenerateContentConfig for the Judge function, using a schema
+	// like the analysis so the scores can be parsed.
+	judgeConfig := &genai.GenerateContentConfig{
+		SystemInstruction: &genai.Content{
+			Parts: []*genai.Part{
+				{Text: "You are a strict evaluator. Your only task is to score the given text against each criterion of the rubric and return a JSON object with the scores. Output ONLY the JSON object. Do NOT include any text, explanations, code, or markdown outside the JSON."},
+			},
+		},
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"scores": {
+					Type: genai.TypeArray,
+					Items: &genai.Schema{
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"criterion":     {Type: genai.TypeString},
+							"score":         {Type: genai.TypeInteger},
+							"justification": {Type: genai.TypeString},
+						},
+						Required: []string{"criterion", "score", "justification"},
+					},
+				},
+				"summary": {Type: genai.TypeString},
+			},
+			Required: []string{"scores", "summary"},
+		},
 	}
 
 	// Return our wrapper client embedding the official client and the configs
@@ -86,7 +212,9 @@ func NewClient(ctx context.Context, apiKey string, verbose bool) (*Client, error
 		Client:        officialClient,
 		analyzeConfig: analyzeConfig,
 		refineConfig:  refineConfig,
-		verbose:       verbose, // Initialize the verbose field
+		judgeConfig:   judgeConfig,
+		options:       options,
+		logger:        logger,
 	}, nil
 }
 
@@ -96,9 +224,7 @@ func (c *Client) Close() error {
 	// 1. Call the Close method on the underlying official client if it exists.
 	//    (e.g., return c.internalClient.Close())
 	// 2. Handle potential errors during closing.
-	if c.verbose { // Use the struct's verbose field
-		fmt.Println("Gemini client resources released (placeholder).") // Placeholder action
-	}
+	c.logger.Debug("Gemini client resources released (placeholder)") // Placeholder action
 	return nil
 }
 
@@ -106,8 +232,255 @@ func (c *Client) Close() error {
 // It sends the context and user prompt, requesting analysis and clarifying questions.
 // It uses the analyzeConfig with the defined schema for structured output.
 func (c *Client) AnalyzePrompt(ctx context.Context, intro string, summarizedTechniques string, userPrompt string) (*AnalysisResult, error) {
+	// Trim the guide so the request fits the Stage 1 budget. The introduction is
+	// trimmed before the technique summaries, which the model needs to choose from.
+	sections, err := budget.Fit(c.options.AnalyzeBudget, BuildAnalyzePrompt("", "", userPrompt), []string{intro, summarizedTechniques})
+	if err != nil {
+		return nil, fmt.Errorf("stage 1 input does not fit the token budget: %w", err)
+	}
+	if c.options.AnalyzeBudget > 0 {
+		c.logger.Debug("stage 1 request budget", "stage", StageAnalyze, "estimatedTokens", budget.EstimateTokens(BuildAnalyzePrompt(sections[0], sections[1], userPrompt)), "budget", c.options.AnalyzeBudget)
+	}
+
 	// Construct the combined prompt for the Gemini API based on inputs.
-	prompt := fmt.Sprintf(`Prompt Engineering Guide:
+	prompt := BuildAnalyzePrompt(sections[0], sections[1], userPrompt)
+
+	// Use the GenerateResponse helper function with the analyzeConfig.
+	generatedText, cacheKey, err := c.generate(ctx, StageAnalyze, Model, prompt, c.analyzeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content for analysis: %w", err)
+	}
+
+	// Unmarshal the JSON response text into the AnalysisResult struct.
+	var result AnalysisResult
+	err = json.Unmarshal([]byte(generatedText), &result)
+	if err != nil {
+		// Log the problematic JSON for debugging if needed
+		// fmt.Printf("Failed to unmarshal JSON: %s\n", generatedText)
+		return nil, fmt.Errorf("failed to unmarshal analysis response JSON: %w", err)
+	}
+	// Only a response that parsed is cached; a malformed one is asked for again.
+	c.store(StageAnalyze, cacheKey, generatedText)
+
+	// Return the parsed result.
+	return &result, nil
+}
+
+// RefinePrompt performs the Stage 2 interaction with the Gemini API.
+// It sends the context, chosen technique details, original prompt, and any user answers
+// to generate the final enhanced prompt.
+// It uses the simple refineConfig.
+func (c *Client) RefinePrompt(ctx context.Context, intro string, completeTechniqueDesc string, userPrompt string, answers map[string]string) (string, error) {
+	prompt, err := c.refineRequest(intro, completeTechniqueDesc, userPrompt, answers, "")
+	if err != nil {
+		return "", fmt.Errorf("stage 2 input does not fit the token budget: %w", err)
+	}
+	refinedPrompt, cacheKey, err := c.generate(ctx, StageRefine, Model, prompt, c.refineConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate content for refinement: %w", err)
+	}
+
+	// Code, JSON examples, URLs, quotes and template variables must survive
+	// verbatim; a refinement that lost some is retried once with the list.
+	// Only responses that kept them are cached, unless losing them is allowed,
+	// so a later run does not replay a rejected response.
+	var spans, missing []preserve.Span
+	if c.options.Preserve != preserve.ModeOff {
+		spans = preserve.Extract(userPrompt)
+		missing = preserve.Missing(spans, refinedPrompt)
+	}
+	if len(missing) == 0 || c.options.Preserve == preserve.ModeWarn {
+		c.store(StageRefine, cacheKey, refinedPrompt)
+	}
+	if len(missing) > 0 {
+		c.logger.Info("refinement lost protected content; retrying", "stage", StageRefine, "missing", len(missing), "protected", len(spans))
+		retryPrompt, err := c.refineRequest(intro, completeTechniqueDesc, userPrompt, answers, retryInstructions(missing))
+		if err != nil {
+			return "", fmt.Errorf("stage 2 retry does not fit the token budget: %w", err)
+		}
+		refinedPrompt, cacheKey, err = c.generate(ctx, StageRefine, Model, retryPrompt, c.refineConfig)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate content for refinement retry: %w", err)
+		}
+		missing = preserve.Missing(spans, refinedPrompt)
+		if len(missing) == 0 || c.options.Preserve == preserve.ModeWarn {
+			c.store(StageRefine, cacheKey, refinedPrompt)
+		}
+	}
+	if len(missing) > 0 {
+		lost := &preserve.Error{Missing: missing}
+		if c.options.Preserve != preserve.ModeWarn {
+			return "", lost
+		}
+		c.logger.Warn("keeping enhanced prompt with lost content", "stage", StageRefine, "error", lost)
+	}
+
+	// Assuming the response is plain text, return the generated text.
+	return refinedPrompt, nil
+}
+
+// refineRequest builds the Stage 2 request followed by extra, trimming the
+// guide so the whole request fits the Stage 2 budget. The user's prompt,
+// answers and extra are always sent in full; the introduction is trimmed
+// before the technique.
+func (c *Client) refineRequest(intro string, completeTechniqueDesc string, userPrompt string, answers map[string]string, extra string) (string, error) {
+	sections, err := budget.Fit(c.options.RefineBudget, BuildRefinePrompt("", "", userPrompt, answers, c.options.Preserve)+extra, []string{intro, completeTechniqueDesc})
+	if err != nil {
+		return "", err
+	}
+	prompt := BuildRefinePrompt(sections[0], sections[1], userPrompt, answers, c.options.Preserve) + extra
+	if c.options.RefineBudget > 0 {
+		c.logger.Debug("stage 2 request budget", "stage", StageRefine, "estimatedTokens", budget.EstimateTokens(prompt), "budget", c.options.RefineBudget)
+	}
+	return prompt, nil
+}
+
+// retryInstructions asks the model to try again, keeping the spans a first
+// attempt lost.
+func retryInstructions(missing []preserve.Span) string {
+	var b strings.Builder
+	b.WriteString("\n\n**Retry:**\nA previous attempt changed or dropped the parts below. Include each of them in the enhanced prompt exactly as written here:")
+	for _, span := range missing {
+		fmt.Fprintf(&b, "\n\n%s", span.Text)
+	}
+	return b.String()
+}
+
+// GenerateResponse calls the Gemini API's GenerateContent method to get a response.
+// It takes the context, stage name, model name, prompt, and configuration, and returns the generated text or an error.
+// The token usage of the call is recorded under stage if the client has a usage tracker.
+func (c *Client) GenerateResponse(ctx context.Context, stage string, modelName string, prompt string, config *genai.GenerateContentConfig) (string, error) {
+	generatedText, cacheKey, err := c.generate(ctx, stage, modelName, prompt, config)
+	if err != nil {
+		return "", err
+	}
+	c.store(stage, cacheKey, generatedText)
+	return generatedText, nil
+}
+
+// generate returns the response to prompt from the cache or the API, with
+// the cache key to store it under once the caller has checked it. The key
+// is empty when the response came from the cache or there is no cache.
+func (c *Client) generate(ctx context.Context, stage string, modelName string, prompt string, config *genai.GenerateContentConfig) (string, string, error) {
+	// Serve the response from the cache when the same request was made before.
+	var cacheKey string
+	if c.options.Cache != nil {
+		configJSON, err := json.Marshal(config)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal generation config for cache key: %w", err)
+		}
+		cacheKey = cache.Key(Provider, modelName, string(configJSON), prompt, c.options.GuidelinesHash)
+		cached, ok, err := c.options.Cache.Get(cacheKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read response cache: %w", err)
+		}
+		if ok {
+			c.logger.Debug("using cached response", "stage", stage, "model", modelName)
+			return cached, "", nil
+		}
+	}
+	if c.options.Replay {
+		return "", "", fmt.Errorf("%s request to %s: %w (record it by running once without -replay)", stage, modelName, ErrNotRecorded)
+	}
+
+	// Wait for the rate limiter; cached responses above do not count against it.
+	limiter := c.options.Limits.Limiter(Provider, modelName)
+	reserved := budget.EstimateTokens(prompt)
+	waited, err := limiter.Wait(ctx, reserved)
+	if err != nil {
+		return "", "", fmt.Errorf("waiting for rate limiter: %w", err)
+	}
+	if waited > 0 {
+		c.logger.Debug("rate limited", "stage", stage, "model", modelName, "waited", waited)
+	}
+
+	// Call the embedded genai.Client's GenerateContent method
+	c.logger.Debug("calling Gemini API", "stage", stage, "model", modelName)
+	result, err := c.Client.Models.GenerateContent(ctx, modelName, genai.Text(prompt), config)
+	if err != nil {
+		// Handle the error from the API call
+		return "", "", fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	// Record the token usage reported by the API
+	if result.UsageMetadata != nil {
+		limiter.Settle(reserved, int(result.UsageMetadata.TotalTokenCount))
+	}
+	if c.options.Usage != nil && result.UsageMetadata != nil {
+		c.options.Usage.Add(stage, modelName, usage.Usage{
+			Calls:           1,
+			PromptTokens:    int(result.UsageMetadata.PromptTokenCount),
+			CandidateTokens: int(result.UsageMetadata.CandidatesTokenCount),
+			ThinkingTokens:  int(result.UsageMetadata.ThoughtsTokenCount),
+			TotalTokens:     int(result.UsageMetadata.TotalTokenCount),
+		})
+	}
+
+	// Extract the text from the result
+	return result.Text(), cacheKey, nil
+}
+
+// store caches a response generate returned under key for next time. Empty
+// responses, such as blocked ones, are not cached, so a later run asks again.
+// A failed write only costs a future API call.
+func (c *Client) store(stage string, key string, text string) {
+	if key == "" || strings.TrimSpace(text) == "" {
+		return
+	}
+	if err := c.options.Cache.Put(key, text); err != nil {
+		c.logger.Warn("could not cache response", "stage", stage, "error", err)
+	}
+}
+
+// CountTokens asks the API for the exact number of tokens text uses on the model.
+func (c *Client) CountTokens(ctx context.Context, text string) (int, error) {
+	if c.options.Replay {
+		return 0, fmt.Errorf("exact token counts need the API and are not available in replay mode")
+	}
+	if _, err := c.options.Limits.Limiter(Provider, Model).Wait(ctx, 0); err != nil {
+		return 0, fmt.Errorf("waiting for rate limiter: %w", err)
+	}
+	result, err := c.Client.Models.CountTokens(ctx, Model, genai.Text(text), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	return int(result.TotalTokens), nil
+}
+
+// Generate sends prompt as is to modelName and returns the response text.
+// It is used to run the prompts being evaluated against a target model.
+func (c *Client) Generate(ctx context.Context, modelName string, prompt string) (string, error) {
+	response, err := c.GenerateResponse(ctx, StageEval, modelName, prompt, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate content for evaluation: %w", err)
+	}
+	return response, nil
+}
+
+// Judge sends a judge request, built by the judge package, and parses the
+// scores. It uses the judgeConfig with the defined schema for structured output.
+func (c *Client) Judge(ctx context.Context, request string) (*Judgement, error) {
+	generatedText, cacheKey, err := c.generate(ctx, StageJudge, Model, request, c.judgeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content for judgement: %w", err)
+	}
+	var result Judgement
+	if err := json.Unmarshal([]byte(generatedText), &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal judge response JSON: %w", err)
+	}
+	c.store(StageJudge, cacheKey, generatedText)
+	return &result, nil
+}
+
+// GetRefineConfig returns the client's configuration for the refinement step.
+func (c *Client) GetRefineConfig() *genai.GenerateContentConfig {
+	return c.refineConfig
+}
+
+// BuildAnalyzePrompt renders the Stage 1 request from the guide and the user's prompt.
+// It is exported so callers can measure the request without sending it.
+func BuildAnalyzePrompt(intro string, summarizedTechniques string, userPrompt string) string {
+	return fmt.Sprintf(`Prompt Engineering Guide:
 %s
 
 -------------------------------------------------------------------
@@ -118,7 +491,7 @@ User’s Raw Prompt:
 Task:
 Using only the techniques described in the Prompt Engineering Guide, analyze the User’s Raw Prompt and decide:
 
-1. Which single prompt-engineering technique you will apply.
+1. Which single prompt-engineering technique you will apply, and briefly why it fits this prompt.
 2. What clarifying questions (if any) you need to ask before rewriting it — and for each question, provide an example of an appropriate answer.
 
 Output:
@@ -147,37 +520,32 @@ Respond with exactly this JSON schema—no extra keys or prose:
 	       },
 	       "required": ["question", "exampleAnswer"]
 	     }
+	   },
+	   "Rationale": {
+	     "type": "string",
+	     "description": "One or two sentences explaining why the chosen technique fits the User’s Raw Prompt."
 	   }
 	 },
-	 "required": ["ChoseTechnique", "ClarifyingQuestions"]
+	 "required": ["ChoseTechnique", "ClarifyingQuestions", "Rationale"]
 }`, intro+"\n\n"+summarizedTechniques, userPrompt)
+}
 
-	// Use the GenerateResponse helper function with the analyzeConfig.
-	generatedText, err := c.GenerateResponse(ctx, "gemini-2.5-flash-preview-04-17", prompt, c.analyzeConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate content for analysis: %w", err)
-	}
-
-	// Unmarshal the JSON response text into the AnalysisResult struct.
-	var result AnalysisResult
-	err = json.Unmarshal([]byte(generatedText), &result)
-	if err != nil {
-		// Log the problematic JSON for debugging if needed
-		// fmt.Printf("Failed to unmarshal JSON: %s\n", generatedText)
-		return nil, fmt.Errorf("failed to unmarshal analysis response JSON: %w", err)
+// BuildRefinePrompt renders the Stage 2 request from the guide, the chosen technique,
+// the user's prompt and their answers to the clarifying questions. When the
+// prompt holds code, JSON examples, URLs, quotes or template variables, the
+// request asks for them to be kept as written, unless preserveMode is
+// preserve.ModeOff.
+func BuildRefinePrompt(intro string, completeTechniqueDesc string, userPrompt string, answers map[string]string, preserveMode string) string {
+	request := buildRefineRequest(intro, completeTechniqueDesc, userPrompt, answers)
+	if preserveMode == preserve.ModeOff {
+		return request
 	}
-
-	// Return the parsed result.
-	return &result, nil
+	return request + preserve.Instructions(preserve.Extract(userPrompt))
 }
 
-// RefinePrompt performs the Stage 2 interaction with the Gemini API.
-// It sends the context, chosen technique details, original prompt, and any user answers
-// to generate the final enhanced prompt.
-// It uses the simple refineConfig.
-func (c *Client) RefinePrompt(ctx context.Context, intro string, completeTechniqueDesc string, userPrompt string, answers map[string]string) (string, error) {
-	// Construct the combined prompt for the Gemini API, incorporating all inputs.
-	prompt := fmt.Sprintf(`%s 
+// buildRefineRequest renders the Stage 2 request without preservation instructions.
+func buildRefineRequest(intro string, completeTechniqueDesc string, userPrompt string, answers map[string]string) string {
+	return fmt.Sprintf(`%s 
 %s 
 --------------------------------------------------------------------------
 prompt:
@@ -206,35 +574,4 @@ Original: "Explain blockchain"
 Enhanced: "Describe blockchain technology in 3 steps using a baking analogy for non-technical audiences. Highlight decentralization and security. Avoid cryptocurrency mentions."`,
 		intro, completeTechniqueDesc, userPrompt, answers,
 	)
-
-	// Use the GenerateResponse helper function with the refineConfig.
-	refinedPrompt, err := c.GenerateResponse(ctx, "gemini-2.5-flash-preview-04-17", prompt, c.refineConfig)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate content for refinement: %w", err)
-	}
-
-	// Assuming the response is plain text, return the generated text.
-	return refinedPrompt, nil
-}
-
-// GenerateResponse calls the Gemini API's GenerateContent method to get a response.
-// It takes the context, model name, prompt, and configuration, and returns the generated text or an error.
-func (c *Client) GenerateResponse(ctx context.Context, modelName string, prompt string, config *genai.GenerateContentConfig) (string, error) {
-	// Call the embedded genai.Client's GenerateContent method
-	result, err := c.Client.Models.GenerateContent(ctx, modelName, genai.Text(prompt), config)
-	if err != nil {
-		// Handle the error from the API call
-		return "", fmt.Errorf("failed to generate content: %w", err)
-	}
-
-	// Extract the text from the result
-	generatedText := result.Text()
-
-	// Return the extracted text and nil error
-	return generatedText, nil
-}
-
-// GetRefineConfig returns the client's configuration for the refinement step.
-func (c *Client) GetRefineConfig() *genai.GenerateContentConfig {
-	return c.refineConfig
 }
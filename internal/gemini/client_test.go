@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	budget "tokinfo/internal/budget"
+	preserve "tokinfo/internal/preserve"
+)
+
+func TestBuildRefinePromptPreserveMode(t *testing.T) {
+	userPrompt := `Summarize https://example.com/report and keep "Q3 revenue".`
+	tests := []struct {
+		mode string
+		want bool // Whether the request asks to keep the protected content
+	}{
+		{preserve.ModeStrict, true},
+		{preserve.ModeWarn, true},
+		{"", true},
+		{preserve.ModeOff, false},
+	}
+	for _, tt := range tests {
+		request := BuildRefinePrompt("intro", "technique", userPrompt, nil, tt.mode)
+		if got := strings.Contains(request, "**Preserved content:**"); got != tt.want {
+			t.Errorf("BuildRefinePrompt with mode %q asks to keep content = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+	if request := BuildRefinePrompt("intro", "technique", "Write a haiku.", nil, preserve.ModeStrict); strings.Contains(request, "Preserved content") {
+		t.Errorf("BuildRefinePrompt asks to keep content of a prompt without any")
+	}
+}
+
+func TestRefineRequestBudget(t *testing.T) {
+	intro := strings.Repeat("Introduction to prompt engineering. ", 50)
+	userPrompt := `Summarize https://example.com/report and keep "Q3 revenue".`
+	retry := retryInstructions([]preserve.Span{{Text: "https://example.com/report"}})
+	unlimited := &Client{logger: slog.New(slog.DiscardHandler)}
+	full, err := unlimited.refineRequest(intro, "technique", userPrompt, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The budget fits the first request only after trimming the introduction;
+	// the retry must trim it further rather than go over.
+	limit := budget.EstimateTokens(full) - 100
+	c := &Client{options: Options{RefineBudget: limit}, logger: slog.New(slog.DiscardHandler)}
+	first, err := c.refineRequest(intro, "technique", userPrompt, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.refineRequest(intro, "technique", userPrompt, nil, retry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(again, retry) {
+		t.Error("retry request does not end with the retry instructions")
+	}
+	for name, request := range map[string]string{"first": first, "retry": again} {
+		if tokens := budget.EstimateTokens(request); tokens > limit {
+			t.Errorf("%s request uses ~%d tokens, over the budget of %d", name, tokens, limit)
+		}
+	}
+
+	// Retry instructions that leave no room at all are an error.
+	tight := &Client{options: Options{RefineBudget: budget.EstimateTokens(BuildRefinePrompt("", "", userPrompt, nil, "")) + 1}, logger: slog.New(slog.DiscardHandler)}
+	if _, err := tight.refineRequest(intro, "technique", userPrompt, nil, retry); !errors.Is(err, budget.ErrPromptExceedsBudget) {
+		t.Errorf("retry over the budget returned %v, want %v", err, budget.ErrPromptExceedsBudget)
+	}
+}
@@ -0,0 +1,191 @@
+// Package history keeps a local record of enhancement runs, so past prompts
+// and answers can be found, audited and run again.
+//
+// Entries are appended as JSON lines to a single file under the user's data
+// directory, which needs no database and can be inspected with any tool.
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	answers "tokinfo/internal/answers"
+	datadir "tokinfo/internal/datadir"
+	usage "tokinfo/internal/usage"
+)
+
+// Entry records one enhancement run.
+type Entry struct {
+	ID             string             `json:"id"`
+	Time           time.Time          `json:"time"`
+	Command        string             `json:"command"`
+	Prompt         string             `json:"prompt"`
+	PromptSource   string             `json:"promptSource"`
+	GuidelinesPath string             `json:"guidelinesPath"`
+	GuidelinesHash string             `json:"guidelinesHash"`
+	Technique      string             `json:"technique"`
+	Rationale      string             `json:"rationale,omitempty"`
+	Questions      []answers.Question `json:"questions"`
+	EnhancedPrompt string             `json:"enhancedPrompt"`
+	OutputPath     string             `json:"outputPath,omitempty"`
+	Model          string             `json:"model"`
+	Usage          *usage.Report      `json:"usage,omitempty"` // Left out when calls were shared with other prompts
+}
+
+// Answers returns the answers the run gave, keyed by question, leaving out
+// the skipped questions.
+func (e *Entry) Answers() map[string]string {
+	return answers.Map(e.Questions)
+}
+
+// DefaultPath returns the history file under $XDG_DATA_HOME, or
+// ~/.local/share when it is not set.
+func DefaultPath() (string, error) {
+	return datadir.File("history.jsonl")
+}
+
+// Store reads and appends entries to a history file. It is safe for
+// concurrent use within a process.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the store backed by the file at path, which is created on
+// the first Add.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the history file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Add records entry, filling in its ID and time if they are empty.
+func (s *Store) Add(entry *Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.ID == "" {
+		entry.ID = newID(entry.Time)
+	}
+	if entry.Questions == nil {
+		entry.Questions = []answers.Question{} // Encode as [] rather than null
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	// The history holds prompts and answers, so only the user can read it.
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return file.Close()
+}
+
+// List returns every entry, oldest first. Lines that cannot be parsed, such
+// as one cut short by a crash, are skipped.
+func (s *Store) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil && entry.ID != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return entries, nil
+}
+
+// Get returns the entry whose ID is id or starts with it.
+func (s *Store) Get(id string) (*Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var found *Entry
+	for i := range entries {
+		switch {
+		case entries[i].ID == id:
+			return &entries[i], nil
+		case strings.HasPrefix(entries[i].ID, id):
+			if found != nil {
+				return nil, fmt.Errorf("history ID '%s' is ambiguous; give more characters", id)
+			}
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no history entry '%s'", id)
+	}
+	return found, nil
+}
+
+// Search returns the entries, oldest first, whose prompt, enhanced prompt,
+// technique, questions or answers contain query, ignoring case.
+func (s *Store) Search(query string) ([]Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	var matches []Entry
+	for _, entry := range entries {
+		fields := []string{entry.Prompt, entry.EnhancedPrompt, entry.Technique}
+		for _, q := range entry.Questions {
+			fields = append(fields, q.Question, q.Answer)
+		}
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), query) {
+				matches = append(matches, entry)
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// newID returns an ID that sorts by time, with random bits so runs started
+// in the same second do not collide.
+func newID(t time.Time) string {
+	random := make([]byte, 3)
+	rand.Read(random)
+	return t.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(random)
+}
@@ -0,0 +1,250 @@
+// Package judge scores prompts and responses against a rubric with an LLM
+// judge. The scores back quality gates, the ranking of prompt variants and
+// the judge assertions of eval suites.
+package judge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	config "tokinfo/internal/config"
+	gemini "tokinfo/internal/gemini"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Criterion is one line of a rubric.
+type Criterion struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+}
+
+// Default criteria for prompts.
+var (
+	Clarity = Criterion{
+		Name:        "clarity",
+		Description: "The task is stated unambiguously, in plain words, and is easy to follow.",
+	}
+	Specificity = Criterion{
+		Name:        "specificity",
+		Description: "The prompt gives the context, constraints and output format the model needs, without vague verbs.",
+	}
+	IntentPreservation = Criterion{
+		Name:        "intent-preservation",
+		Description: "The enhanced prompt asks for the same thing as the original: no requirement was dropped, added or reinterpreted.",
+	}
+	TechniqueAdherence = Criterion{
+		Name:        "technique-adherence",
+		Description: "The prompt applies the chosen prompt engineering technique as the guidelines describe it.",
+	}
+)
+
+// MinScore and MaxScore bound every score.
+const (
+	MinScore = 1
+	MaxScore = 5
+)
+
+// Score is the score given for one criterion.
+type Score struct {
+	Criterion     string `json:"criterion"`
+	Score         int    `json:"score"`
+	Justification string `json:"justification"`
+}
+
+// Result holds the scores of one judgement.
+type Result struct {
+	Scores  []Score `json:"scores"`
+	Overall float64 `json:"overall"` // Mean of the scores
+	Summary string  `json:"summary"`
+}
+
+// Lowest returns the lowest score of the result.
+func (r *Result) Lowest() int {
+	lowest := MaxScore
+	for _, s := range r.Scores {
+		lowest = min(lowest, s.Score)
+	}
+	return lowest
+}
+
+// Judge scores text with a Gemini client. It is safe for concurrent use.
+type Judge struct {
+	client     *gemini.Client
+	guidelines *config.Guidelines
+}
+
+// New returns a judge using client. The guidelines describe the techniques
+// TechniqueAdherence is judged against.
+func New(client *gemini.Client, guidelines *config.Guidelines) *Judge {
+	return &Judge{client: client, guidelines: guidelines}
+}
+
+// PromptInput is a prompt to score. Original is the prompt before
+// enhancement; when Enhanced is empty, Original itself is scored.
+type PromptInput struct {
+	Original  string
+	Enhanced  string
+	Technique string // Technique the enhancement applied, if any
+}
+
+// PromptCriteria returns the default criteria that apply to input:
+// clarity and specificity always, intent preservation when an enhanced
+// prompt is compared to its original, and technique adherence when the
+// technique is in the guidelines.
+func (j *Judge) PromptCriteria(input PromptInput) []Criterion {
+	criteria := []Criterion{Clarity, Specificity}
+	if input.Enhanced != "" {
+		criteria = append(criteria, IntentPreservation)
+	}
+	if _, found := config.GetTechniqueByName(j.guidelines.Techniques, input.Technique); found && input.Technique != "" {
+		criteria = append(criteria, TechniqueAdherence)
+	}
+	return criteria
+}
+
+// ScorePrompt scores a prompt against criteria, or PromptCriteria(input)
+// when criteria is empty.
+func (j *Judge) ScorePrompt(ctx context.Context, input PromptInput, criteria []Criterion) (*Result, error) {
+	if len(criteria) == 0 {
+		criteria = j.PromptCriteria(input)
+	}
+	var b strings.Builder
+	if input.Enhanced == "" {
+		fmt.Fprintf(&b, "Score the prompt below.\n\n## Prompt\n%s\n", input.Original)
+	} else {
+		fmt.Fprintf(&b, "Score the enhanced prompt below, which was rewritten from the original prompt.\n\n## Original prompt\n%s\n\n## Enhanced prompt\n%s\n", input.Original, input.Enhanced)
+	}
+	if tech, found := config.GetTechniqueByName(j.guidelines.Techniques, input.Technique); found && input.Technique != "" {
+		fmt.Fprintf(&b, "\n## Chosen technique: %s\n%s\n", tech.Name, tech.Complete)
+	}
+	return j.score(ctx, b.String(), criteria)
+}
+
+// ScoreResponse scores response, given for prompt, against criteria.
+func (j *Judge) ScoreResponse(ctx context.Context, prompt string, response string, criteria []Criterion) (*Result, error) {
+	if len(criteria) == 0 {
+		return nil, fmt.Errorf("no criteria to score the response against")
+	}
+	request := fmt.Sprintf("Score the response below, which a model gave for the prompt.\n\n## Prompt\n%s\n\n## Response\n%s\n", prompt, response)
+	return j.score(ctx, request, criteria)
+}
+
+// score asks the judge to score subject against criteria and checks that
+// every criterion got a score in range.
+func (j *Judge) score(ctx context.Context, subject string, criteria []Criterion) (*Result, error) {
+	judgement, err := j.client.Judge(ctx, BuildRequest(subject, criteria))
+	if err != nil {
+		return nil, err
+	}
+	return resultOf(judgement, criteria)
+}
+
+// resultOf checks judgement against criteria, matching criterion names
+// without regard to case, and returns the scores in the order of criteria.
+func resultOf(judgement *gemini.Judgement, criteria []Criterion) (*Result, error) {
+	if len(criteria) == 0 {
+		return nil, fmt.Errorf("no criteria to score against")
+	}
+	byName := make(map[string]gemini.CriterionScore)
+	for _, s := range judgement.Scores {
+		byName[strings.ToLower(strings.TrimSpace(s.Criterion))] = s
+	}
+	result := &Result{Summary: judgement.Summary}
+	total := 0
+	for _, c := range criteria {
+		s, ok := byName[strings.ToLower(strings.TrimSpace(c.Name))]
+		if !ok {
+			return nil, fmt.Errorf("judge did not score criterion '%s'", c.Name)
+		}
+		if s.Score < MinScore || s.Score > MaxScore {
+			return nil, fmt.Errorf("judge scored criterion '%s' %d, outside %d-%d", c.Name, s.Score, MinScore, MaxScore)
+		}
+		result.Scores = append(result.Scores, Score{Criterion: c.Name, Score: s.Score, Justification: s.Justification})
+		total += s.Score
+	}
+	result.Overall = float64(total) / float64(len(criteria))
+	return result, nil
+}
+
+// BuildRequest renders the judge request for subject and criteria.
+func BuildRequest(subject string, criteria []Criterion) string {
+	var b strings.Builder
+	b.WriteString(subject)
+	b.WriteString("\n## Rubric\n")
+	for _, c := range criteria {
+		fmt.Fprintf(&b, "- %s: %s\n", c.Name, c.Description)
+	}
+	fmt.Fprintf(&b, `
+## Instructions
+- Return one entry in "scores" for every criterion of the rubric, with "criterion" set to its name exactly as written.
+- Set "score" from %d (does not meet the criterion at all) to %d (fully meets it). Be strict: reserve %d for text with no room for improvement.
+- Set "justification" to one or two sentences citing the text.
+- Set "summary" to one sentence on the overall quality.
+`, MinScore, MaxScore, MaxScore)
+	return b.String()
+}
+
+// LoadCriteria reads a rubric from a JSON or YAML file listing criteria,
+// for example:
+//
+//	[{"name": "tone", "description": "The prompt asks for a friendly, informal tone."}]
+func LoadCriteria(path string) ([]Criterion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read criteria file '%s': %w", path, err)
+	}
+	var criteria []Criterion
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&criteria)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&criteria)
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse criteria file '%s': %w", path, err)
+	}
+	if len(criteria) == 0 {
+		return nil, fmt.Errorf("criteria file '%s' lists no criteria", path)
+	}
+	seen := make(map[string]bool)
+	for _, c := range criteria {
+		if c.Name == "" || c.Description == "" {
+			return nil, fmt.Errorf("criteria file '%s': every criterion needs a name and a description", path)
+		}
+		if seen[strings.ToLower(c.Name)] {
+			return nil, fmt.Errorf("criteria file '%s': duplicate criterion '%s'", path, c.Name)
+		}
+		seen[strings.ToLower(c.Name)] = true
+	}
+	return criteria, nil
+}
+
+// WriteText prints the scores as a table to w.
+func (r *Result) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, s := range r.Scores {
+		fmt.Fprintf(&b, "%-22s %d/%d  %s\n", s.Criterion, s.Score, MaxScore, s.Justification)
+	}
+	fmt.Fprintf(&b, "%-22s %.1f/%d", "overall", r.Overall, MaxScore)
+	if r.Summary != "" {
+		fmt.Fprintf(&b, "  %s", r.Summary)
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write judge scores: %w", err)
+	}
+	return nil
+}
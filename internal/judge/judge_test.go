@@ -0,0 +1,190 @@
+package judge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gemini "tokinfo/internal/gemini"
+)
+
+func TestResultOf(t *testing.T) {
+	criteria := []Criterion{Clarity, Specificity}
+	tests := []struct {
+		name    string
+		scores  []gemini.CriterionScore
+		want    []int   // Scores in the order of criteria
+		overall float64 // Checked when want is set
+		err     string  // Expected error fragment, if any
+	}{
+		{
+			name:    "all criteria",
+			scores:  []gemini.CriterionScore{{Criterion: "clarity", Score: 4}, {Criterion: "specificity", Score: 3}},
+			want:    []int{4, 3},
+			overall: 3.5,
+		},
+		{
+			name:    "names differ in case and spacing",
+			scores:  []gemini.CriterionScore{{Criterion: " Specificity ", Score: 2}, {Criterion: "CLARITY", Score: 5}},
+			want:    []int{5, 2},
+			overall: 3.5,
+		},
+		{
+			name:    "extra criteria are ignored",
+			scores:  []gemini.CriterionScore{{Criterion: "clarity", Score: 1}, {Criterion: "specificity", Score: 1}, {Criterion: "tone", Score: 5}},
+			want:    []int{1, 1},
+			overall: 1,
+		},
+		{
+			name:   "missing criterion",
+			scores: []gemini.CriterionScore{{Criterion: "clarity", Score: 4}},
+			err:    "did not score criterion 'specificity'",
+		},
+		{
+			name:   "score below range",
+			scores: []gemini.CriterionScore{{Criterion: "clarity", Score: 0}, {Criterion: "specificity", Score: 3}},
+			err:    "scored criterion 'clarity' 0, outside 1-5",
+		},
+		{
+			name:   "score above range",
+			scores: []gemini.CriterionScore{{Criterion: "clarity", Score: 3}, {Criterion: "specificity", Score: 6}},
+			err:    "scored criterion 'specificity' 6, outside 1-5",
+		},
+		{
+			name: "no scores",
+			err:  "did not score criterion 'clarity'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := resultOf(&gemini.Judgement{Scores: tt.scores, Summary: "fine"}, criteria)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("resultOf error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Scores) != len(tt.want) {
+				t.Fatalf("resultOf returned %d scores, want %d", len(result.Scores), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if result.Scores[i].Criterion != criteria[i].Name || result.Scores[i].Score != want {
+					t.Errorf("score %d = %s %d, want %s %d", i, result.Scores[i].Criterion, result.Scores[i].Score, criteria[i].Name, want)
+				}
+			}
+			if result.Overall != tt.overall {
+				t.Errorf("Overall = %v, want %v", result.Overall, tt.overall)
+			}
+			if result.Summary != "fine" {
+				t.Errorf("Summary = %q, want the judgement's", result.Summary)
+			}
+		})
+	}
+}
+
+func TestResultOfNoCriteria(t *testing.T) {
+	if _, err := resultOf(&gemini.Judgement{}, nil); err == nil {
+		t.Error("resultOf with no criteria succeeded, want an error")
+	}
+}
+
+func TestLowest(t *testing.T) {
+	result := &Result{Scores: []Score{{Score: 4}, {Score: 2}, {Score: 5}}}
+	if got := result.Lowest(); got != 2 {
+		t.Errorf("Lowest = %d, want 2", got)
+	}
+}
+
+func TestLoadCriteria(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string // Criterion names
+		err     string
+	}{
+		{
+			name:    "json",
+			file:    "rubric.json",
+			content: `[{"name": "tone", "description": "Friendly."}, {"name": "length", "description": "Short."}]`,
+			want:    []string{"tone", "length"},
+		},
+		{
+			name:    "yaml",
+			file:    "rubric.yaml",
+			content: "- name: tone\n  description: Friendly.\n",
+			want:    []string{"tone"},
+		},
+		{
+			name:    "empty yaml",
+			file:    "rubric.yaml",
+			content: "",
+			err:     "lists no criteria",
+		},
+		{
+			name:    "empty json list",
+			file:    "rubric.json",
+			content: "[]",
+			err:     "lists no criteria",
+		},
+		{
+			name:    "duplicate ignoring case",
+			file:    "rubric.yaml",
+			content: "- name: tone\n  description: Friendly.\n- name: Tone\n  description: Formal.\n",
+			err:     "duplicate criterion 'Tone'",
+		},
+		{
+			name:    "missing description",
+			file:    "rubric.json",
+			content: `[{"name": "tone"}]`,
+			err:     "needs a name and a description",
+		},
+		{
+			name:    "unknown field",
+			file:    "rubric.json",
+			content: `[{"name": "tone", "description": "Friendly.", "weight": 2}]`,
+			err:     "failed to parse",
+		},
+		{
+			name:    "unknown yaml field",
+			file:    "rubric.yml",
+			content: "- name: tone\n  desc: Friendly.\n",
+			err:     "failed to parse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			criteria, err := LoadCriteria(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadCriteria error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range criteria {
+				names = append(names, c.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("LoadCriteria names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCriteriaMissingFile(t *testing.T) {
+	if _, err := LoadCriteria(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadCriteria of a missing file succeeded, want an error")
+	}
+}
@@ -0,0 +1,290 @@
+// Package library stores named prompts with their versions as plain files,
+// so a library can be reviewed and committed to git like any other source.
+//
+// Every prompt is a directory holding one file per version and a
+// prompt.yaml file with its description, tags and version history:
+//
+//	library/
+//	  support-reply/
+//	    prompt.yaml
+//	    v1.md
+//	    v2.md
+package library
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDir is the library directory used when none is given, relative to
+// the working directory like guidelines.json.
+const DefaultDir = "library"
+
+// metadataFile is the name of the metadata file of every prompt.
+const metadataFile = "prompt.yaml"
+
+// validName matches prompt names, which are also directory names.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Version is one saved version of a prompt.
+type Version struct {
+	Version        int       `yaml:"version" json:"version"`
+	File           string    `yaml:"file" json:"file"`
+	Created        time.Time `yaml:"created" json:"created"`
+	Note           string    `yaml:"note,omitempty" json:"note,omitempty"`
+	Technique      string    `yaml:"technique,omitempty" json:"technique,omitempty"`           // Technique that produced an enhanced version
+	EnhancedFrom   int       `yaml:"enhancedFrom,omitempty" json:"enhancedFrom,omitempty"`     // Version an enhanced version was refined from
+	GuidelinesHash string    `yaml:"guidelinesHash,omitempty" json:"guidelinesHash,omitempty"` // Guidelines an enhanced version was refined with
+}
+
+// Prompt is a named prompt and its versions, oldest first.
+type Prompt struct {
+	Name        string    `yaml:"name" json:"name"`
+	Description string    `yaml:"description,omitempty" json:"description,omitempty"`
+	Tags        []string  `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Versions    []Version `yaml:"versions" json:"versions"`
+}
+
+// Latest returns the newest version of p.
+func (p *Prompt) Latest() Version {
+	return p.Versions[len(p.Versions)-1]
+}
+
+// Version returns version n of p.
+func (p *Prompt) Version(n int) (Version, bool) {
+	for _, v := range p.Versions {
+		if v.Version == n {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// HasTag reports whether p is tagged tag, ignoring case.
+func (p *Prompt) HasTag(tag string) bool {
+	return slices.ContainsFunc(p.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+// ParseRef splits a reference such as "name" or "name@v3" into the prompt
+// name and the version number, which is 0 when the reference names the
+// latest version.
+func ParseRef(ref string) (name string, version int, err error) {
+	name, v, found := strings.Cut(ref, "@")
+	if !validName.MatchString(name) {
+		return "", 0, fmt.Errorf("invalid prompt name '%s' (use letters, digits, '.', '_' and '-')", name)
+	}
+	if !found {
+		return name, 0, nil
+	}
+	version, err = strconv.Atoi(strings.TrimPrefix(v, "v"))
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("invalid version '%s' in '%s' (expected e.g. %s@v2)", v, ref, name)
+	}
+	return name, version, nil
+}
+
+// Library is a directory of prompts.
+type Library struct {
+	dir string
+}
+
+// Open returns the library in dir, which is created on the first Save.
+func Open(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// Dir returns the library directory.
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Load reads the metadata of the prompt name.
+func (l *Library) Load(name string) (*Prompt, error) {
+	path := filepath.Join(l.dir, name, metadataFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no prompt '%s' in library '%s'", name, l.dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	var p Prompt
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	if len(p.Versions) == 0 {
+		return nil, fmt.Errorf("'%s' lists no versions", path)
+	}
+	p.Name = name // The directory name wins over a hand-edited name
+	return &p, nil
+}
+
+// List returns every prompt of the library, sorted by name.
+func (l *Library) List() ([]*Prompt, error) {
+	entries, err := os.ReadDir(l.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read library '%s': %w", l.dir, err)
+	}
+	var prompts []*Prompt
+	for _, entry := range entries {
+		if !entry.IsDir() || !validName.MatchString(entry.Name()) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(l.dir, entry.Name(), metadataFile)); err != nil {
+			continue // Not a prompt directory
+		}
+		p, err := l.Load(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+// Get returns the prompt and version ref names, with the version's text.
+func (l *Library) Get(ref string) (*Prompt, Version, string, error) {
+	name, n, err := ParseRef(ref)
+	if err != nil {
+		return nil, Version{}, "", err
+	}
+	p, err := l.Load(name)
+	if err != nil {
+		return nil, Version{}, "", err
+	}
+	v := p.Latest()
+	if n != 0 {
+		var found bool
+		if v, found = p.Version(n); !found {
+			return nil, Version{}, "", fmt.Errorf("prompt '%s' has no version %d (latest is %d)", name, n, p.Latest().Version)
+		}
+	}
+	text, err := l.Text(p, v)
+	if err != nil {
+		return nil, Version{}, "", err
+	}
+	return p, v, text, nil
+}
+
+// Text reads the text of version v of p.
+func (l *Library) Text(p *Prompt, v Version) (string, error) {
+	path := filepath.Join(l.dir, p.Name, v.File)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read version %d of '%s': %w", v.Version, p.Name, err)
+	}
+	return string(data), nil
+}
+
+// Find returns the newest version of the prompt name whose text is text.
+// The boolean is false if there is none, or if the prompt does not exist.
+func (l *Library) Find(name string, text string) (Version, bool, error) {
+	p, err := l.Load(name)
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(l.dir, name, metadataFile)); errors.Is(statErr, fs.ErrNotExist) {
+			return Version{}, false, nil
+		}
+		return Version{}, false, err
+	}
+	for i := len(p.Versions) - 1; i >= 0; i-- {
+		current, err := l.Text(p, p.Versions[i])
+		if err != nil {
+			return Version{}, false, err
+		}
+		if current == text {
+			return p.Versions[i], true, nil
+		}
+	}
+	return Version{}, false, nil
+}
+
+// Update holds the changes Save makes to a prompt's metadata. Empty fields
+// leave the metadata as it is.
+type Update struct {
+	Description string
+	Tags        []string // Added to the existing tags
+}
+
+// Save stores text as a new version of the prompt name, creating the prompt
+// if needed, and applies update to its metadata. When text is the same as
+// the latest version, no version is added and the latest is returned with
+// false. Version and File of v are assigned by Save; its Created time is
+// filled in if zero.
+func (l *Library) Save(name string, text string, v Version, update Update) (Version, bool, error) {
+	if !validName.MatchString(name) {
+		return Version{}, false, fmt.Errorf("invalid prompt name '%s' (use letters, digits, '.', '_' and '-')", name)
+	}
+	p, err := l.Load(name)
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(l.dir, name, metadataFile)); !errors.Is(statErr, fs.ErrNotExist) {
+			return Version{}, false, err
+		}
+		p = &Prompt{Name: name}
+	}
+
+	if update.Description != "" {
+		p.Description = update.Description
+	}
+	for _, tag := range update.Tags {
+		if !p.HasTag(tag) {
+			p.Tags = append(p.Tags, tag)
+		}
+	}
+
+	added := true
+	if len(p.Versions) > 0 {
+		latest := p.Latest()
+		current, err := l.Text(p, latest)
+		if err != nil {
+			return Version{}, false, err
+		}
+		if current == text {
+			v, added = latest, false
+		}
+	}
+	dir := filepath.Join(l.dir, name)
+	if added {
+		v.Version = 1
+		if len(p.Versions) > 0 {
+			v.Version = p.Latest().Version + 1
+		}
+		v.File = fmt.Sprintf("v%d.md", v.Version)
+		if v.Created.IsZero() {
+			v.Created = time.Now().UTC().Truncate(time.Second)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return Version{}, false, fmt.Errorf("failed to create prompt directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, v.File), []byte(text), 0644); err != nil {
+			return Version{}, false, fmt.Errorf("failed to write version %d of '%s': %w", v.Version, name, err)
+		}
+		p.Versions = append(p.Versions, v)
+	}
+
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(p); err != nil {
+		return Version{}, false, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, metadataFile), data.Bytes(), 0644); err != nil {
+		return Version{}, false, fmt.Errorf("failed to write metadata of '%s': %w", name, err)
+	}
+	return v, added, nil
+}
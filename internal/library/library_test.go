@@ -0,0 +1,131 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		version int
+		ok      bool
+	}{
+		{"support-reply", "support-reply", 0, true},
+		{"support-reply@v3", "support-reply", 3, true},
+		{"support-reply@3", "support-reply", 3, true},
+		{"a.b_c", "a.b_c", 0, true},
+		{"support-reply@v0", "", 0, false},
+		{"support-reply@latest", "", 0, false},
+		{"support-reply@", "", 0, false},
+		{"../secrets", "", 0, false},
+		{"-flag", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, version, err := ParseRef(tt.ref)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseRef(%q) error = %v, want ok %v", tt.ref, err, tt.ok)
+			continue
+		}
+		if name != tt.name || version != tt.version {
+			t.Errorf("ParseRef(%q) = %q, %d; want %q, %d", tt.ref, name, version, tt.name, tt.version)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	lib := Open(filepath.Join(t.TempDir(), "library"))
+	steps := []struct {
+		text        string
+		update      Update
+		wantVersion int
+		wantAdded   bool
+	}{
+		{"first", Update{Description: "Replies", Tags: []string{"support"}}, 1, true},
+		{"first", Update{}, 1, false},
+		{"second", Update{Tags: []string{"Support", "email"}}, 2, true},
+		{"first", Update{}, 3, true}, // Going back to an older text is a new version
+	}
+	for i, s := range steps {
+		v, added, err := lib.Save("reply", s.text, Version{Note: "note"}, s.update)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if v.Version != s.wantVersion || added != s.wantAdded {
+			t.Errorf("step %d: Save = version %d, added %v; want %d, %v", i, v.Version, added, s.wantVersion, s.wantAdded)
+		}
+	}
+
+	p, err := lib.Load("reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Description != "Replies" || !slices.Equal(p.Tags, []string{"support", "email"}) {
+		t.Errorf("metadata = %q, %v; want the first description and tags without case duplicates", p.Description, p.Tags)
+	}
+	if len(p.Versions) != 3 || p.Latest().File != "v3.md" || p.Latest().Created.IsZero() {
+		t.Errorf("versions = %+v, want 3 with files and creation times", p.Versions)
+	}
+	_, v, text, err := lib.Get("reply@v2")
+	if err != nil || v.Version != 2 || text != "second" {
+		t.Errorf("Get(reply@v2) = %d, %q, %v; want 2, %q", v.Version, text, err, "second")
+	}
+	if _, _, _, err := lib.Get("reply@v4"); err == nil {
+		t.Error("Get of a missing version succeeded, want an error")
+	}
+}
+
+func TestSaveInvalidName(t *testing.T) {
+	lib := Open(t.TempDir())
+	if _, _, err := lib.Save("../escape", "text", Version{}, Update{}); err == nil {
+		t.Error("Save with an invalid name succeeded, want an error")
+	}
+}
+
+func TestSaveCorruptMetadata(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "reply"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "reply", metadataFile), []byte("unknown: field\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A prompt that exists but cannot be read must not be replaced.
+	if _, _, err := Open(dir).Save("reply", "text", Version{}, Update{}); err == nil {
+		t.Error("Save over unreadable metadata succeeded, want an error")
+	}
+}
+
+func TestFind(t *testing.T) {
+	lib := Open(t.TempDir())
+	if _, found, err := lib.Find("reply", "first"); found || err != nil {
+		t.Fatalf("Find in a missing prompt = %v, %v; want false, nil", found, err)
+	}
+	for _, text := range []string{"first", "second", "first"} {
+		if _, _, err := lib.Save("reply", text, Version{}, Update{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		text  string
+		want  int
+		found bool
+	}{
+		{"first", 3, true}, // The newest match
+		{"second", 2, true},
+		{"third", 0, false},
+	}
+	for _, tt := range tests {
+		v, found, err := lib.Find("reply", tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != tt.found || v.Version != tt.want {
+			t.Errorf("Find(%q) = version %d, %v; want %d, %v", tt.text, v.Version, found, tt.want, tt.found)
+		}
+	}
+}
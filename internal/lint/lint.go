@@ -0,0 +1,394 @@
+// Package lint checks prompts with offline heuristics, so common problems
+// are caught before spending a Gemini call.
+//
+// The checks follow the guidelines' elements of a prompt (instruction,
+// context, input data and output indicator) and flag vague verbs,
+// conflicting instructions, unbalanced delimiters and excessive length.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	budget "tokinfo/internal/budget"
+)
+
+// Severity ranks findings.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// MarshalText encodes the severity by name in JSON output.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity returns the severity with the given name.
+func ParseSeverity(name string) (Severity, error) {
+	switch name {
+	case "error":
+		return Error, nil
+	case "warning":
+		return Warning, nil
+	case "info":
+		return Info, nil
+	default:
+		return Info, fmt.Errorf("unknown severity '%s' (expected error, warning or info)", name)
+	}
+}
+
+// Rule names, used to report and disable checks.
+const (
+	RuleEmpty               = "empty"
+	RuleMissingInstruction  = "missing-instruction"
+	RuleMissingContext      = "missing-context"
+	RuleMissingInputData    = "missing-input-data"
+	RuleMissingOutputFormat = "missing-output-format"
+	RuleVagueVerb           = "vague-verb"
+	RuleConflict            = "conflicting-instructions"
+	RuleUnbalanced          = "unbalanced-delimiter"
+	RuleTooLong             = "too-long"
+)
+
+// Rules lists every rule name.
+var Rules = []string{
+	RuleEmpty, RuleMissingInstruction, RuleMissingContext, RuleMissingInputData, RuleMissingOutputFormat,
+	RuleVagueVerb, RuleConflict, RuleUnbalanced, RuleTooLong,
+}
+
+// Finding is a problem found in a prompt. Start and End are byte offsets
+// into the prompt; Line and Column (1-based, counted in characters) locate Start.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+}
+
+// Options configure the checks. The zero value runs every rule with the
+// default length limit.
+type Options struct {
+	// MaxTokens is the estimated token count above which a prompt is too
+	// long (default 2000).
+	MaxTokens int
+	// Disabled holds the names of rules to skip.
+	Disabled map[string]bool
+}
+
+// DefaultMaxTokens is the length limit used when Options.MaxTokens is zero.
+const DefaultMaxTokens = 2000
+
+// Lint checks text and returns its findings ordered by position.
+func Lint(text string, options Options) []Finding {
+	if options.MaxTokens <= 0 {
+		options.MaxTokens = DefaultMaxTokens
+	}
+	l := &linter{text: text, options: options}
+
+	if strings.TrimSpace(text) == "" {
+		l.add(RuleEmpty, Error, 0, len(text), "the prompt is empty")
+		return l.findings
+	}
+	l.checkElements()
+	l.checkVagueVerbs()
+	l.checkConflicts()
+	l.checkDelimiters()
+	l.checkLength()
+
+	sort.SliceStable(l.findings, func(i, j int) bool { return l.findings[i].Start < l.findings[j].Start })
+	return l.findings
+}
+
+// linter accumulates the findings for one prompt.
+type linter struct {
+	text     string
+	options  Options
+	findings []Finding
+}
+
+// add records a finding unless its rule is disabled.
+func (l *linter) add(rule string, severity Severity, start int, end int, format string, args ...any) {
+	if l.options.Disabled[rule] {
+		return
+	}
+	line, column := 1, 1
+	for _, r := range l.text[:start] {
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	l.findings = append(l.findings, Finding{
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Start:    start,
+		End:      end,
+		Line:     line,
+		Column:   column,
+	})
+}
+
+// words compiles a case-insensitive pattern matching any of the phrases as whole words.
+func words(phrases ...string) *regexp.Regexp {
+	quoted := make([]string, len(phrases))
+	for i, phrase := range phrases {
+		quoted[i] = strings.ReplaceAll(regexp.QuoteMeta(phrase), `\ `, `\s+`)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// --- Elements of a Prompt ---
+
+var (
+	// instructionVerbs are commands that state the task, as in the
+	// guidelines' "Write", "Classify", "Summarize", "Translate".
+	instructionVerbs = words(
+		"write", "classify", "summarize", "summarise", "translate", "order", "sort", "list", "explain", "describe",
+		"generate", "create", "extract", "answer", "rewrite", "compare", "analyze", "analyse", "draft", "review",
+		"identify", "convert", "suggest", "recommend", "evaluate", "design", "plan", "outline", "find", "give",
+		"provide", "tell", "show", "calculate", "solve", "implement", "refactor", "produce", "compose", "edit",
+		"proofread", "predict", "categorize", "label", "tag", "detect", "assess", "propose", "build", "define",
+	)
+	// contextCues introduce background, a role or an audience.
+	contextCues = words(
+		"you are", "act as", "as a", "as an", "context", "background", "audience", "for a", "for an", "for my",
+		"for our", "we are", "i am", "i'm", "our team", "our company", "the goal", "in order to", "because",
+		"given that", "assume", "persona", "role",
+	)
+	// inputCues mark the data the instruction applies to.
+	inputCues = regexp.MustCompile("(?im)```|\"\"\"|'''|<[a-z][\\w-]*>|^\\s*(?:text|input|data|question|document|article|code|email|review|context)\\s*:|\\bthe following\\b|\\bbelow\\b|\\bhere is\\b|\\bhere are\\b")
+	// outputCues describe the type or format of the output.
+	outputCues = words(
+		"format", "json", "yaml", "csv", "xml", "markdown", "table", "list", "bullet", "bullets", "bullet points",
+		"numbered", "paragraph", "paragraphs", "sentence", "sentences", "words", "characters", "lines", "heading",
+		"headings", "section", "sections", "output", "respond with", "reply with", "return", "answer with",
+		"in the form of", "template", "schema", "code block", "haiku", "poem", "essay", "email", "tweet",
+	)
+	// outputIndicatorLine matches a trailing label such as "Sentiment:" that
+	// the model is meant to complete.
+	outputIndicatorLine = regexp.MustCompile(`(?m)^[^\n:]{1,40}:\s*\z`)
+)
+
+// checkElements reports missing elements of a prompt. The guidelines note
+// that not every prompt needs all four, so only a missing instruction or
+// output format is a warning.
+func (l *linter) checkElements() {
+	end := len(strings.TrimRight(l.text, " \t\r\n"))
+	if !instructionVerbs.MatchString(l.text) && !strings.Contains(l.text, "?") {
+		l.add(RuleMissingInstruction, Warning, 0, end, "no instruction found; start with a command such as \"Write\", \"Classify\" or \"Summarize\", or ask a question")
+	}
+	if !contextCues.MatchString(l.text) {
+		l.add(RuleMissingContext, Info, 0, end, "no context found; consider stating the audience, a role or the background of the task")
+	}
+	if !inputCues.MatchString(l.text) {
+		l.add(RuleMissingInputData, Info, 0, end, "no delimited input data found; if the task applies to some text, mark it with a label such as \"Text:\" or delimiters such as ```")
+	}
+	if !outputCues.MatchString(l.text) && !outputIndicatorLine.MatchString(l.text) {
+		l.add(RuleMissingOutputFormat, Warning, 0, end, "no output format found; say what the answer should look like (for example a list, JSON or a length)")
+	}
+}
+
+// --- Vague Verbs ---
+
+// vagueVerbs name an action without saying what result is wanted.
+var vagueVerbs = words(
+	"improve", "enhance", "optimize", "optimise", "handle", "deal with", "work on", "look at", "look into",
+	"help with", "help me with", "make better", "make it better", "fix up", "clean up", "tweak", "polish",
+	"process", "manage", "do something", "take care of",
+)
+
+// checkVagueVerbs flags every vague verb.
+func (l *linter) checkVagueVerbs() {
+	for _, loc := range vagueVerbs.FindAllStringIndex(l.text, -1) {
+		verb := l.text[loc[0]:loc[1]]
+		l.add(RuleVagueVerb, Warning, loc[0], loc[1], "vague verb \"%s\"; say what the result should be instead", verb)
+	}
+}
+
+// --- Conflicting Instructions ---
+
+// conflicts are pairs of instructions that cannot both be followed.
+var conflicts = []struct {
+	a, b *regexp.Regexp
+	what string
+}{
+	{words("brief", "briefly", "short", "concise", "concisely", "succinct", "one sentence", "one line", "in a few words"), words("detailed", "in detail", "in depth", "in-depth", "comprehensive", "thorough", "thoroughly", "exhaustive", "elaborate", "long"), "length"},
+	{words("formal", "formally", "professional"), words("informal", "casual", "casually", "slang", "playful"), "tone"},
+	{words("json"), words("markdown", "plain text", "prose", "table", "yaml", "csv"), "output format"},
+	{words("bullet", "bullets", "bullet points", "list"), words("single paragraph", "one paragraph", "prose", "no lists", "no bullet points"), "structure"},
+	{words("include examples", "with examples", "give examples"), words("no examples", "without examples", "do not include examples", "don't include examples"), "examples"},
+}
+
+// checkConflicts reports the later of two conflicting instructions.
+func (l *linter) checkConflicts() {
+	for _, c := range conflicts {
+		a, b := c.a.FindStringIndex(l.text), c.b.FindStringIndex(l.text)
+		if a == nil || b == nil {
+			continue
+		}
+		first, second := a, b
+		if b[0] < a[0] {
+			first, second = b, a
+		}
+		line := strings.Count(l.text[:first[0]], "\n") + 1
+		l.add(RuleConflict, Warning, second[0], second[1], "\"%s\" conflicts with \"%s\" on line %d (%s)", l.text[second[0]:second[1]], l.text[first[0]:first[1]], line, c.what)
+	}
+}
+
+// --- Delimiters ---
+
+var (
+	// xmlTag matches an opening or closing XML-like tag used as a delimiter.
+	xmlTag = regexp.MustCompile(`<(/?)([a-zA-Z][\w-]*)(?:\s[^<>]*)?>`)
+	// codeFence matches a ``` fence at the start of a line.
+	codeFence = regexp.MustCompile("(?m)^\\s*```")
+	// listMarker matches the label of a list item such as "1)" or "a)".
+	listMarker = regexp.MustCompile(`^[0-9a-zA-Z]{1,3}$`)
+)
+
+// checkDelimiters reports unclosed code fences, triple quotes, brackets,
+// double quotes and XML-like tags. Brackets and quotes inside code fences
+// are not checked, since code has its own rules.
+func (l *linter) checkDelimiters() {
+	fences := codeFence.FindAllStringIndex(l.text, -1)
+	if len(fences)%2 == 1 {
+		last := fences[len(fences)-1]
+		l.add(RuleUnbalanced, Error, last[0], last[1], "code fence ``` is never closed")
+	}
+	// Blank out fenced code, keeping offsets, for the checks below.
+	blanked := []byte(l.text)
+	for i := 0; i+1 < len(fences); i += 2 {
+		for k := fences[i][0]; k < fences[i+1][1]; k++ {
+			if blanked[k] != '\n' {
+				blanked[k] = ' '
+			}
+		}
+	}
+	prose := string(blanked)
+
+	for _, quote := range []string{`"""`, `'''`} {
+		if n := strings.Count(prose, quote); n%2 == 1 {
+			last := strings.LastIndex(prose, quote)
+			l.add(RuleUnbalanced, Error, last, last+len(quote), "%s is never closed", quote)
+		}
+		prose = strings.ReplaceAll(prose, quote, "   ")
+	}
+
+	// Brackets must nest.
+	pairs := map[byte]byte{')': '(', ']': '[', '}': '{'}
+	var stack []int
+	for i := 0; i < len(prose); i++ {
+		switch c := prose[i]; c {
+		case '(', '[', '{':
+			stack = append(stack, i)
+		case ')', ']', '}':
+			if len(stack) > 0 && prose[stack[len(stack)-1]] == pairs[c] {
+				stack = stack[:len(stack)-1]
+			} else if !isListMarker(prose, i) {
+				l.add(RuleUnbalanced, Error, i, i+1, "\"%c\" has no matching \"%c\"", c, pairs[c])
+			}
+		}
+	}
+	for _, i := range stack {
+		l.add(RuleUnbalanced, Error, i, i+1, "\"%c\" is never closed", prose[i])
+	}
+
+	// Straight double quotes come in pairs; curly ones must open before they close.
+	if strings.Count(prose, `"`)%2 == 1 {
+		last := strings.LastIndexByte(prose, '"')
+		l.add(RuleUnbalanced, Warning, last, last+1, "odd number of double quotes; one is never closed")
+	}
+	if open, closed := strings.Count(prose, "“"), strings.Count(prose, "”"); open != closed {
+		i := strings.LastIndex(prose, "“")
+		if closed > open {
+			i = strings.LastIndex(prose, "”")
+		}
+		l.add(RuleUnbalanced, Warning, i, i+len("“"), "%d opening and %d closing curly quotes", open, closed)
+	}
+
+	// XML-like tags must be closed in order. A tag whose name is never
+	// closed is not a delimiter but a placeholder such as "Replace <name>"
+	// or a type such as "Vec<String>", so it is not checked.
+	type tag struct {
+		name  string
+		start int
+		end   int
+	}
+	tags := xmlTag.FindAllStringSubmatchIndex(prose, -1)
+	closed := make(map[string]bool)
+	for _, m := range tags {
+		if m[3] > m[2] {
+			closed[strings.ToLower(prose[m[4]:m[5]])] = true
+		}
+	}
+	var open []tag
+	for _, m := range tags {
+		name := strings.ToLower(prose[m[4]:m[5]])
+		if prose[m[1]-2] == '/' {
+			continue // Self-closing, such as <br/>
+		}
+		if m[3] == m[2] && !closed[name] {
+			continue
+		}
+		if m[3] > m[2] { // Closing tag
+			k := len(open) - 1
+			for k >= 0 && open[k].name != name {
+				k--
+			}
+			if k < 0 {
+				l.add(RuleUnbalanced, Error, m[0], m[1], "closing tag </%s> has no opening tag", name)
+				continue
+			}
+			for _, unclosed := range open[k+1:] {
+				l.add(RuleUnbalanced, Error, unclosed.start, unclosed.end, "tag <%s> is never closed", unclosed.name)
+			}
+			open = open[:k]
+			continue
+		}
+		open = append(open, tag{name: name, start: m[0], end: m[1]})
+	}
+	for _, unclosed := range open {
+		l.add(RuleUnbalanced, Error, unclosed.start, unclosed.end, "tag <%s> is never closed", unclosed.name)
+	}
+}
+
+// isListMarker reports whether the closing parenthesis at i ends a list
+// marker such as "1)" or "a)" at the start of a line.
+func isListMarker(text string, i int) bool {
+	if text[i] != ')' {
+		return false
+	}
+	lineStart := strings.LastIndexByte(text[:i], '\n') + 1
+	return listMarker.MatchString(strings.TrimSpace(text[lineStart:i]))
+}
+
+// --- Length ---
+
+// checkLength reports prompts above the token limit.
+func (l *linter) checkLength() {
+	if tokens := budget.EstimateTokens(l.text); tokens > l.options.MaxTokens {
+		l.add(RuleTooLong, Warning, 0, len(l.text), "the prompt is about %d tokens, above the limit of %d; consider splitting the task or trimming context", tokens, l.options.MaxTokens)
+	}
+}
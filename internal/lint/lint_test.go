@@ -0,0 +1,122 @@
+package lint
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// messages returns the messages of the findings of rule in text.
+func messages(text string, rule string) []string {
+	var found []string
+	for _, f := range Lint(text, Options{}) {
+		if f.Rule == rule {
+			found = append(found, f.Message)
+		}
+	}
+	return found
+}
+
+func TestDelimiters(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"balanced", "Summarize the text (briefly).\n<article>\nText\n</article>", nil},
+		{"unclosed bracket", "Summarize the text (briefly.", []string{`"(" is never closed`}},
+		{"unmatched bracket", "Summarize the text briefly).", []string{`")" has no matching "("`}},
+		{"list markers", "Do this:\n1) Read\na) Write", nil},
+		{"brackets in code are ignored", "Fix this:\n```\nif (x {\n```", nil},
+		{"unclosed code fence", "Fix this:\n```\nif x {}", []string{"code fence ``` is never closed"}},
+		{"odd double quotes", `Say "hello`, []string{"odd number of double quotes; one is never closed"}},
+		{"unclosed tag", "<article>\nText\n</article>\n<article>\nMore", []string{"tag <article> is never closed"}},
+		{"misnested tags", "<a><b>Text</a></b>", []string{"tag <b> is never closed", "closing tag </b> has no opening tag"}},
+		{"stray closing tag", "Text</article>", []string{"closing tag </article> has no opening tag"}},
+		{"self-closing tag", "Line one<br/>line two", nil},
+		{"placeholder", "Replace <name> with the customer name and write a greeting.", nil},
+		{"generic type", "Explain why Vec<String> and HashMap<K, V> need an allocator.", nil},
+		{"placeholder next to delimiters", "Write to <name>.\n<email>\nHi\n</email>", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messages(tt.text, RuleUnbalanced)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("unbalanced-delimiter findings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElements(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		rule string
+		want bool
+	}{
+		{"instruction", "Summarize the article.", RuleMissingInstruction, false},
+		{"question", "Why is the sky blue?", RuleMissingInstruction, false},
+		{"no instruction", "The sky is blue.", RuleMissingInstruction, true},
+		{"output format", "Summarize the article in three bullet points.", RuleMissingOutputFormat, false},
+		{"output indicator", "Classify the review.\nReview: great\nSentiment:", RuleMissingOutputFormat, false},
+		{"no output format", "Summarize the article.", RuleMissingOutputFormat, true},
+		{"context", "You are a tax advisor. Summarize the article.", RuleMissingContext, false},
+		{"input data", "Summarize the text below.", RuleMissingInputData, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(messages(tt.text, tt.rule)) > 0; got != tt.want {
+				t.Errorf("%s reported = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		findings := Lint(" \n", Options{})
+		if len(findings) != 1 || findings[0].Rule != RuleEmpty || findings[0].Severity != Error {
+			t.Errorf("Lint of an empty prompt = %+v", findings)
+		}
+	})
+	t.Run("disabled rule", func(t *testing.T) {
+		findings := Lint("The sky is blue.", Options{Disabled: map[string]bool{RuleMissingInstruction: true}})
+		for _, f := range findings {
+			if f.Rule == RuleMissingInstruction {
+				t.Errorf("disabled rule reported: %+v", f)
+			}
+		}
+	})
+	t.Run("too long", func(t *testing.T) {
+		if len(messages("Summarize "+strings.Repeat("word ", 100), RuleTooLong)) != 0 {
+			t.Error("short prompt reported as too long")
+		}
+		findings := Lint("Summarize "+strings.Repeat("word ", 100), Options{MaxTokens: 10})
+		if !slices.ContainsFunc(findings, func(f Finding) bool { return f.Rule == RuleTooLong }) {
+			t.Error("prompt above MaxTokens not reported")
+		}
+	})
+	t.Run("position", func(t *testing.T) {
+		findings := Lint("Summarize the text.\n  ñ (open", Options{})
+		i := slices.IndexFunc(findings, func(f Finding) bool { return f.Rule == RuleUnbalanced })
+		if i < 0 {
+			t.Fatal("unclosed bracket not reported")
+		}
+		if f := findings[i]; f.Line != 2 || f.Column != 5 {
+			t.Errorf("finding at line %d, column %d; want line 2, column 5", f.Line, f.Column)
+		}
+	})
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{Info, Warning, Error} {
+		got, err := ParseSeverity(s.String())
+		if err != nil || got != s {
+			t.Errorf("ParseSeverity(%q) = %v, %v", s.String(), got, err)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("ParseSeverity accepted an unknown severity")
+	}
+}
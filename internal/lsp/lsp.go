@@ -0,0 +1,453 @@
+// Package lsp serves prompt files to editors as a Language Server Protocol
+// server over stdio: diagnostics from local checks and the Stage 1 analysis,
+// hover with the recommended technique, and an "Enhance prompt" code action.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+	prompt "tokinfo/internal/prompt"
+)
+
+// enhanceCommand is the command the "Enhance prompt" code action runs.
+const enhanceCommand = "tokinfo.enhancePrompt"
+
+// source names tokinfo in diagnostics.
+const source = "tokinfo"
+
+// Options holds optional settings for the server.
+type Options struct {
+	// Analyze runs the Stage 1 analysis when a prompt file is opened or
+	// saved, and reports the technique and clarifying questions.
+	Analyze bool
+	// Checks returns local diagnostics for a prompt; it runs on every
+	// change, so it must be fast and work offline. It may be nil.
+	Checks func(text string) []Diagnostic
+}
+
+// Server answers LSP requests with an Enhancer.
+type Server struct {
+	enhancer *enhance.Enhancer
+	logger   *slog.Logger
+	options  Options
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu          sync.Mutex
+	initialized bool
+	shutdown    bool
+	documents   map[string]*document
+	nextID      int // For requests sent to the client
+}
+
+// document is an open prompt file.
+type document struct {
+	text     string
+	version  int
+	analysis *gemini.AnalysisResult // Of the last analyzed version; nil until one finishes
+	cancel   context.CancelFunc     // Stops the analysis in progress
+}
+
+// New returns a server using enhancer.
+func New(enhancer *enhance.Enhancer, logger *slog.Logger, options Options) *Server {
+	return &Server{enhancer: enhancer, logger: logger, options: options, documents: make(map[string]*document)}
+}
+
+// Serve reads messages from r and writes to w until the client sends exit,
+// r ends or ctx is done.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops analyses and code actions still running
+	reader := bufio.NewReader(r)
+	for {
+		msg, err := readMessage(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read LSP message: %w", err)
+		}
+
+		switch {
+		case msg.Method == "exit":
+			return nil
+		case msg.Method == "":
+			// A response to one of our requests, such as workspace/applyEdit.
+			if msg.Error != nil {
+				s.logger.Warn("client rejected request", "error", msg.Error.Message)
+			}
+		case len(msg.ID) == 0:
+			s.notify(ctx, msg)
+		default:
+			// Requests run concurrently so a slow code action does not
+			// hold up hovers and diagnostics.
+			go s.respond(ctx, msg)
+		}
+	}
+}
+
+// send writes a message, serializing concurrent writers.
+func (s *Server) send(msg *message) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := writeMessage(s.w, msg); err != nil {
+		s.logger.Error("failed to write LSP message", "error", err)
+	}
+}
+
+// request sends a request to the client. Its response is only logged.
+func (s *Server) request(method string, params any) {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.mu.Unlock()
+	raw, _ := json.Marshal(params)
+	s.send(&message{ID: json.RawMessage(fmt.Sprintf(`"tokinfo-%d"`, id)), Method: method, Params: raw})
+}
+
+// publish sends the diagnostics of a document.
+func (s *Server) publish(uri string, diagnostics []Diagnostic) {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{} // An empty list clears the editor's diagnostics
+	}
+	raw, _ := json.Marshal(map[string]any{"uri": uri, "diagnostics": diagnostics})
+	s.send(&message{Method: "textDocument/publishDiagnostics", Params: raw})
+}
+
+// respond handles a request and writes its response.
+func (s *Server) respond(ctx context.Context, msg *message) {
+	result, err := s.dispatch(ctx, msg)
+	resp := &message{ID: msg.ID, Result: result}
+	if err != nil {
+		var target *rpcError
+		if !errors.As(err, &target) {
+			target = &rpcError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		resp.Error = target
+		s.logger.Warn("LSP request failed", "method", msg.Method, "error", err)
+	}
+	if resp.Result == nil && resp.Error == nil {
+		resp.Result = json.RawMessage("null") // Responses need a result, even if null
+	}
+	s.send(resp)
+}
+
+// dispatch routes a request to its method.
+func (s *Server) dispatch(ctx context.Context, msg *message) (any, error) {
+	s.mu.Lock()
+	initialized, shutdown := s.initialized, s.shutdown
+	s.mu.Unlock()
+	if !initialized && msg.Method != "initialize" {
+		return nil, &rpcError{Code: codeServerNotInitialized, Message: "server not initialized"}
+	}
+	if shutdown {
+		return nil, &rpcError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.mu.Lock()
+		s.initialized = true
+		s.mu.Unlock()
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       map[string]any{"openClose": true, "change": 1, "save": true}, // Full document sync
+				"hoverProvider":          true,
+				"codeActionProvider":     map[string]any{"codeActionKinds": []string{"refactor.rewrite"}},
+				"executeCommandProvider": map[string]any{"commands": []string{enhanceCommand}},
+			},
+			"serverInfo": map[string]string{"name": "tokinfo"},
+		}, nil
+	case "shutdown":
+		s.mu.Lock()
+		s.shutdown = true
+		s.mu.Unlock()
+		return nil, nil
+	case "textDocument/hover":
+		var params positionParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params.TextDocument.URI), nil
+	case "textDocument/codeAction":
+		var params codeActionParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.codeActions(params), nil
+	case "workspace/executeCommand":
+		var params executeCommandParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.executeCommand(ctx, params)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' not supported", msg.Method)}
+	}
+}
+
+// notify handles a notification.
+func (s *Server) notify(ctx context.Context, msg *message) {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if decodeParams(msg.Params, &params) == nil && isPromptFile(params.TextDocument.URI) {
+			s.update(ctx, params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text, true)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if decodeParams(msg.Params, &params) == nil && len(params.ContentChanges) > 0 && isPromptFile(params.TextDocument.URI) {
+			// With full sync the last change holds the whole document.
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.update(ctx, params.TextDocument.URI, params.TextDocument.Version, text, false)
+		}
+	case "textDocument/didSave":
+		var params documentParams
+		if decodeParams(msg.Params, &params) == nil {
+			s.mu.Lock()
+			doc, ok := s.documents[params.TextDocument.URI]
+			var version int
+			var text string
+			if ok {
+				version, text = doc.version, doc.text
+			}
+			s.mu.Unlock()
+			if ok {
+				s.update(ctx, params.TextDocument.URI, version, text, true)
+			}
+		}
+	case "textDocument/didClose":
+		var params documentParams
+		if decodeParams(msg.Params, &params) == nil {
+			s.mu.Lock()
+			if doc, ok := s.documents[params.TextDocument.URI]; ok {
+				if doc.cancel != nil {
+					doc.cancel()
+				}
+				delete(s.documents, params.TextDocument.URI)
+			}
+			s.mu.Unlock()
+			s.publish(params.TextDocument.URI, nil)
+		}
+	default:
+		s.logger.Debug("ignoring LSP notification", "method", msg.Method)
+	}
+}
+
+// decodeParams unmarshals request params, reporting failures as invalid params.
+func decodeParams(raw json.RawMessage, v any) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+// isPromptFile reports whether uri names a file with a prompt extension.
+func isPromptFile(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return prompt.HasPromptExtension(parsed.Path)
+}
+
+// --- Diagnostics ---
+
+// update stores a new version of a document and publishes its diagnostics.
+// With analyze set, the Stage 1 analysis runs again in the background.
+func (s *Server) update(ctx context.Context, uri string, version int, text string, analyze bool) {
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	if !ok {
+		doc = &document{}
+		s.documents[uri] = doc
+	}
+	doc.text, doc.version = text, version
+	var analysisCtx context.Context
+	if analyze && s.options.Analyze && strings.TrimSpace(text) != "" {
+		if doc.cancel != nil {
+			doc.cancel() // The previous analysis is out of date
+		}
+		analysisCtx, doc.cancel = context.WithCancel(ctx)
+	}
+	diagnostics := s.diagnostics(doc)
+	s.mu.Unlock()
+	s.publish(uri, diagnostics)
+
+	if analysisCtx != nil {
+		go s.analyze(analysisCtx, uri, version, text)
+	}
+}
+
+// analyze runs Stage 1 on a document version and publishes the result if
+// the document has not changed meanwhile.
+func (s *Server) analyze(ctx context.Context, uri string, version int, text string) {
+	analysis, err := s.enhancer.Analyze(ctx, text)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("prompt analysis failed", "uri", uri, "error", err)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	if !ok || doc.version != version {
+		s.mu.Unlock()
+		return
+	}
+	doc.analysis = analysis
+	diagnostics := s.diagnostics(doc)
+	s.mu.Unlock()
+	s.publish(uri, diagnostics)
+}
+
+// diagnostics returns the local checks and the analysis findings for doc.
+// s.mu must be held.
+func (s *Server) diagnostics(doc *document) []Diagnostic {
+	var diagnostics []Diagnostic
+	if s.options.Checks != nil {
+		diagnostics = append(diagnostics, s.options.Checks(doc.text)...)
+	}
+	if doc.analysis == nil {
+		return diagnostics
+	}
+
+	// Analysis findings are about the whole prompt; anchor them to its first line.
+	firstLine := doc.text
+	if end := strings.IndexByte(firstLine, '\n'); end >= 0 {
+		firstLine = firstLine[:end]
+	}
+	anchor := Range{End: PositionAt(doc.text, len(firstLine))}
+	diagnostics = append(diagnostics, Diagnostic{
+		Range:    anchor,
+		Severity: SeverityInformation,
+		Code:     "technique",
+		Source:   source,
+		Message:  fmt.Sprintf("Recommended technique: %s. %s", doc.analysis.ChosenTechniqueName, doc.analysis.Rationale),
+	})
+	for _, question := range doc.analysis.ClarifyingQuestions {
+		message := "Clarifying question: " + question.Question
+		if question.ExampleAnswer != "" {
+			message += fmt.Sprintf(" (e.g. %s)", question.ExampleAnswer)
+		}
+		diagnostics = append(diagnostics, Diagnostic{Range: anchor, Severity: SeverityHint, Code: "question", Source: source, Message: message})
+	}
+	return diagnostics
+}
+
+// --- Hover and Code Actions ---
+
+// hover describes the technique recommended for the document, once analyzed.
+func (s *Server) hover(uri string) any {
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	var analysis *gemini.AnalysisResult
+	if ok {
+		analysis = doc.analysis
+	}
+	s.mu.Unlock()
+	if analysis == nil {
+		return nil
+	}
+
+	value := fmt.Sprintf("**Recommended technique: %s**\n\n", analysis.ChosenTechniqueName)
+	for _, tech := range s.enhancer.Guidelines().Techniques {
+		if tech.Name == analysis.ChosenTechniqueName {
+			value += tech.Summarized + "\n\n"
+		}
+	}
+	if analysis.Rationale != "" {
+		value += "*Why:* " + analysis.Rationale
+	}
+	return hover{Contents: markupContent{Kind: "markdown", Value: value}}
+}
+
+// codeActions offers to enhance the selection, or the whole prompt when
+// nothing is selected.
+func (s *Server) codeActions(params codeActionParams) any {
+	s.mu.Lock()
+	_, ok := s.documents[params.TextDocument.URI]
+	s.mu.Unlock()
+	if !ok {
+		return []codeAction{}
+	}
+	return []codeAction{{
+		Title: "Enhance prompt",
+		Kind:  "refactor.rewrite",
+		Command: command{
+			Title:     "Enhance prompt",
+			Command:   enhanceCommand,
+			Arguments: []any{params.TextDocument.URI, params.Range},
+		},
+	}}
+}
+
+// executeCommand runs the "Enhance prompt" action: the selected text goes
+// through the pipeline with the model's example answers, and the client is
+// asked to replace it with the result.
+func (s *Server) executeCommand(ctx context.Context, params executeCommandParams) error {
+	if params.Command != enhanceCommand {
+		return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown command '%s'", params.Command)}
+	}
+	var uri string
+	var selection Range
+	if len(params.Arguments) != 2 || json.Unmarshal(params.Arguments[0], &uri) != nil || json.Unmarshal(params.Arguments[1], &selection) != nil {
+		return &rpcError{Code: codeInvalidParams, Message: "expected the document URI and the range to enhance"}
+	}
+
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	var text string
+	var version int
+	if ok {
+		text, version = doc.text, doc.version
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("document '%s' is not open", uri)
+	}
+
+	start, end := OffsetAt(text, selection.Start), OffsetAt(text, selection.End)
+	if start >= end {
+		// Nothing selected: enhance the whole prompt.
+		start, end = 0, len(text)
+		selection = Range{End: PositionAt(text, len(text))}
+	}
+	selected := text[start:end]
+	if strings.TrimSpace(selected) == "" {
+		return fmt.Errorf("nothing to enhance: the selection is empty")
+	}
+
+	result, err := s.enhancer.Enhance(ctx, selected, enhance.Answering{})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	changed := !ok || s.documents[uri] == nil || s.documents[uri].version != version
+	s.mu.Unlock()
+	if changed {
+		return fmt.Errorf("the document changed while the prompt was being enhanced; run the action again")
+	}
+	s.request("workspace/applyEdit", map[string]any{
+		"label": "Enhance prompt (" + result.Technique + ")",
+		"edit": map[string]any{
+			"changes": map[string][]textEdit{uri: {{Range: selection, NewText: result.EnhancedPrompt}}},
+		},
+	})
+	return nil
+}
@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOffsetAt(t *testing.T) {
+	text := "ab\nñx\n😀y\n"
+	tests := []struct {
+		name string
+		pos  Position
+		want int
+	}{
+		{"start", Position{0, 0}, 0},
+		{"inside first line", Position{0, 1}, 1},
+		{"second line", Position{1, 0}, 3},
+		{"after a two-byte rune", Position{1, 1}, 5},
+		{"after a surrogate pair", Position{2, 2}, 11},
+		{"past the end of a line", Position{0, 10}, 2},
+		{"past the last line", Position{9, 0}, len(text)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OffsetAt(text, tt.pos); got != tt.want {
+				t.Errorf("OffsetAt(%+v) = %d, want %d", tt.pos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	text := "ab\nñx\n😀y\n"
+	tests := []struct {
+		offset int
+		want   Position
+	}{
+		{0, Position{0, 0}},
+		{2, Position{0, 2}},
+		{3, Position{1, 0}},
+		{5, Position{1, 1}},
+		{11, Position{2, 2}},
+		{-4, Position{0, 0}},
+		{100, Position{3, 0}},
+	}
+	for _, tt := range tests {
+		if got := PositionAt(text, tt.offset); got != tt.want {
+			t.Errorf("PositionAt(%d) = %+v, want %+v", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	text := "first line\nsegunda línea 😀 fin\n\nlast"
+	for offset := range len(text) + 1 {
+		if offset < len(text) && !utf8.RuneStart(text[offset]) {
+			continue // Not a rune boundary, so not a position
+		}
+		if got := OffsetAt(text, PositionAt(text, offset)); got != offset {
+			t.Errorf("OffsetAt(PositionAt(%d)) = %d", offset, got)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+// Package mcp serves prompt analysis and enhancement as a Model Context
+// Protocol server over stdio, so coding assistants can use the same
+// guideline-driven enhancer as the CLI.
+//
+// Messages are JSON-RPC 2.0 objects, one per line. The server offers the
+// tools analyze_prompt, enhance_prompt and list_techniques, and one resource
+// per technique holding its complete description.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	answers "tokinfo/internal/answers"
+	enhance "tokinfo/internal/enhance"
+	preserve "tokinfo/internal/preserve"
+)
+
+// protocolVersions are the MCP revisions the server speaks, newest first.
+var protocolVersions = []string{"2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// techniqueScheme is the URI scheme of technique resources.
+const techniqueScheme = "technique://"
+
+// Server answers MCP requests with an Enhancer.
+type Server struct {
+	enhancer *enhance.Enhancer
+	logger   *slog.Logger
+	version  string // Reported to clients as the server version
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu       sync.Mutex
+	inFlight map[string]context.CancelFunc // Keyed by request id, for cancellation
+}
+
+// New returns a server using enhancer. version is reported to clients.
+func New(enhancer *enhance.Enhancer, logger *slog.Logger, version string) *Server {
+	return &Server{enhancer: enhancer, logger: logger, version: version, inFlight: make(map[string]context.CancelFunc)}
+}
+
+// request is an incoming JSON-RPC request or notification (without ID).
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is an outgoing JSON-RPC response.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object. It is also used as a Go error by the
+// method handlers to choose the code.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Serve reads requests from r and writes responses to w until r ends or ctx
+// is done. Requests are handled concurrently, so a slow tool call does not
+// hold up pings or listings.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // Prompts can be long
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			s.write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: fmt.Sprintf("parse error: %v", err)}})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			if len(req.ID) > 0 {
+				s.write(response{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: codeInvalidRequest, Message: "invalid JSON-RPC 2.0 request"}})
+			}
+			continue
+		}
+		if len(req.ID) == 0 {
+			s.notify(req)
+			continue
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.inFlight[string(req.ID)] = cancel
+		s.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.inFlight, string(req.ID))
+				s.mu.Unlock()
+				cancel()
+			}()
+			s.respond(reqCtx, req)
+		}()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read MCP messages: %w", err)
+	}
+	return nil
+}
+
+// notify handles a notification, which gets no response.
+func (s *Server) notify(req request) {
+	switch req.Method {
+	case "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err == nil {
+			s.mu.Lock()
+			if cancel, ok := s.inFlight[string(params.RequestID)]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+		}
+	default:
+		s.logger.Debug("ignoring MCP notification", "method", req.Method)
+	}
+}
+
+// respond handles a request and writes its response.
+func (s *Server) respond(ctx context.Context, req request) {
+	result, err := s.dispatch(ctx, req)
+	resp := response{JSONRPC: "2.0", ID: req.ID, Result: result}
+	if err != nil {
+		var target *rpcError
+		if !errors.As(err, &target) {
+			target = &rpcError{Code: -32603, Message: err.Error()}
+		}
+		resp.Result, resp.Error = nil, target
+		s.logger.Warn("MCP request failed", "method", req.Method, "error", err)
+	} else {
+		s.logger.Debug("MCP request", "method", req.Method)
+	}
+	s.write(resp)
+}
+
+// write sends one message, serializing concurrent writers.
+func (s *Server) write(resp response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(response{JSONRPC: "2.0", ID: resp.ID, Error: &rpcError{Code: -32603, Message: err.Error()}})
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		s.logger.Error("failed to write MCP response", "error", err)
+	}
+}
+
+// dispatch routes a request to its method.
+func (s *Server) dispatch(ctx context.Context, req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	case "resources/list":
+		return s.listResources(), nil
+	case "resources/read":
+		return s.readResource(req.Params)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' not found", req.Method)}
+	}
+}
+
+// initialize negotiates the protocol version and describes the server.
+func (s *Server) initialize(raw json.RawMessage) (any, error) {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+	// Answer with the client's version if we speak it, else our newest.
+	version := protocolVersions[0]
+	for _, v := range protocolVersions {
+		if v == params.ProtocolVersion {
+			version = v
+		}
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities": map[string]any{
+			"tools":     map[string]any{},
+			"resources": map[string]any{},
+		},
+		"serverInfo":   map[string]string{"name": "tokinfo", "version": s.version},
+		"instructions": "Use enhance_prompt to rewrite a prompt with the prompt engineering technique that fits it best. Use analyze_prompt first to see the clarifying questions, then pass their answers to enhance_prompt.",
+	}, nil
+}
+
+// decodeParams unmarshals request params, reporting failures as invalid params.
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+// --- Tools ---
+
+// tool describes a tool in tools/list.
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// promptProperty is the input schema of the prompt argument.
+var promptProperty = map[string]any{"type": "string", "description": "The prompt to improve"}
+
+var tools = []tool{
+	{
+		Name:        "analyze_prompt",
+		Description: "Choose the prompt engineering technique that best fits a prompt, explain why, and list clarifying questions with example answers.",
+		InputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"prompt": promptProperty},
+			"required":   []string{"prompt"},
+		},
+	},
+	{
+		Name:        "enhance_prompt",
+		Description: "Rewrite a prompt using the best-fitting prompt engineering technique. Clarifying questions are answered from `answers` or with the model's example answers.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"prompt": promptProperty,
+				"answers": map[string]any{
+					"type":                 "object",
+					"description":          "Answers to clarifying questions, keyed by question text, a fragment of it, or the 1-based question number",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+				"unanswered": map[string]any{
+					"type":        "string",
+					"enum":        []string{"example", "skip"},
+					"description": "What to do with unanswered questions: use the example answer (default) or leave them out",
+				},
+			},
+			"required": []string{"prompt"},
+		},
+	},
+	{
+		Name:        "list_techniques",
+		Description: "List the prompt engineering techniques in the guidelines with their summaries.",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+	},
+}
+
+// content is a text item of a tool result or resource.
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// toolResult is the result of tools/call.
+type toolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// callTool runs a tool. Tool failures are reported in the result, as MCP
+// expects, so the model can see them; protocol errors are returned.
+func (s *Server) callTool(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+	var args struct {
+		Prompt     string            `json:"prompt"`
+		Answers    map[string]string `json:"answers"`
+		Unanswered string            `json:"unanswered"`
+	}
+	if err := decodeParams(params.Arguments, &args); err != nil {
+		return nil, err
+	}
+	if params.Name != "list_techniques" && strings.TrimSpace(args.Prompt) == "" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "prompt is required"}
+	}
+
+	var result any
+	var err error
+	switch params.Name {
+	case "analyze_prompt":
+		result, err = s.enhancer.Analyze(ctx, args.Prompt)
+	case "enhance_prompt":
+		if !enhance.ValidUnanswered(args.Unanswered) {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown unanswered value '%s' (expected example or skip)", args.Unanswered)}
+		}
+		var enhanced *enhance.Result
+		enhanced, err = s.enhancer.Enhance(ctx, args.Prompt, enhance.Answering{Provided: answers.FromMap(args.Answers), Unanswered: args.Unanswered})
+		if err == nil {
+			// The enhanced prompt comes first so clients showing one item show it.
+			details, _ := json.MarshalIndent(enhanced, "", "  ")
+			return toolResult{Content: []content{{Type: "text", Text: enhanced.EnhancedPrompt}, {Type: "text", Text: string(details)}}}, nil
+		}
+	case "list_techniques":
+		result = s.techniques()
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool '%s'", params.Name)}
+	}
+	if err != nil {
+		failed := toolResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}
+		// A refinement that lost protected content also lists it as JSON, as
+		// the HTTP API does, so clients can point at the parts.
+		var lost *preserve.Error
+		if errors.As(err, &lost) {
+			details, _ := json.MarshalIndent(map[string][]preserve.Span{"missing": lost.Missing}, "", "  ")
+			failed.Content = append(failed.Content, content{Type: "text", Text: string(details)})
+		}
+		return failed, nil
+	}
+	text, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return toolResult{Content: []content{{Type: "text", Text: string(text)}}}, nil
+}
+
+// techniqueInfo lists one technique in list_techniques.
+type techniqueInfo struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+	URI     string `json:"uri"` // Resource with the complete description
+}
+
+func (s *Server) techniques() []techniqueInfo {
+	list := []techniqueInfo{}
+	for _, tech := range s.enhancer.Guidelines().Techniques {
+		list = append(list, techniqueInfo{Name: tech.Name, Summary: tech.Summarized, URI: techniqueURI(tech.Name)})
+	}
+	return list
+}
+
+// --- Resources ---
+
+// techniqueURI returns the resource URI of the named technique.
+func techniqueURI(name string) string {
+	return techniqueScheme + url.PathEscape(name)
+}
+
+// listResources lists one resource per technique.
+func (s *Server) listResources() any {
+	type resource struct {
+		URI         string `json:"uri"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		MIMEType    string `json:"mimeType"`
+	}
+	resources := []resource{}
+	for _, tech := range s.enhancer.Guidelines().Techniques {
+		resources = append(resources, resource{URI: techniqueURI(tech.Name), Name: tech.Name, Description: tech.Summarized, MIMEType: "text/markdown"})
+	}
+	return map[string]any{"resources": resources}
+}
+
+// readResource returns the complete description of a technique.
+func (s *Server) readResource(raw json.RawMessage) (any, error) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+	for _, tech := range s.enhancer.Guidelines().Techniques {
+		if techniqueURI(tech.Name) == params.URI {
+			type resourceContent struct {
+				URI      string `json:"uri"`
+				MIMEType string `json:"mimeType"`
+				Text     string `json:"text"`
+			}
+			return map[string]any{"contents": []resourceContent{{URI: params.URI, MIMEType: "text/markdown", Text: tech.Complete}}}, nil
+		}
+	}
+	// -32002 is the code MCP uses for unknown resources.
+	return nil, &rpcError{Code: -32002, Message: fmt.Sprintf("resource '%s' not found", params.URI)}
+}
@@ -0,0 +1,237 @@
+// Package preserve finds the parts of a prompt that enhancement must copy
+// verbatim, such as fenced code, JSON examples, URLs, quoted strings and
+// template variables, and checks that an enhanced prompt kept them.
+package preserve
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	variables "tokinfo/internal/variables"
+)
+
+// Kinds of protected spans.
+const (
+	KindCode     = "code"     // Contents of a fenced code block
+	KindJSON     = "json"     // JSON object or array outside code blocks
+	KindURL      = "url"      // http or https URL
+	KindQuote    = "quote"    // Text in double quotes
+	KindVariable = "variable" // Template variable, see package variables
+)
+
+// Modes of handling spans an enhanced prompt lost.
+const (
+	ModeStrict = "strict" // Retry, then fail
+	ModeWarn   = "warn"   // Retry, then keep the result with a warning
+	ModeOff    = "off"    // Do not check
+)
+
+// Span is a part of the prompt that must appear verbatim in the enhanced prompt.
+type Span struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+	Line int    `json:"line"` // 1-based line of the prompt the span starts on
+}
+
+var (
+	// fence matches a fenced code block, capturing its contents.
+	fence = regexp.MustCompile("(?ms)^[ \t]*(?:```|~~~)[^\n]*\n(.*?)^[ \t]*(?:```|~~~)")
+	// url matches an http or https URL; trailing punctuation is trimmed after.
+	url = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+	// quote matches a double-quoted string on one line, straight or curly.
+	quote = regexp.MustCompile(`"([^"\n]{1,200})"|“([^”\n]{1,200})”`)
+)
+
+// Extract returns the protected spans of text, sorted by line, listing the
+// same text of a kind once. Spans inside a code block or a JSON example are
+// part of it and are not listed on their own.
+func Extract(text string) []Span {
+	var spans []Span
+	seen := make(map[string]bool)
+	add := func(kind string, span string, offset int) {
+		if strings.TrimSpace(span) == "" || seen[kind+"\x00"+span] {
+			return
+		}
+		seen[kind+"\x00"+span] = true
+		spans = append(spans, Span{Kind: kind, Text: span, Line: strings.Count(text[:offset], "\n") + 1})
+	}
+
+	// Each found span is blanked out, so later kinds do not match inside it.
+	blanked := []byte(text)
+	blank := func(start int, end int) {
+		for i := start; i < end; i++ {
+			if blanked[i] != '\n' {
+				blanked[i] = ' '
+			}
+		}
+	}
+	for _, m := range fence.FindAllStringSubmatchIndex(text, -1) {
+		add(KindCode, text[m[2]:m[3]], m[2])
+		blank(m[0], m[1])
+	}
+	for _, loc := range jsonExamples(string(blanked)) {
+		add(KindJSON, text[loc[0]:loc[1]], loc[0])
+		blank(loc[0], loc[1])
+	}
+	for _, v := range variables.Find(string(blanked)) {
+		offset := strings.Index(string(blanked), v.Text)
+		add(KindVariable, v.Text, offset)
+	}
+	for _, loc := range url.FindAllStringIndex(string(blanked), -1) {
+		end := loc[1]
+		for end > loc[0] && strings.ContainsRune(".,;:!?)]}", rune(text[end-1])) {
+			end--
+		}
+		add(KindURL, text[loc[0]:end], loc[0])
+		blank(loc[0], end)
+	}
+	for _, m := range quote.FindAllStringIndex(string(blanked), -1) {
+		add(KindQuote, text[m[0]:m[1]], m[0])
+	}
+	slices.SortStableFunc(spans, func(a, b Span) int { return a.Line - b.Line })
+	return spans
+}
+
+// jsonExamples returns the locations of the JSON objects and arrays of text
+// that hold at least one string or key, so "[1]" and "{x}" are not taken for
+// examples.
+func jsonExamples(text string) [][]int {
+	var found [][]int
+	for start := 0; start < len(text); start++ {
+		if text[start] != '{' && text[start] != '[' {
+			continue
+		}
+		end := matchingBracket(text, start)
+		if end < 0 {
+			continue
+		}
+		candidate := text[start : end+1]
+		if strings.Contains(candidate, `"`) && json.Valid([]byte(candidate)) {
+			found = append(found, []int{start, end + 1})
+			start = end
+		}
+	}
+	return found
+}
+
+// matchingBracket returns the index of the bracket closing the one at
+// start, skipping brackets inside strings, or -1.
+func matchingBracket(text string, start int) int {
+	depth, inString, escaped := 0, false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Missing returns the spans that enhanced does not contain. Code must match
+// line by line, ignoring trailing spaces; other spans match when they appear
+// with any amount of whitespace between their words. Template variables
+// follow variables.Missing.
+func Missing(spans []Span, enhanced string) []Span {
+	flat := collapse(enhanced)
+	codeLines := trimLines(enhanced)
+	var missing []Span
+	for _, s := range spans {
+		switch s.Kind {
+		case KindVariable:
+			if len(variables.Missing(variables.Find(s.Text), enhanced)) > 0 {
+				missing = append(missing, s)
+			}
+		case KindCode:
+			if !strings.Contains(codeLines, trimLines(s.Text)) {
+				missing = append(missing, s)
+			}
+		default:
+			if !strings.Contains(flat, collapse(s.Text)) {
+				missing = append(missing, s)
+			}
+		}
+	}
+	return missing
+}
+
+// collapse replaces every run of whitespace in text with one space.
+func collapse(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// trimLines normalizes line endings and drops trailing spaces of every line.
+func trimLines(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// Instructions returns the constraint asking a model to keep spans, or ""
+// if there are none. Short spans are listed; code blocks and JSON examples
+// are only named, since they are already in the prompt.
+func Instructions(spans []Span) string {
+	if len(spans) == 0 {
+		return ""
+	}
+	var listed []string
+	kinds := make(map[string]bool)
+	for _, s := range spans {
+		kinds[s.Kind] = true
+		if s.Kind != KindCode && s.Kind != KindJSON {
+			listed = append(listed, s.Text)
+		}
+	}
+	var b strings.Builder
+	b.WriteString("\n\n**Preserved content:**\nCopy these parts of the prompt into the enhanced prompt exactly as written, character for character: do not translate, reformat, shorten or fill them in.")
+	if kinds[KindCode] {
+		b.WriteString("\n- Every fenced code block, with its contents unchanged.")
+	}
+	if kinds[KindJSON] {
+		b.WriteString("\n- Every JSON example, with the same keys and values.")
+	}
+	if len(listed) > 0 {
+		fmt.Fprintf(&b, "\n- %s", strings.Join(listed, "\n- "))
+	}
+	return b.String()
+}
+
+// Error reports the spans an enhanced prompt lost.
+type Error struct {
+	Missing []Span
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "enhanced prompt lost %d protected parts of the prompt:", len(e.Missing))
+	for _, s := range e.Missing {
+		fmt.Fprintf(&b, "\n  line %d, %s: %s", s.Line, s.Kind, excerpt(s.Text))
+	}
+	return b.String()
+}
+
+// excerpt shortens text to one line for reports.
+func excerpt(text string) string {
+	text = collapse(text)
+	if runes := []rune(text); len(runes) > 60 {
+		return string(runes[:59]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,111 @@
+package preserve
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// describe returns the kind, line and text of each span.
+func describe(spans []Span) []string {
+	var out []string
+	for _, s := range spans {
+		out = append(out, fmt.Sprintf("%s %d %s", s.Kind, s.Line, s.Text))
+	}
+	return out
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "Write a poem about the sea.", nil},
+		{"code block", "Fix this:\n```go\nfmt.Println(\"hi\")\n```\n", []string{"code 3 fmt.Println(\"hi\")\n"}},
+		{"tilde fence", "~~~\nx := 1\n~~~", []string{"code 2 x := 1\n"}},
+		{"json example", `Return {"name": "Ana", "tags": ["a"]} only.`, []string{`json 1 {"name": "Ana", "tags": ["a"]}`}},
+		{"brackets without strings are not json", "Pick one of [1, 2] or {1}.", nil},
+		{"url", "Read https://example.com/docs?page=2, then answer.", []string{"url 1 https://example.com/docs?page=2"}},
+		{"url in parentheses", "(see https://example.com/a).", []string{"url 1 https://example.com/a"}},
+		{"quotes", "Reply \"Thank you\" or “Gracias”.", []string{`quote 1 "Thank you"`, "quote 1 “Gracias”"}},
+		{"variable", "Dear {{name}},\nabout {ticket_id}", []string{"variable 1 {{name}}", "variable 2 {ticket_id}"}},
+		{"latex is not a variable", `Simplify \frac{a}{b}.`, nil},
+		{"spans inside code are not listed", "```\nGET \"https://example.com\" {{x}}\n```", []string{"code 2 GET \"https://example.com\" {{x}}\n"}},
+		{"quotes inside json are not listed", `Like {"reply": "Thank you"}.`, []string{`json 1 {"reply": "Thank you"}`}},
+		{"each text once", "Say \"hi\". Then say \"hi\" again.", []string{`quote 1 "hi"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describe(Extract(tt.text)); !slices.Equal(got, tt.want) {
+				t.Errorf("Extract =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissing(t *testing.T) {
+	original := "Fix this:\n```\nif x {\n    return\n}\n```\n" +
+		`Return {"ok": true}. Cite https://example.com/a and say "thank you very much" to {{name}}.`
+	spans := Extract(original)
+	tests := []struct {
+		name     string
+		enhanced string
+		missing  []string // Kinds of the missing spans
+	}{
+		{"everything kept", original, nil},
+		{
+			"whitespace and trailing spaces change",
+			"Fix:\n```\nif x {   \n    return\n}\n```\nReturn {\"ok\": true}. Cite https://example.com/a, say \"thank you\n very much\" to {{ name }}.",
+			nil,
+		},
+		{
+			"code reindented",
+			"```\nif x {\nreturn\n}\n```\n" + `{"ok": true} https://example.com/a "thank you very much" {{name}}`,
+			[]string{KindCode},
+		},
+		{
+			"everything else lost",
+			"```\nif x {\n    return\n}\n```\n" + `{"ok": false} https://example.com/b "thanks" {name}`,
+			[]string{KindJSON, KindURL, KindQuote, KindVariable},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range Missing(spans, tt.enhanced) {
+				got = append(got, s.Kind)
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.missing)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("Missing kinds = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestInstructions(t *testing.T) {
+	if got := Instructions(nil); got != "" {
+		t.Errorf("Instructions(nil) = %q, want empty", got)
+	}
+	got := Instructions(Extract("```\ncode\n```\nSay \"hi\" to {{name}}."))
+	for _, want := range []string{"**Preserved content:**", "fenced code block", `- "hi"`, "- {{name}}"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Instructions = %q, missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, "code\n") {
+		t.Errorf("Instructions repeat the code block: %q", got)
+	}
+}
+
+func TestError(t *testing.T) {
+	err := &Error{Missing: []Span{{Kind: KindURL, Text: "https://example.com", Line: 3}, {Kind: KindQuote, Text: `"` + strings.Repeat("long ", 20) + `"`, Line: 5}}}
+	want := "enhanced prompt lost 2 protected parts of the prompt:\n  line 3, url: https://example.com\n  line 5, quote: \"long long long long long long long long long long long lon…"
+	if err.Error() != want {
+		t.Errorf("Error() =\n%s\nwant\n%s", err.Error(), want)
+	}
+}
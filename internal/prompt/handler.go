@@ -4,61 +4,156 @@ package prompt
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath" // Useful for checking extensions
 	"strings"
+
+	"golang.org/x/term"
 )
 
-// ReadInput determines if the input is a file path or a raw string,
-// reads the content if it's a file, and returns the prompt string.
-func ReadInput(inputPathOrString string, verbose bool) (string, error) {
-	// Check for common text/markdown file extensions
-	ext := strings.ToLower(filepath.Ext(inputPathOrString))
-	isFilePath := ext == ".txt" || ext == ".md"
-
-	// Alternative check: try to get file info, if it succeeds, it's likely a file.
-	// _, err := os.Stat(inputPathOrString)
-	// isFilePath := err == nil // If Stat succeeds without error, it's a file/dir
-
-	if isFilePath {
-		// Input is considered a file path
-		if verbose {
-			fmt.Printf("Reading prompt from file: %s\n", inputPathOrString)
-		}
-		content, err := os.ReadFile(inputPathOrString)
-		if err != nil {
-			return "", fmt.Errorf("failed to read prompt file '%s': %w", inputPathOrString, err)
-		}
-		return string(content), nil
-	}
+// promptExtensions are file extensions that mark an argument as a prompt file path.
+var promptExtensions = map[string]bool{
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".prompt":   true,
+	".text":     true,
+	".tmpl":     true,
+}
 
-	// Input is considered a raw string
+// ReadInput resolves the -p argument into the prompt text. It accepts:
+//   - "-" to read the prompt from standard input,
+//   - "@path" to read the prompt from a file of any type,
+//   - the path of an existing file, whatever its extension,
+//   - any other string, which is used as the literal prompt.
+//
+// An argument that looks like a file path (a single token with a path separator
+// or a prompt file extension) but does not exist is an error rather than being
+// silently sent as the prompt text.
+func ReadInput(inputPathOrString string, logger *slog.Logger) (string, error) {
 	if inputPathOrString == "" {
 		return "", fmt.Errorf("prompt input cannot be empty")
 	}
+
+	// "-" reads from standard input
+	if inputPathOrString == "-" {
+		return ReadStdin(os.Stdin, logger)
+	}
+
+	// "@path" and existing files are read from disk
+	if path := FilePath(inputPathOrString); path != "" {
+		return ReadFile(path, logger)
+	}
+
+	// Refuse to send a mistyped path to the model as if it were the prompt
+	if looksLikePath(inputPathOrString) {
+		return "", fmt.Errorf("prompt file '%s' does not exist (use a quoted sentence for literal prompts)", inputPathOrString)
+	}
+
+	// Input is considered a raw string
 	return inputPathOrString, nil
 }
 
+// FilePath returns the path of the file ReadInput reads for the given argument,
+// or "" if the argument is "-" or a literal prompt. "@path" always refers to a
+// file; any other argument does if it names an existing regular file,
+// regardless of its extension.
+func FilePath(inputPathOrString string) string {
+	if path, ok := strings.CutPrefix(inputPathOrString, "@"); ok && path != "" {
+		return path
+	}
+	if info, err := os.Stat(inputPathOrString); err == nil && info.Mode().IsRegular() {
+		return inputPathOrString
+	}
+	return ""
+}
+
+// ReadFile reads the prompt from the file at path.
+func ReadFile(path string, logger *slog.Logger) (string, error) {
+	logger.Debug("reading prompt from file", "path", path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file '%s': %w", path, err)
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return "", fmt.Errorf("prompt file '%s' is empty", path)
+	}
+	return string(content), nil
+}
+
+// ReadStdin reads the whole prompt from r, normally os.Stdin.
+func ReadStdin(r io.Reader, logger *slog.Logger) (string, error) {
+	logger.Debug("reading prompt from standard input")
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt from standard input: %w", err)
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return "", fmt.Errorf("prompt from standard input is empty")
+	}
+	return string(content), nil
+}
+
+// StdinIsPiped reports whether standard input is a pipe or a redirected file
+// rather than an interactive terminal.
+func StdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// StdinIsTerminal reports whether standard input is an interactive terminal,
+// meaning the user can be asked questions.
+func StdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// HasPromptExtension reports whether path has an extension used for prompt files.
+func HasPromptExtension(path string) bool {
+	return promptExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// pathPrefixes start arguments that are meant as file paths.
+var pathPrefixes = []string{"./", "../", "/", "~", `.\`, `..\`}
+
+// looksLikePath reports whether s is a single token that is probably meant as
+// a file path: it has a prompt file extension or starts like a path. A slash
+// inside a word, as in "TCP/IP" or "and/or", is not enough.
+func looksLikePath(s string) bool {
+	if strings.ContainsAny(s, " \t\r\n") || strings.Contains(s, "://") {
+		return false
+	}
+	for _, prefix := range pathPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return HasPromptExtension(s)
+}
+
 // HandleOutput writes the provided content either to the specified outputPath file
 // or to standard output if outputPath is empty.
-func HandleOutput(content string, outputPath string, verbose bool) error {
+func HandleOutput(content string, outputPath string, logger *slog.Logger) error {
 	if outputPath == "" {
 		// Write to standard output
-		// The final prompt is always printed, so no verbose check here.
+		// The final prompt is always printed; stdout carries nothing else.
 		_, err := fmt.Println(content) // fmt.Println writes to os.Stdout
 		if err != nil {
 			return fmt.Errorf("failed to write to standard output: %w", err)
 		}
 	} else {
 		// Write to the specified file
-		if verbose {
-			fmt.Printf("Writing enhanced prompt to file: %s\n", outputPath)
-		}
+		logger.Debug("writing enhanced prompt to file", "path", outputPath)
 		// Ensure parent directories exist? (os.MkdirAll(filepath.Dir(outputPath), 0755)) - Consider adding
 		err := os.WriteFile(outputPath, []byte(content), 0644) // Sensible default permissions
 		if err != nil {
 			return fmt.Errorf("failed to write output file '%s': %w", outputPath, err)
 		}
+		logger.Info("saved enhanced prompt", "path", outputPath)
 	}
 	return nil
 }
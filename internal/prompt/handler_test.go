@@ -0,0 +1,28 @@
+package prompt
+
+import "testing"
+
+func TestLooksLikePath(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"prompts/review.md", true},
+		{"review.txt", true},
+		{"./review", true},
+		{"../prompts/review", true},
+		{"/tmp/review", true},
+		{"~/review", true},
+		{`.\review`, true},
+		{"TCP/IP", false},
+		{"and/or", false},
+		{"https://example.com/prompt.md", false},
+		{"Summarize this/that article", false},
+		{"hello", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikePath(tt.arg); got != tt.want {
+			t.Errorf("looksLikePath(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package ratelimit paces API requests so concurrent callers stay within a
+// provider's requests-per-minute and tokens-per-minute quotas.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limits are the quotas of one provider or model. Zero means unlimited.
+type Limits struct {
+	RequestsPerMinute int `json:"rpm"`
+	TokensPerMinute   int `json:"tpm"`
+}
+
+// LoadLimits reads a JSON file mapping "provider" or "provider/model" keys
+// to limits, such as {"gemini": {"rpm": 10, "tpm": 250000}}.
+func LoadLimits(filePath string) (map[string]Limits, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limits '%s': %w", filePath, err)
+	}
+	var limits map[string]Limits
+	if err := json.Unmarshal(data, &limits); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rate limits JSON from '%s': %w", filePath, err)
+	}
+	for key, l := range limits {
+		if l.RequestsPerMinute < 0 || l.TokensPerMinute < 0 {
+			return nil, fmt.Errorf("rate limits for '%s' in '%s' cannot be negative", key, filePath)
+		}
+	}
+	return limits, nil
+}
+
+// bucket is a token bucket that may go into debt: a caller takes what it
+// needs at once and waits until the bucket has refilled past zero.
+type bucket struct {
+	rate     float64 // Tokens added per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(perMinute int, capacity float64, now time.Time) *bucket {
+	return &bucket{rate: float64(perMinute) / 60, capacity: capacity, tokens: capacity, last: now}
+}
+
+// take removes n tokens and returns how long the caller must wait for them.
+func (b *bucket) take(n float64, now time.Time) time.Duration {
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Stats describe how much a limiter slowed its callers down.
+type Stats struct {
+	Key       string        `json:"key"` // "provider/model"
+	Requests  int           `json:"requests"`
+	Waited    int           `json:"waited"` // Requests that had to wait
+	WaitTotal time.Duration `json:"-"`
+	WaitMax   time.Duration `json:"-"`
+}
+
+// MarshalJSON reports the wait times in milliseconds.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type plain Stats // Without the MarshalJSON method
+	return json.Marshal(struct {
+		plain
+		WaitTotalMs int64 `json:"waitTotalMs"`
+		WaitMaxMs   int64 `json:"waitMaxMs"`
+	}{plain(s), s.WaitTotal.Milliseconds(), s.WaitMax.Milliseconds()})
+}
+
+// clock is the time source of a Limiter, replaced in tests.
+type clock struct {
+	now func() time.Time
+	// after returns a channel that fires once d has passed, and a function
+	// that stops it.
+	after func(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// systemClock uses the real time.
+var systemClock = clock{
+	now: time.Now,
+	after: func(d time.Duration) (<-chan time.Time, func() bool) {
+		timer := time.NewTimer(d)
+		return timer.C, timer.Stop
+	},
+}
+
+// Limiter paces the requests to one model. Requests are spaced evenly to
+// stay under the requests-per-minute limit, and the tokens-per-minute
+// bucket allows bursts of up to a minute's worth of tokens. It is safe for
+// concurrent use, and a nil *Limiter never waits.
+type Limiter struct {
+	mu       sync.Mutex
+	requests *bucket // Nil without a requests-per-minute limit
+	tokens   *bucket // Nil without a tokens-per-minute limit
+	stats    Stats
+	clock    clock
+}
+
+// New returns a limiter for the given limits, or nil if they are unlimited.
+func New(key string, limits Limits) *Limiter {
+	return newWithClock(key, limits, systemClock)
+}
+
+// newWithClock is New with the given time source.
+func newWithClock(key string, limits Limits, clock clock) *Limiter {
+	if limits.RequestsPerMinute <= 0 && limits.TokensPerMinute <= 0 {
+		return nil
+	}
+	now := clock.now()
+	l := &Limiter{stats: Stats{Key: key}, clock: clock}
+	if limits.RequestsPerMinute > 0 {
+		l.requests = newBucket(limits.RequestsPerMinute, 1, now)
+	}
+	if limits.TokensPerMinute > 0 {
+		l.tokens = newBucket(limits.TokensPerMinute, float64(limits.TokensPerMinute), now)
+	}
+	return l
+}
+
+// Wait blocks until a request using about the given number of tokens may be
+// sent, or ctx is done. Once the response reports the real usage, call Settle.
+func (l *Limiter) Wait(ctx context.Context, tokens int) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	// Take what the request needs now, even if that puts the buckets in
+	// debt; the debt is how long this caller waits behind earlier ones.
+	l.mu.Lock()
+	now := l.clock.now()
+	var delay time.Duration
+	if l.requests != nil {
+		delay = l.requests.take(1, now)
+	}
+	if l.tokens != nil {
+		delay = max(delay, l.tokens.take(float64(tokens), now))
+	}
+	l.stats.Requests++
+	if delay > 0 {
+		l.stats.Waited++
+		l.stats.WaitTotal += delay
+		l.stats.WaitMax = max(l.stats.WaitMax, delay)
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return 0, nil
+	}
+	fired, stop := l.clock.after(delay)
+	defer stop()
+	select {
+	case <-fired:
+		return delay, nil
+	case <-ctx.Done():
+		// Give the reservation back so later callers do not wait for it.
+		l.mu.Lock()
+		if l.requests != nil {
+			l.requests.tokens++
+		}
+		if l.tokens != nil {
+			l.tokens.tokens += float64(tokens)
+		}
+		l.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// Settle corrects the tokens taken by Wait with the usage the API reported.
+func (l *Limiter) Settle(reserved int, actual int) {
+	if l == nil || l.tokens == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.tokens -= float64(actual - reserved)
+}
+
+// Stats returns the limiter's wait metrics so far.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Set hands out one shared Limiter per provider and model, configured by the
+// "provider/model" entry of its limits or, failing that, the "provider"
+// entry. It is safe for concurrent use, and a nil *Set never waits.
+type Set struct {
+	mu       sync.Mutex
+	limits   map[string]Limits
+	limiters map[string]*Limiter
+}
+
+// NewSet returns a set using the given limits.
+func NewSet(limits map[string]Limits) *Set {
+	return &Set{limits: limits, limiters: make(map[string]*Limiter)}
+}
+
+// Limiter returns the limiter for model on provider. It returns nil, which
+// never waits, if neither has limits.
+func (s *Set) Limiter(provider string, model string) *Limiter {
+	if s == nil {
+		return nil
+	}
+	key := provider + "/" + model
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.limiters[key]; ok {
+		return l
+	}
+	limits, ok := s.limits[key]
+	if !ok {
+		limits = s.limits[provider]
+	}
+	l := New(key, limits)
+	s.limiters[key] = l
+	return l
+}
+
+// Stats returns the wait metrics of every limiter used so far, sorted by key.
+func (s *Set) Stats() []Stats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stats []Stats
+	for _, l := range s.limiters {
+		if l != nil {
+			stats = append(stats, l.Stats())
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// WriteText writes a table of the stats to w.
+func WriteText(w io.Writer, stats []Stats) error {
+	if _, err := fmt.Fprintf(w, "%-43s %8s %6s %10s %10s\n", "RATE LIMIT", "REQUESTS", "WAITED", "WAIT TOTAL", "WAIT MAX"); err != nil {
+		return fmt.Errorf("failed to write rate limit report: %w", err)
+	}
+	for _, s := range stats {
+		_, err := fmt.Fprintf(w, "%-43s %8d %6d %10s %10s\n", s.Key, s.Requests, s.Waited, s.WaitTotal.Round(time.Millisecond), s.WaitMax.Round(time.Millisecond))
+		if err != nil {
+			return fmt.Errorf("failed to write rate limit report: %w", err)
+		}
+	}
+	return nil
+}
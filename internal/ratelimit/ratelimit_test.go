@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only moves when the test advances it.
+// Its timers fire at once, so Wait returns the delay without sleeping.
+type fakeClock struct {
+	now time.Time
+	// onWait, if set, is called instead of firing the timer.
+	onWait func(d time.Duration)
+}
+
+func (f *fakeClock) clock() clock {
+	return clock{
+		now: func() time.Time { return f.now },
+		after: func(d time.Duration) (<-chan time.Time, func() bool) {
+			fired := make(chan time.Time, 1)
+			if f.onWait != nil {
+				f.onWait(d)
+			} else {
+				fired <- f.now.Add(d)
+			}
+			return fired, func() bool { return true }
+		},
+	}
+}
+
+func TestWait(t *testing.T) {
+	type step struct {
+		advance time.Duration // Time passed since the previous step
+		tokens  int
+		want    time.Duration
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		steps  []step
+	}{
+		{
+			name:   "within the requests per minute",
+			limits: Limits{RequestsPerMinute: 60},
+			steps:  []step{{0, 0, 0}, {time.Second, 0, 0}, {2 * time.Second, 0, 0}},
+		},
+		{
+			name:   "requests wait behind earlier ones",
+			limits: Limits{RequestsPerMinute: 60},
+			steps:  []step{{0, 0, 0}, {0, 0, time.Second}, {0, 0, 2 * time.Second}},
+		},
+		{
+			name:   "debt is repaid as time passes",
+			limits: Limits{RequestsPerMinute: 60},
+			steps:  []step{{0, 0, 0}, {0, 0, time.Second}, {0, 0, 2 * time.Second}, {2 * time.Second, 0, time.Second}},
+		},
+		{
+			name:   "tokens refill",
+			limits: Limits{TokensPerMinute: 600},
+			steps:  []step{{0, 600, 0}, {0, 100, 10 * time.Second}, {30 * time.Second, 100, 0}},
+		},
+		{
+			name:   "refill stops at a minute's worth",
+			limits: Limits{TokensPerMinute: 600},
+			steps:  []step{{0, 0, 0}, {time.Hour, 600, 0}, {0, 60, 6 * time.Second}},
+		},
+		{
+			name:   "request larger than the bucket",
+			limits: Limits{TokensPerMinute: 60},
+			steps:  []step{{0, 180, 2 * time.Minute}, {time.Minute, 1, 61 * time.Second}},
+		},
+		{
+			name:   "longest of both limits",
+			limits: Limits{RequestsPerMinute: 60, TokensPerMinute: 60},
+			steps:  []step{{0, 10, 0}, {0, 1, time.Second}, {0, 100, 51 * time.Second}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeClock{now: time.Unix(0, 0)}
+			l := newWithClock("gemini/model", tt.limits, fake.clock())
+			waited := 0
+			for i, s := range tt.steps {
+				fake.now = fake.now.Add(s.advance)
+				got, err := l.Wait(context.Background(), s.tokens)
+				if err != nil {
+					t.Fatalf("step %d: Wait returned %v", i, err)
+				}
+				if got != s.want {
+					t.Errorf("step %d: Wait(%d) waited %v, want %v", i, s.tokens, got, s.want)
+				}
+				if got > 0 {
+					waited++
+				}
+			}
+			stats := l.Stats()
+			if stats.Requests != len(tt.steps) || stats.Waited != waited {
+				t.Errorf("Stats = %d requests, %d waited; want %d, %d", stats.Requests, stats.Waited, len(tt.steps), waited)
+			}
+		})
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	fake := &fakeClock{now: time.Unix(0, 0)}
+	l := newWithClock("gemini/model", Limits{RequestsPerMinute: 60, TokensPerMinute: 60}, fake.clock())
+	if _, err := l.Wait(context.Background(), 60); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second caller gives up while it waits for its turn.
+	ctx, cancel := context.WithCancel(context.Background())
+	fake.onWait = func(time.Duration) { cancel() }
+	got, err := l.Wait(ctx, 30)
+	if !errors.Is(err, context.Canceled) || got != 0 {
+		t.Fatalf("Wait = %v, %v; want 0, %v", got, err, context.Canceled)
+	}
+
+	// Its reservation was given back, so the next caller waits as if it
+	// had never asked.
+	fake.onWait = nil
+	if got, err := l.Wait(context.Background(), 30); err != nil || got != 30*time.Second {
+		t.Errorf("Wait after a cancelled caller = %v, %v; want %v", got, err, 30*time.Second)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	fake := &fakeClock{now: time.Unix(0, 0)}
+	l := newWithClock("gemini/model", Limits{TokensPerMinute: 60}, fake.clock())
+	if _, err := l.Wait(context.Background(), 30); err != nil {
+		t.Fatal(err)
+	}
+	l.Settle(30, 60) // The request used twice what was reserved
+	if got, _ := l.Wait(context.Background(), 30); got != 30*time.Second {
+		t.Errorf("Wait after Settle waited %v, want %v", got, 30*time.Second)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := New("gemini/model", Limits{})
+	if l != nil {
+		t.Fatalf("New with no limits = %v, want nil", l)
+	}
+	if got, err := l.Wait(context.Background(), 1_000_000); got != 0 || err != nil {
+		t.Errorf("nil Limiter Wait = %v, %v; want 0, nil", got, err)
+	}
+	l.Settle(0, 100) // Must not panic
+}
+
+func TestSetLimiter(t *testing.T) {
+	set := NewSet(map[string]Limits{
+		"gemini":       {RequestsPerMinute: 10},
+		"gemini/small": {RequestsPerMinute: 100},
+	})
+	if set.Limiter("gemini", "large") != set.Limiter("gemini", "large") {
+		t.Error("Limiter returned different limiters for the same model")
+	}
+	if l := set.Limiter("gemini", "small"); l.requests.rate != 100.0/60 {
+		t.Errorf("model limiter rate = %v, want the model entry", l.requests.rate)
+	}
+	if l := set.Limiter("gemini", "large"); l.requests.rate != 10.0/60 {
+		t.Errorf("provider limiter rate = %v, want the provider entry", l.requests.rate)
+	}
+	if l := set.Limiter("openai", "gpt"); l != nil {
+		t.Errorf("Limiter without limits = %v, want nil", l)
+	}
+}
@@ -0,0 +1,242 @@
+// Package regress compares enhanced prompts with golden outputs stored from
+// an earlier run, to show how a change to the guidelines shifts them.
+package regress
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	diff "tokinfo/internal/diff"
+	judge "tokinfo/internal/judge"
+)
+
+// Golden is the stored enhancement of one prompt of the corpus.
+type Golden struct {
+	ID             string `json:"id"`
+	Prompt         string `json:"prompt"`
+	Technique      string `json:"technique"`
+	EnhancedPrompt string `json:"enhancedPrompt"`
+	GuidelinesHash string `json:"guidelinesHash"`
+}
+
+// GoldenPath returns the golden file for the prompt id under dir. Path
+// separators in id are flattened so every golden file sits directly in dir.
+func GoldenPath(dir string, id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, filepath.ToSlash(filepath.Clean(id)))
+	return filepath.Join(dir, strings.TrimLeft(name, "._")+".golden.json")
+}
+
+// LoadGolden reads the golden file at path. The boolean is false if it does not exist.
+func LoadGolden(path string) (*Golden, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read golden file '%s': %w", path, err)
+	}
+	var golden Golden
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return nil, false, fmt.Errorf("failed to parse golden file '%s': %w", path, err)
+	}
+	return &golden, true, nil
+}
+
+// Write stores g at path, creating its directory if needed.
+func (g *Golden) Write(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create golden directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write golden file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// --- Comparison ---
+
+// Modes of comparing an enhanced prompt with its golden output.
+const (
+	ModeExact = "exact" // Any difference is a change
+	ModeWords = "words" // Word-frequency cosine similarity below the threshold is a change
+	ModeJudge = "judge" // A judge score of equivalence below the threshold is a change
+)
+
+// DefaultThreshold returns the default threshold of mode.
+func DefaultThreshold(mode string) float64 {
+	switch mode {
+	case ModeWords:
+		return 0.85
+	case ModeJudge:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// Equivalence is the criterion the judge compares an enhanced prompt with
+// its golden output on.
+var Equivalence = judge.Criterion{
+	Name:        "equivalence",
+	Description: "The enhanced prompt asks for the same task, with the same constraints, output format and level of detail, as the original (golden) prompt. Wording may differ.",
+}
+
+// Comparer compares enhanced prompts with golden outputs.
+type Comparer struct {
+	Mode      string
+	Threshold float64
+	// Judge scores equivalence in ModeJudge; it is unused otherwise.
+	Judge *judge.Judge
+}
+
+// Compare reports whether current differs from golden according to the
+// comparer's mode, with the score it was decided on (1 for identical text
+// in ModeExact) and a short explanation.
+func (c *Comparer) Compare(ctx context.Context, golden string, current string) (changed bool, score float64, detail string, err error) {
+	switch c.Mode {
+	case ModeExact:
+		if golden == current {
+			return false, 1, "", nil
+		}
+		inserted, deleted := diff.Stats(diff.Words(golden, current))
+		return true, 0, fmt.Sprintf("+%d -%d words", inserted, deleted), nil
+	case ModeWords:
+		score = WordSimilarity(golden, current)
+		return score < c.Threshold, score, fmt.Sprintf("word similarity %.2f (threshold %.2f)", score, c.Threshold), nil
+	case ModeJudge:
+		result, err := c.Judge.ScorePrompt(ctx, judge.PromptInput{Original: golden, Enhanced: current}, []judge.Criterion{Equivalence})
+		if err != nil {
+			return false, 0, "", err
+		}
+		s := result.Scores[0]
+		return float64(s.Score) < c.Threshold, float64(s.Score), fmt.Sprintf("judge %d/%d: %s", s.Score, judge.MaxScore, s.Justification), nil
+	default:
+		return false, 0, "", fmt.Errorf("unknown comparison mode '%s' (expected exact, words or judge)", c.Mode)
+	}
+}
+
+// WordSimilarity returns the cosine similarity, from 0 to 1, of the word
+// frequencies of a and b. It runs locally and needs no model, but it is not
+// an embedding similarity: it catches rewrites that change the vocabulary,
+// not those that keep the words and change the meaning, or the reverse.
+func WordSimilarity(a string, b string) float64 {
+	countA, countB := wordCounts(a), wordCounts(b)
+	if len(countA) == 0 && len(countB) == 0 {
+		return 1
+	}
+	var dot, normA, normB float64
+	for word, n := range countA {
+		dot += float64(n * countB[word])
+		normA += float64(n * n)
+	}
+	for _, n := range countB {
+		normB += float64(n * n)
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// wordCounts counts the lowercased words of text.
+func wordCounts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		counts[word]++
+	}
+	return counts
+}
+
+// --- Report ---
+
+// Case statuses.
+const (
+	StatusUnchanged = "unchanged"
+	StatusChanged   = "changed"
+	StatusNew       = "new"   // No golden output was stored yet
+	StatusError     = "error" // The prompt could not be enhanced or compared
+)
+
+// Case is the outcome of one prompt of the corpus.
+type Case struct {
+	ID              string  `json:"id"`
+	Status          string  `json:"status"`
+	GoldenTechnique string  `json:"goldenTechnique,omitempty"`
+	Technique       string  `json:"technique,omitempty"`
+	Score           float64 `json:"score"`
+	Detail          string  `json:"detail,omitempty"`
+	Golden          string  `json:"golden,omitempty"`
+	EnhancedPrompt  string  `json:"enhancedPrompt,omitempty"`
+	Updated         bool    `json:"updated,omitempty"` // The golden file was rewritten
+}
+
+// Report is the outcome of a regression run.
+type Report struct {
+	Mode           string         `json:"mode"`
+	Threshold      float64        `json:"threshold"`
+	GuidelinesHash string         `json:"guidelinesHash"`
+	Cases          []Case         `json:"cases"`
+	Counts         map[string]int `json:"counts"`
+}
+
+// Failed reports whether any case is not unchanged, leaving out the cases
+// whose golden output was updated.
+func (r *Report) Failed() bool {
+	for _, c := range r.Cases {
+		if c.Status != StatusUnchanged && !c.Updated {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText prints the cases that are not unchanged and the counts per
+// status to w. With showDiff, a unified diff follows every changed case.
+func (r *Report) WriteText(w io.Writer, showDiff bool, color bool) error {
+	var b strings.Builder
+	for _, c := range r.Cases {
+		if c.Status == StatusUnchanged {
+			continue
+		}
+		fmt.Fprintf(&b, "%-9s %s", strings.ToUpper(c.Status), c.ID)
+		if c.GoldenTechnique != "" && c.Technique != "" && c.GoldenTechnique != c.Technique {
+			fmt.Fprintf(&b, "  technique %s -> %s", c.GoldenTechnique, c.Technique)
+		}
+		if c.Detail != "" {
+			fmt.Fprintf(&b, "  %s", c.Detail)
+		}
+		if c.Updated {
+			b.WriteString("  (golden updated)")
+		}
+		b.WriteString("\n")
+		if showDiff && c.Status == StatusChanged {
+			b.WriteString(diff.Unified("golden", "current", c.Golden, c.EnhancedPrompt, 3, color))
+		}
+	}
+	fmt.Fprintf(&b, "%d prompts: %d unchanged, %d changed, %d new, %d errors\n", len(r.Cases),
+		r.Counts[StatusUnchanged], r.Counts[StatusChanged], r.Counts[StatusNew], r.Counts[StatusError])
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write regression report: %w", err)
+	}
+	return nil
+}
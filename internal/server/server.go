@@ -0,0 +1,404 @@
+// Package server exposes prompt analysis and refinement over an HTTP JSON API,
+// so other tools can enhance prompts without the CLI or a Gemini key.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	answers "tokinfo/internal/answers"
+	budget "tokinfo/internal/budget"
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+	preserve "tokinfo/internal/preserve"
+)
+
+// maxBodyBytes caps the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+// Options holds optional settings for the server.
+type Options struct {
+	// Token, if set, must be sent as "Authorization: Bearer <token>".
+	Token string
+	// SessionTTL is how long a session waits for its answers (default 30 minutes).
+	SessionTTL time.Duration
+}
+
+// Server handles the HTTP API. It is safe for concurrent use.
+type Server struct {
+	enhancer *enhance.Enhancer
+	logger   *slog.Logger
+	options  Options
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is an analyzed prompt waiting for the answers to its questions.
+type session struct {
+	prompt    string
+	analysis  *gemini.AnalysisResult
+	expiresAt time.Time
+}
+
+// New returns a server that enhances prompts with enhancer.
+func New(enhancer *enhance.Enhancer, logger *slog.Logger, options Options) *Server {
+	if options.SessionTTL <= 0 {
+		options.SessionTTL = 30 * time.Minute
+	}
+	return &Server{
+		enhancer: enhancer,
+		logger:   logger,
+		options:  options,
+		sessions: make(map[string]*session),
+	}
+}
+
+// --- Request and Response Bodies ---
+
+// AnalyzeRequest is the body of POST /v1/analyze and POST /v1/sessions.
+type AnalyzeRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+// RefineRequest is the body of POST /v1/refine. Answers map the question
+// text to its answer, as passed to the refinement stage.
+type RefineRequest struct {
+	Prompt    string            `json:"prompt"`
+	Technique string            `json:"technique"`
+	Answers   map[string]string `json:"answers"`
+}
+
+// RefineResponse is the result of POST /v1/refine.
+type RefineResponse struct {
+	Technique      string `json:"technique"`
+	EnhancedPrompt string `json:"enhancedPrompt"`
+}
+
+// EnhanceRequest is the body of POST /v1/enhance. Answers are keyed like an
+// answers file: by question text, a fragment of it, or the 1-based question
+// number. Unanswered questions get the model's example answer, or are left
+// out when Unanswered is "skip".
+type EnhanceRequest struct {
+	Prompt     string            `json:"prompt"`
+	Answers    map[string]string `json:"answers"`
+	Unanswered string            `json:"unanswered"`
+}
+
+// AnswersRequest is the body of POST /v1/sessions/{id}/answers.
+type AnswersRequest struct {
+	Answers    map[string]string `json:"answers"`
+	Unanswered string            `json:"unanswered"`
+}
+
+// SessionResponse describes a session waiting for answers.
+type SessionResponse struct {
+	ID        string `json:"id"`
+	ExpiresAt string `json:"expiresAt"` // RFC 3339
+	gemini.AnalysisResult
+}
+
+// errorResponse is the body of every error response. Missing lists the
+// protected parts of the prompt a refinement lost, with status 422.
+type errorResponse struct {
+	Error   string          `json:"error"`
+	Missing []preserve.Span `json:"missing,omitempty"`
+}
+
+// httpError is an error with the status code to report it with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...any) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// --- Routing ---
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/analyze", s.handle(s.analyze))
+	mux.HandleFunc("POST /v1/refine", s.handle(s.refine))
+	mux.HandleFunc("POST /v1/enhance", s.handle(s.enhance))
+	mux.HandleFunc("POST /v1/sessions", s.handle(s.createSession))
+	mux.HandleFunc("GET /v1/sessions/{id}", s.handle(s.getSession))
+	mux.HandleFunc("POST /v1/sessions/{id}/answers", s.handle(s.answerSession))
+	mux.HandleFunc("DELETE /v1/sessions/{id}", s.handle(s.deleteSession))
+	mux.HandleFunc("GET /v1/techniques", s.handle(s.techniques))
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests without the configured bearer token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.options.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.options.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handle adapts an endpoint returning a response body or an error into an
+// http.HandlerFunc, and logs every request.
+func (s *Server) handle(endpoint func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		body, err := endpoint(r)
+
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusBadGateway // Gemini calls are the usual cause
+			var target *httpError
+			var lost *preserve.Error
+			switch {
+			case errors.As(err, &target):
+				status = target.status
+			case errors.Is(err, budget.ErrPromptExceedsBudget):
+				status = http.StatusRequestEntityTooLarge
+			case errors.As(err, &lost):
+				status = http.StatusUnprocessableEntity // The refinement could not keep the protected content
+			case errors.Is(err, context.Canceled):
+				status = 499 // Client closed the request; nobody reads the response
+			}
+			response := errorResponse{Error: err.Error()}
+			if lost != nil {
+				response.Missing = lost.Missing
+			}
+			body = response
+		}
+		writeJSON(w, status, body)
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []any{"method", r.Method, "path", r.URL.Path, "status", status, "duration", time.Since(started)}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		s.logger.Log(r.Context(), level, "request", attrs...)
+	}
+}
+
+// writeJSON writes body as the JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) // The client may be gone; nothing to do about it
+}
+
+// decode reads the JSON request body into v.
+func decode(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errorf(http.StatusRequestEntityTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+		}
+		return errorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// checkUnanswered rejects unknown policies for unanswered questions.
+func checkUnanswered(unanswered string) error {
+	if !enhance.ValidUnanswered(unanswered) {
+		return errorf(http.StatusBadRequest, "unknown unanswered value '%s' (expected example or skip)", unanswered)
+	}
+	return nil
+}
+
+// requirePrompt rejects empty prompts before they reach the API.
+func requirePrompt(prompt string) error {
+	if strings.TrimSpace(prompt) == "" {
+		return errorf(http.StatusBadRequest, "prompt is required")
+	}
+	return nil
+}
+
+// --- Endpoints ---
+
+// analyze runs Stage 1 and returns the AnalysisResult.
+func (s *Server) analyze(r *http.Request) (any, error) {
+	var req AnalyzeRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := requirePrompt(req.Prompt); err != nil {
+		return nil, err
+	}
+	return s.enhancer.Analyze(r.Context(), req.Prompt)
+}
+
+// refine runs Stage 2 with the given technique and answers.
+func (s *Server) refine(r *http.Request) (any, error) {
+	var req RefineRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := requirePrompt(req.Prompt); err != nil {
+		return nil, err
+	}
+	enhanced, err := s.enhancer.Refine(r.Context(), req.Prompt, req.Technique, req.Answers)
+	if errors.Is(err, enhance.ErrUnknownTechnique) {
+		return nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return RefineResponse{Technique: req.Technique, EnhancedPrompt: enhanced}, nil
+}
+
+// enhance runs the whole pipeline without asking questions.
+func (s *Server) enhance(r *http.Request) (any, error) {
+	var req EnhanceRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := requirePrompt(req.Prompt); err != nil {
+		return nil, err
+	}
+	if err := checkUnanswered(req.Unanswered); err != nil {
+		return nil, err
+	}
+	return s.enhancer.Enhance(r.Context(), req.Prompt, enhance.Answering{Provided: answers.FromMap(req.Answers), Unanswered: req.Unanswered})
+}
+
+// createSession runs Stage 1 and keeps the result until the questions are answered.
+func (s *Server) createSession(r *http.Request) (any, error) {
+	var req AnalyzeRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := requirePrompt(req.Prompt); err != nil {
+		return nil, err
+	}
+	analysis, err := s.enhancer.Analyze(r.Context(), req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to create session id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+	sess := &session{prompt: req.Prompt, analysis: analysis, expiresAt: time.Now().Add(s.options.SessionTTL)}
+
+	s.mu.Lock()
+	s.pruneSessions()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+	return sessionResponse(id, sess), nil
+}
+
+// getSession returns the questions of a session.
+func (s *Server) getSession(r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	sess, err := s.lookupSession(id, false)
+	if err != nil {
+		return nil, err
+	}
+	return sessionResponse(id, sess), nil
+}
+
+// answerSession runs Stage 2 with the answers and ends the session.
+func (s *Server) answerSession(r *http.Request) (any, error) {
+	var req AnswersRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := checkUnanswered(req.Unanswered); err != nil {
+		return nil, err
+	}
+	sess, err := s.lookupSession(r.PathValue("id"), true)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.enhancer.Complete(r.Context(), sess.prompt, sess.analysis, enhance.Answering{Provided: answers.FromMap(req.Answers), Unanswered: req.Unanswered})
+	if err != nil {
+		// Keep the session so the client can retry the refinement.
+		s.mu.Lock()
+		s.sessions[r.PathValue("id")] = sess
+		s.mu.Unlock()
+		return nil, err
+	}
+	return response, nil
+}
+
+// deleteSession discards a session.
+func (s *Server) deleteSession(r *http.Request) (any, error) {
+	if _, err := s.lookupSession(r.PathValue("id"), true); err != nil {
+		return nil, err
+	}
+	return struct{}{}, nil
+}
+
+// techniques lists the techniques a prompt can be refined with.
+func (s *Server) techniques(r *http.Request) (any, error) {
+	type technique struct {
+		Name    string `json:"name"`
+		Summary string `json:"summary"`
+	}
+	list := []technique{}
+	for _, tech := range s.enhancer.Guidelines().Techniques {
+		list = append(list, technique{Name: tech.Name, Summary: tech.Summarized})
+	}
+	return list, nil
+}
+
+// --- Sessions ---
+
+// lookupSession returns the session with the given id, removing it if take is set.
+func (s *Server) lookupSession(id string, take bool) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneSessions()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "session '%s' not found or expired", id)
+	}
+	if take {
+		delete(s.sessions, id)
+	}
+	return sess, nil
+}
+
+// pruneSessions drops expired sessions. s.mu must be held.
+func (s *Server) pruneSessions() {
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.After(sess.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// sessionResponse describes sess to the client.
+func sessionResponse(id string, sess *session) SessionResponse {
+	return SessionResponse{ID: id, ExpiresAt: sess.expiresAt.UTC().Format(time.RFC3339), AnalysisResult: *sess.analysis}
+}
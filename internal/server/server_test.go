@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	budget "tokinfo/internal/budget"
+	config "tokinfo/internal/config"
+	enhance "tokinfo/internal/enhance"
+	gemini "tokinfo/internal/gemini"
+	preserve "tokinfo/internal/preserve"
+)
+
+// fakeGemini answers generateContent requests like the Gemini API: the
+// analysis with a fixed technique and question, and the refinement with
+// refine applied to the request.
+type fakeGemini struct {
+	refine func(request string) string
+
+	mu       sync.Mutex
+	calls    int
+	requests []string // Refinement requests, in order
+}
+
+func (f *fakeGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	text := `{"ChoseTechnique": "Few-shot", "ClarifyingQuestions": [{"question": "Who is the audience?", "exampleAnswer": "developers"}], "Rationale": "Examples help."}`
+	if !bytes.Contains(body, []byte("responseSchema")) {
+		f.mu.Lock()
+		f.requests = append(f.requests, string(body))
+		f.mu.Unlock()
+		text = "Enhanced prompt."
+		if f.refine != nil {
+			text = f.refine(string(body))
+		}
+	}
+	response := map[string]any{
+		"candidates": []any{map[string]any{
+			"content":      map[string]any{"role": "model", "parts": []any{map[string]any{"text": text}}},
+			"finishReason": "STOP",
+		}},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// newTestServer returns a server for the API, backed by fake as the Gemini API.
+func newTestServer(t *testing.T, fake *fakeGemini, options Options) *httptest.Server {
+	t.Helper()
+	api := httptest.NewServer(fake)
+	t.Cleanup(api.Close)
+	client, err := gemini.NewClient(context.Background(), "test-key", gemini.Options{BaseURL: api.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guidelines := &config.Guidelines{
+		Introduction: "Introduction.",
+		Techniques:   []config.Technique{{Name: "Few-shot", Summarized: "Show examples.", Complete: "Show a few examples of the task."}},
+	}
+	s := New(enhance.New(client, guidelines), slog.New(slog.DiscardHandler), options)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// call sends a request with an optional JSON body and returns the status and
+// the decoded response.
+func call(t *testing.T, ts *httptest.Server, method string, path string, body string, header http.Header) (int, map[string]any) {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded any
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("%s %s: invalid JSON response: %v", method, path, err)
+	}
+	object, _ := decoded.(map[string]any)
+	return resp.StatusCode, object
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"token without scheme", "secret", "secret", http.StatusUnauthorized},
+		{"token prefix", "secret", "Bearer secre", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, &fakeGemini{}, Options{Token: tt.token})
+			header := http.Header{}
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+			status, body := call(t, ts, http.MethodGet, "/v1/techniques", "", header)
+			if status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+			if status == http.StatusUnauthorized && body["error"] == nil {
+				t.Errorf("401 response %v has no error", body)
+			}
+		})
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	lost := &preserve.Error{Missing: []preserve.Span{{Kind: preserve.KindURL, Text: "https://example.com", Line: 1}}}
+	tests := []struct {
+		name        string
+		err         error
+		want        int
+		wantMissing bool
+	}{
+		{"success", nil, http.StatusOK, false},
+		{"http error", errorf(http.StatusNotFound, "not found"), http.StatusNotFound, false},
+		{"over budget", fmt.Errorf("stage 2: %w", budget.ErrPromptExceedsBudget), http.StatusRequestEntityTooLarge, false},
+		{"lost content", fmt.Errorf("stage 2 Gemini call failed: %w", lost), http.StatusUnprocessableEntity, true},
+		{"client gone", fmt.Errorf("waiting: %w", context.Canceled), 499, false},
+		{"gemini failure", errors.New("failed to generate content"), http.StatusBadGateway, false},
+	}
+	s := New(nil, slog.New(slog.DiscardHandler), Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := s.handle(func(*http.Request) (any, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return struct{}{}, nil
+			})
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, "/v1/refine", strings.NewReader("{}")))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.err == nil {
+				return
+			}
+			var body errorResponse
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.err.Error() {
+				t.Errorf("error = %q, want %q", body.Error, tt.err.Error())
+			}
+			if got := len(body.Missing) > 0; got != tt.wantMissing {
+				t.Errorf("response lists missing spans = %v, want %v", got, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	fake := &fakeGemini{}
+	ts := newTestServer(t, fake, Options{})
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"empty prompt", "/v1/analyze", `{"prompt": " "}`, http.StatusBadRequest},
+		{"unknown field", "/v1/analyze", `{"prompt": "Write a haiku.", "model": "x"}`, http.StatusBadRequest},
+		{"invalid JSON", "/v1/enhance", `{"prompt":`, http.StatusBadRequest},
+		{"unknown unanswered", "/v1/enhance", `{"prompt": "Write a haiku.", "unanswered": "guess"}`, http.StatusBadRequest},
+		{"unknown technique", "/v1/refine", `{"prompt": "Write a haiku.", "technique": "Telepathy"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, ts, http.MethodPost, tt.path, tt.body, nil)
+			if status != tt.want {
+				t.Errorf("status = %d (%v), want %d", status, body["error"], tt.want)
+			}
+		})
+	}
+	if fake.calls != 0 {
+		t.Errorf("rejected requests made %d Gemini calls, want none", fake.calls)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	ts := newTestServer(t, &fakeGemini{}, Options{})
+	// A prompt just under the limit is accepted; one byte more is not.
+	prefix, suffix := `{"prompt": "`, `"}`
+	fits := prefix + strings.Repeat("a", maxBodyBytes-len(prefix)-len(suffix)) + suffix
+	if status, body := call(t, ts, http.MethodPost, "/v1/analyze", fits, nil); status != http.StatusOK {
+		t.Errorf("body of %d bytes: status = %d (%v), want %d", len(fits), status, body["error"], http.StatusOK)
+	}
+	tooLarge := prefix + strings.Repeat("a", maxBodyBytes-len(prefix)-len(suffix)+1) + suffix
+	status, body := call(t, ts, http.MethodPost, "/v1/analyze", tooLarge, nil)
+	if status != http.StatusRequestEntityTooLarge || !strings.Contains(fmt.Sprint(body["error"]), fmt.Sprint(maxBodyBytes)) {
+		t.Errorf("body of %d bytes: status = %d (%v), want %d naming the limit", len(tooLarge), status, body["error"], http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	fake := &fakeGemini{}
+	ts := newTestServer(t, fake, Options{})
+
+	status, created := call(t, ts, http.MethodPost, "/v1/sessions", `{"prompt": "Write a haiku."}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("create: status = %d (%v)", status, created["error"])
+	}
+	id, _ := created["id"].(string)
+	questions, _ := created["ClarifyingQuestions"].([]any)
+	if id == "" || created["expiresAt"] == nil || created["ChoseTechnique"] != "Few-shot" || len(questions) != 1 {
+		t.Fatalf("create returned %v, want an id, an expiry and the analysis", created)
+	}
+	if status, got := call(t, ts, http.MethodGet, "/v1/sessions/"+id, "", nil); status != http.StatusOK || got["id"] != id {
+		t.Fatalf("get: status = %d, body %v", status, got)
+	}
+
+	status, result := call(t, ts, http.MethodPost, "/v1/sessions/"+id+"/answers", `{"answers": {"1": "poets"}}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("answers: status = %d (%v)", status, result["error"])
+	}
+	answered, _ := result["questions"].([]any)
+	if result["enhancedPrompt"] != "Enhanced prompt." || len(answered) != 1 {
+		t.Fatalf("answers returned %v, want the enhanced prompt and the answered question", result)
+	}
+	if q, _ := answered[0].(map[string]any); q["answer"] != "poets" || q["source"] != "provided" {
+		t.Errorf("answered question = %v, want the provided answer", q)
+	}
+	if last := fake.requests[len(fake.requests)-1]; !strings.Contains(last, "poets") {
+		t.Error("refinement request does not carry the answer")
+	}
+
+	// Answering ends the session.
+	if status, _ := call(t, ts, http.MethodGet, "/v1/sessions/"+id, "", nil); status != http.StatusNotFound {
+		t.Errorf("get after answers: status = %d, want %d", status, http.StatusNotFound)
+	}
+	if status, _ := call(t, ts, http.MethodPost, "/v1/sessions/"+id+"/answers", `{}`, nil); status != http.StatusNotFound {
+		t.Errorf("second answers: status = %d, want %d", status, http.StatusNotFound)
+	}
+
+	// A deleted session is gone.
+	_, created = call(t, ts, http.MethodPost, "/v1/sessions", `{"prompt": "Write a haiku."}`, nil)
+	id, _ = created["id"].(string)
+	if status, _ := call(t, ts, http.MethodDelete, "/v1/sessions/"+id, "", nil); status != http.StatusOK {
+		t.Errorf("delete: status = %d, want %d", status, http.StatusOK)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if status, _ := call(t, ts, method, "/v1/sessions/"+id, "", nil); status != http.StatusNotFound {
+			t.Errorf("%s after delete: status = %d, want %d", method, status, http.StatusNotFound)
+		}
+	}
+}
+
+func TestSessionKeptOnFailure(t *testing.T) {
+	fake := &fakeGemini{refine: func(string) string { return "Summarize the report." }}
+	ts := newTestServer(t, fake, Options{})
+	_, created := call(t, ts, http.MethodPost, "/v1/sessions", `{"prompt": "Summarize https://example.com/report."}`, nil)
+	id, _ := created["id"].(string)
+
+	// The refinement keeps losing the URL, so the answers fail with 422 and
+	// the session stays for another try.
+	status, body := call(t, ts, http.MethodPost, "/v1/sessions/"+id+"/answers", `{}`, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("answers: status = %d (%v), want %d", status, body["error"], http.StatusUnprocessableEntity)
+	}
+	missing, _ := body["missing"].([]any)
+	if len(missing) != 1 {
+		t.Fatalf("missing = %v, want the lost URL", body["missing"])
+	}
+	if span, _ := missing[0].(map[string]any); span["kind"] != preserve.KindURL || span["text"] != "https://example.com/report" || span["line"] != 1.0 {
+		t.Errorf("missing span = %v, want the URL on line 1", span)
+	}
+	if len(fake.requests) != 2 || !strings.Contains(fake.requests[1], "**Retry:**") {
+		t.Errorf("made %d refinement requests, want the first and a retry", len(fake.requests))
+	}
+	if status, _ := call(t, ts, http.MethodGet, "/v1/sessions/"+id, "", nil); status != http.StatusOK {
+		t.Errorf("get after a failed refinement: status = %d, want %d", status, http.StatusOK)
+	}
+}
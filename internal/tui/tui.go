@@ -0,0 +1,431 @@
+// Package tui implements the full-screen terminal interface for an enhancement
+// session: the original prompt, the chosen technique, editable answers to the
+// clarifying questions and a live word diff of the enhanced prompt.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	diff "tokinfo/internal/diff"
+)
+
+// ANSI escape sequences used for drawing.
+const (
+	clearScreen  = "\x1b[H\x1b[2J"
+	altScreenOn  = "\x1b[?1049h\x1b[?25l" // Switch to the alternate screen and hide the cursor
+	altScreenOff = "\x1b[?25h\x1b[?1049l" // Show the cursor and return to the normal screen
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleInvert  = "\x1b[7m"
+	styleInsert  = "\x1b[32m"   // Green
+	styleDelete  = "\x1b[31;9m" // Red, struck through
+)
+
+// Key codes read from the terminal in raw mode.
+const (
+	keyCtrlC     = 0x03
+	keyCtrlE     = 0x05
+	keyBackspace = 0x08
+	keyTab       = 0x09
+	keyEnter     = 0x0d
+	keyCtrlQ     = 0x11
+	keyCtrlR     = 0x12
+	keyCtrlS     = 0x13
+	keyCtrlT     = 0x14
+	keyCtrlU     = 0x15
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// helpLine lists the keybindings at the bottom of the screen.
+const helpLine = "↑/↓ select · type to edit · ^E example · ^U clear · ^R re-run · ^T technique · ^S save · ^Q quit"
+
+// Question is a clarifying question shown with an editable answer field.
+type Question struct {
+	Text    string
+	Example string
+}
+
+// Technique is a technique the user can switch to.
+type Technique struct {
+	Name    string
+	Summary string
+}
+
+// Session holds the inputs of the interface and the callbacks it uses to
+// refine and save the prompt.
+type Session struct {
+	Prompt     string
+	Techniques []Technique
+	Technique  int // Index of the technique recommended by the analysis
+	Questions  []Question
+	Answers    []string // Initial answers, one per question; missing entries start empty
+	SavePath   string   // Path offered by default when saving
+	// Refine returns the enhanced prompt for the technique at the given index and answers.
+	Refine func(technique int, answers []string) (string, error)
+	// Save writes content to path.
+	Save func(path string, content string) error
+}
+
+// Result is the state of the session when the interface exits.
+type Result struct {
+	Enhanced string
+	SavedTo  string // Empty if the prompt was never saved
+}
+
+// model is the mutable state of a running interface.
+type model struct {
+	session   Session
+	technique int
+	answers   []string
+	focus     int
+	enhanced  string
+	status    string
+	saving    bool // The status line is an input for the save path
+	savePath  string
+	savedTo   string
+	out       *bufio.Writer
+}
+
+// Run takes over the terminal until the user quits and returns the final
+// enhanced prompt. Standard input and output must be terminals.
+func Run(session Session) (Result, error) {
+	inFd := int(os.Stdin.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return Result{}, fmt.Errorf("the terminal UI needs an interactive terminal on stdin and stdout")
+	}
+	if len(session.Techniques) == 0 {
+		return Result{}, fmt.Errorf("the terminal UI needs at least one technique")
+	}
+
+	oldState, err := term.MakeRaw(inFd)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to switch terminal to raw mode: %w", err)
+	}
+	defer term.Restore(inFd, oldState)
+
+	m := &model{
+		session:   session,
+		technique: session.Technique,
+		answers:   make([]string, len(session.Questions)),
+		savePath:  session.SavePath,
+		out:       bufio.NewWriter(os.Stdout),
+	}
+	copy(m.answers, session.Answers)
+	if m.technique < 0 || m.technique >= len(session.Techniques) {
+		m.technique = 0
+	}
+
+	m.out.WriteString(altScreenOn)
+	defer func() {
+		m.out.WriteString(altScreenOff)
+		m.out.Flush()
+	}()
+
+	// Show the first refinement straight away so the diff is never empty.
+	m.refine()
+
+	buf := make([]byte, 256)
+	for {
+		m.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return m.result(), fmt.Errorf("failed to read from terminal: %w", err)
+		}
+		if quit := m.handleInput(buf[:n]); quit {
+			return m.result(), nil
+		}
+	}
+}
+
+// result returns the final state of the session.
+func (m *model) result() Result {
+	return Result{Enhanced: m.enhanced, SavedTo: m.savedTo}
+}
+
+// refine calls the Refine callback with the current technique and answers.
+func (m *model) refine() {
+	m.status = "Refining with " + m.session.Techniques[m.technique].Name + "..."
+	m.render()
+	enhanced, err := m.session.Refine(m.technique, m.answers)
+	if err != nil {
+		m.status = "Refinement failed: " + err.Error()
+		return
+	}
+	m.enhanced = enhanced
+	inserted, deleted := diff.Stats(diff.Words(m.session.Prompt, enhanced))
+	m.status = fmt.Sprintf("Refined with %s: +%d / -%d words", m.session.Techniques[m.technique].Name, inserted, deleted)
+}
+
+// handleInput applies the keys in input and reports whether the user quit.
+func (m *model) handleInput(input []byte) bool {
+	// Escape sequences for the arrow keys and Shift+Tab.
+	if len(input) >= 3 && input[0] == keyEscape && input[1] == '[' {
+		switch input[2] {
+		case 'A', 'Z':
+			m.moveFocus(-1)
+		case 'B':
+			m.moveFocus(1)
+		}
+		return false
+	}
+	if len(input) == 1 && input[0] == keyEscape {
+		m.saving = false
+		m.status = ""
+		return false
+	}
+
+	for len(input) > 0 {
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+		switch r {
+		case keyCtrlC, keyCtrlQ:
+			return true
+		case keyTab:
+			m.moveFocus(1)
+		case keyEnter:
+			if m.saving {
+				m.save()
+			} else {
+				m.moveFocus(1)
+			}
+		case keyBackspace, keyDelete:
+			field := m.field()
+			if field != nil && *field != "" {
+				_, last := utf8.DecodeLastRuneInString(*field)
+				*field = (*field)[:len(*field)-last]
+			}
+		case keyCtrlU:
+			if field := m.field(); field != nil {
+				*field = ""
+			}
+		case keyCtrlE:
+			if !m.saving && len(m.answers) > 0 {
+				m.answers[m.focus] = m.session.Questions[m.focus].Example
+			}
+		case keyCtrlR:
+			m.saving = false
+			m.refine()
+		case keyCtrlT:
+			m.technique = (m.technique + 1) % len(m.session.Techniques)
+			m.status = "Technique changed to " + m.session.Techniques[m.technique].Name + "; press ^R to re-run"
+		case keyCtrlS:
+			m.saving = true
+			m.status = ""
+		default:
+			if field := m.field(); field != nil && unicode.IsPrint(r) {
+				*field += string(r)
+			}
+		}
+	}
+	return false
+}
+
+// field returns the text being edited: the save path or the focused answer.
+func (m *model) field() *string {
+	if m.saving {
+		return &m.savePath
+	}
+	if len(m.answers) == 0 {
+		return nil
+	}
+	return &m.answers[m.focus]
+}
+
+// moveFocus moves the answer focus by delta, wrapping around.
+func (m *model) moveFocus(delta int) {
+	if len(m.answers) == 0 || m.saving {
+		return
+	}
+	m.focus = (m.focus + delta + len(m.answers)) % len(m.answers)
+}
+
+// save writes the enhanced prompt to the path typed in the status line.
+func (m *model) save() {
+	path := strings.TrimSpace(m.savePath)
+	if path == "" {
+		m.status = "Enter a file path to save to"
+		return
+	}
+	m.saving = false
+	if err := m.session.Save(path, m.enhanced); err != nil {
+		m.status = "Save failed: " + err.Error()
+		return
+	}
+	m.savedTo = path
+	m.status = "Saved to " + path
+}
+
+// render draws the whole screen.
+func (m *model) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 10 {
+		width, height = 80, 24
+	}
+
+	tech := m.session.Techniques[m.technique]
+	recommended := ""
+	if m.technique == m.session.Technique {
+		recommended = " (recommended)"
+	}
+	header := []string{styleBold + truncate(fmt.Sprintf("tokinfo · Technique: %s%s [%d/%d]", tech.Name, recommended, m.technique+1, len(m.session.Techniques)), width) + styleReset}
+	for _, line := range limit(wrap(tech.Summary, width), 3) {
+		header = append(header, styleDim+line+styleReset)
+	}
+
+	original := append([]string{section("Original prompt", width)}, limit(wrap(m.session.Prompt, width), max(3, height/6))...)
+
+	questions := []string{section("Clarifying questions", width)}
+	if len(m.session.Questions) == 0 {
+		questions = append(questions, styleDim+"No clarifying questions."+styleReset)
+	}
+	for i, q := range m.session.Questions {
+		marker := "  "
+		if i == m.focus && !m.saving {
+			marker = "> "
+		}
+		questions = append(questions, truncate(fmt.Sprintf("%s%d. %s", marker, i+1, q.Text), width))
+		answer := m.answers[i]
+		switch {
+		case i == m.focus && !m.saving:
+			answer = "    " + styleInvert + answer + " " + styleReset
+		case answer == "":
+			answer = "    " + styleDim + "e.g. " + q.Example + styleReset
+		default:
+			answer = "    " + answer
+		}
+		questions = append(questions, answer)
+	}
+
+	footer := []string{section("", width), m.statusLine(width), styleDim + truncate(helpLine, width) + styleReset}
+
+	// The diff gets whatever space is left.
+	used := len(header) + len(original) + len(questions) + len(footer) + 1
+	diffLines := limit(renderDiff(diff.Words(m.session.Prompt, m.enhanced), width), max(3, height-used))
+	enhanced := append([]string{section("Enhanced prompt (diff)", width)}, diffLines...)
+
+	var lines []string
+	for _, part := range [][]string{header, original, questions, enhanced} {
+		lines = append(lines, part...)
+	}
+	// Pad so the footer sits at the bottom of the screen.
+	for len(lines)+len(footer) < height {
+		lines = append(lines, "")
+	}
+	lines = append(lines[:min(len(lines), height-len(footer))], footer...)
+
+	m.out.WriteString(clearScreen)
+	m.out.WriteString(strings.Join(lines, "\r\n"))
+	m.out.Flush()
+}
+
+// statusLine renders the status message or the save path input.
+func (m *model) statusLine(width int) string {
+	if m.saving {
+		return truncate("Save to: ", width) + styleInvert + m.savePath + " " + styleReset
+	}
+	return truncate(m.status, width)
+}
+
+// section renders a horizontal rule with an optional title.
+func section(title string, width int) string {
+	if title != "" {
+		title = "── " + title + " "
+	}
+	fill := width - utf8.RuneCountInString(title)
+	if fill < 0 {
+		fill = 0
+	}
+	return styleDim + title + strings.Repeat("─", fill) + styleReset
+}
+
+// renderDiff lays out word diff edits in lines at most width columns wide,
+// coloring insertions and deletions.
+func renderDiff(edits []diff.Edit, width int) []string {
+	var lines []string
+	var line strings.Builder
+	col := 0
+	flush := func() {
+		lines = append(lines, line.String())
+		line.Reset()
+		col = 0
+	}
+
+	for _, e := range edits {
+		style := ""
+		switch e.Op {
+		case diff.Insert:
+			style = styleInsert
+		case diff.Delete:
+			style = styleDelete
+		}
+		for _, token := range diff.Tokenize(e.Text) {
+			if strings.TrimSpace(token) == "" {
+				// Whitespace: keep line breaks, collapse the rest to one space.
+				for i := 0; i < strings.Count(token, "\n"); i++ {
+					flush()
+				}
+				if !strings.Contains(token, "\n") && col > 0 && col < width {
+					line.WriteString(" ")
+					col++
+				}
+				continue
+			}
+			n := utf8.RuneCountInString(token)
+			if col > 0 && col+n > width {
+				flush()
+			}
+			line.WriteString(style + token + styleReset)
+			col += n
+		}
+	}
+	if col > 0 {
+		flush()
+	}
+	return lines
+}
+
+// wrap breaks text into lines at most width columns wide, keeping line breaks.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, truncate(line, width))
+	}
+	return lines
+}
+
+// limit keeps at most n lines, marking the cut with an ellipsis.
+func limit(lines []string, n int) []string {
+	if len(lines) <= n {
+		return lines
+	}
+	return append(lines[:n-1], styleDim+"…"+styleReset)
+}
+
+// truncate shortens s to width runes.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,173 @@
+// Package usage records token usage for every Gemini call and converts it
+// into an estimated cost using a configurable price table.
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Usage holds the token counts reported by the API for one or more calls.
+type Usage struct {
+	Calls           int `json:"calls"`
+	PromptTokens    int `json:"promptTokens"`
+	CandidateTokens int `json:"candidateTokens"`
+	ThinkingTokens  int `json:"thinkingTokens"`
+	TotalTokens     int `json:"totalTokens"`
+}
+
+// add accumulates other into u.
+func (u *Usage) add(other Usage) {
+	u.Calls += other.Calls
+	u.PromptTokens += other.PromptTokens
+	u.CandidateTokens += other.CandidateTokens
+	u.ThinkingTokens += other.ThinkingTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// Price defines the cost in USD per million tokens for a single model.
+type Price struct {
+	InputPerMillion    float64 `json:"input"`
+	OutputPerMillion   float64 `json:"output"`
+	ThinkingPerMillion float64 `json:"thinking"` // Falls back to output when zero
+}
+
+// PriceTable maps model names to their prices.
+type PriceTable map[string]Price
+
+// DefaultPriceTable returns the built-in prices for the models tokinfo uses.
+// Prices change over time; use LoadPriceTable to override them.
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"gemini-2.5-flash-preview-04-17": {InputPerMillion: 0.15, OutputPerMillion: 0.60, ThinkingPerMillion: 3.50},
+	}
+}
+
+// LoadPriceTable reads a JSON price table from filePath and merges it over the defaults.
+// The file maps model names to objects with "input", "output" and "thinking" prices.
+func LoadPriceTable(filePath string) (PriceTable, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table '%s': %w", filePath, err)
+	}
+
+	var overrides PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal price table JSON from '%s': %w", filePath, err)
+	}
+
+	prices := DefaultPriceTable()
+	for model, price := range overrides {
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// Cost returns the estimated cost in USD of the given usage on model.
+// The second return value is false if the model has no price in the table.
+func (p PriceTable) Cost(model string, u Usage) (float64, bool) {
+	price, ok := p[model]
+	if !ok {
+		return 0, false
+	}
+	thinking := price.ThinkingPerMillion
+	if thinking == 0 {
+		thinking = price.OutputPerMillion
+	}
+	cost := float64(u.PromptTokens)*price.InputPerMillion +
+		float64(u.CandidateTokens)*price.OutputPerMillion +
+		float64(u.ThinkingTokens)*thinking
+	return cost / 1_000_000, true
+}
+
+// key identifies a stage/model pair in the tracker.
+type key struct {
+	stage string
+	model string
+}
+
+// Tracker aggregates usage per stage and model for a single run.
+// It is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	entries map[key]*Usage
+}
+
+// NewTracker returns an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{entries: make(map[key]*Usage)}
+}
+
+// Add records the usage of one call made for stage on model.
+func (t *Tracker) Add(stage string, model string, u Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := key{stage: stage, model: model}
+	if t.entries[k] == nil {
+		t.entries[k] = &Usage{}
+	}
+	t.entries[k].add(u)
+}
+
+// StageReport is the usage and cost of one stage on one model.
+type StageReport struct {
+	Stage   string  `json:"stage"`
+	Model   string  `json:"model"`
+	Usage   Usage   `json:"usage"`
+	CostUSD float64 `json:"costUSD"`
+	Priced  bool    `json:"priced"` // False if the model was missing from the price table
+}
+
+// Report is the aggregated usage and cost of a run.
+type Report struct {
+	Stages  []StageReport `json:"stages"`
+	Total   Usage         `json:"total"`
+	CostUSD float64       `json:"costUSD"`
+}
+
+// Report builds a usage report for everything recorded so far, priced with prices.
+// Stages are sorted by name and model so the output is stable.
+func (t *Tracker) Report(prices PriceTable) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := Report{Stages: []StageReport{}}
+	for k, u := range t.entries {
+		cost, priced := prices.Cost(k.model, *u)
+		report.Stages = append(report.Stages, StageReport{Stage: k.stage, Model: k.model, Usage: *u, CostUSD: cost, Priced: priced})
+		report.Total.add(*u)
+		report.CostUSD += cost
+	}
+	sort.Slice(report.Stages, func(i, j int) bool {
+		if report.Stages[i].Stage != report.Stages[j].Stage {
+			return report.Stages[i].Stage < report.Stages[j].Stage
+		}
+		return report.Stages[i].Model < report.Stages[j].Model
+	})
+	return report
+}
+
+// WriteText prints the report as a human-readable table to w.
+func (r Report) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%-10s %-32s %6s %9s %9s %9s %10s\n", "STAGE", "MODEL", "CALLS", "PROMPT", "OUTPUT", "THINKING", "COST(USD)"); err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	for _, s := range r.Stages {
+		cost := fmt.Sprintf("%.6f", s.CostUSD)
+		if !s.Priced {
+			cost = "n/a"
+		}
+		if _, err := fmt.Fprintf(w, "%-10s %-32s %6d %9d %9d %9d %10s\n", s.Stage, s.Model, s.Usage.Calls, s.Usage.PromptTokens, s.Usage.CandidateTokens, s.Usage.ThinkingTokens, cost); err != nil {
+			return fmt.Errorf("failed to write usage report: %w", err)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%-10s %-32s %6d %9d %9d %9d %10.6f\n", "total", "", r.Total.Calls, r.Total.PromptTokens, r.Total.CandidateTokens, r.Total.ThinkingTokens, r.CostUSD)
+	if err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package variables
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Render fills in the variables of text from data. With an empty style, Go
+// templates are executed with text/template, and otherwise Mustache tags and
+// {name} placeholders are filled in; a text mixing Go and Mustache tags
+// needs an explicit style. Every variable must have a value in data. Values
+// are inserted as they are, without HTML escaping.
+func Render(text string, data map[string]any, style Style) (string, error) {
+	if style == "" {
+		style = detect(Find(text))
+		if style == "" {
+			return "", fmt.Errorf("the template mixes Go and Mustache tags; choose one with a style")
+		}
+	}
+	switch style {
+	case Go:
+		return renderGo(text, data)
+	case Mustache, Brace:
+		return renderMustache(text, data)
+	default:
+		return "", fmt.Errorf("unknown template style '%s' (expected go, mustache or brace)", style)
+	}
+}
+
+// detect returns the style Render uses for vars, or "" if it is ambiguous.
+// {{.}} is left out: both styles use it for the current value.
+func detect(vars []Variable) Style {
+	hasGo, hasMustache := false, false
+	for _, v := range vars {
+		if v.Name == "." {
+			continue
+		}
+		hasGo = hasGo || v.Style == Go
+		hasMustache = hasMustache || v.Style == Mustache
+	}
+	switch {
+	case hasGo && hasMustache:
+		return ""
+	case hasGo:
+		return Go
+	default:
+		return Mustache
+	}
+}
+
+// renderGo executes text as a Go template, failing on missing keys.
+func renderGo(text string, data map[string]any) (string, error) {
+	t, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Go template: %w", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render Go template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// --- Mustache ---
+
+// node is a piece of a parsed Mustache template.
+type node struct {
+	text     string // Literal text, with {name} placeholders
+	kind     byte   // 0 for text, 'v' for a variable, '#' or '^' for a section
+	name     string
+	children []node
+}
+
+// parseMustache parses text into nodes, matching sections with their ends.
+func parseMustache(text string) ([]node, error) {
+	type frame struct {
+		name  string
+		kind  byte
+		nodes []node
+	}
+	stack := []frame{{}}
+	last := 0
+	for _, loc := range double.FindAllStringIndex(text, -1) {
+		top := &stack[len(stack)-1]
+		top.nodes = append(top.nodes, node{text: text[last:loc[0]]})
+		last = loc[1]
+
+		v := classify(text[loc[0]:loc[1]])
+		name := v.Name
+		switch {
+		case strings.HasPrefix(v.Text, "{{{"):
+			top.nodes = append(top.nodes, node{kind: 'v', name: name})
+		case name == "":
+			return nil, fmt.Errorf("empty tag %s", v.Text)
+		case name[0] == '!':
+			// Comment
+		case name[0] == '#' || name[0] == '^':
+			stack = append(stack, frame{name: strings.TrimSpace(name[1:]), kind: name[0]})
+		case name[0] == '/':
+			closing := strings.TrimSpace(name[1:])
+			if len(stack) == 1 || top.name != closing {
+				return nil, fmt.Errorf("unexpected section end %s", v.Text)
+			}
+			stack = stack[:len(stack)-1]
+			parent := &stack[len(stack)-1]
+			parent.nodes = append(parent.nodes, node{kind: top.kind, name: top.name, children: top.nodes})
+		case name[0] == '>':
+			return nil, fmt.Errorf("partials such as %s are not supported", v.Text)
+		case name[0] == '&':
+			top.nodes = append(top.nodes, node{kind: 'v', name: strings.TrimSpace(name[1:])})
+		default:
+			top.nodes = append(top.nodes, node{kind: 'v', name: name})
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("section '%s' is never closed", stack[len(stack)-1].name)
+	}
+	stack[0].nodes = append(stack[0].nodes, node{text: text[last:]})
+	return stack[0].nodes, nil
+}
+
+// renderMustache fills in the Mustache tags and {name} placeholders of text.
+func renderMustache(text string, data map[string]any) (string, error) {
+	nodes, err := parseMustache(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Mustache template: %w", err)
+	}
+	r := &mustacheRenderer{missing: make(map[string]bool)}
+	r.render(nodes, []any{data})
+	if len(r.missing) > 0 {
+		names := make([]string, 0, len(r.missing))
+		for name := range r.missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("no value for %s", strings.Join(names, ", "))
+	}
+	return r.b.String(), nil
+}
+
+// mustacheRenderer renders nodes, collecting the names that have no value.
+type mustacheRenderer struct {
+	b       strings.Builder
+	missing map[string]bool
+}
+
+// render writes nodes with the context stack contexts, innermost last.
+func (r *mustacheRenderer) render(nodes []node, contexts []any) {
+	for _, n := range nodes {
+		switch n.kind {
+		case 0:
+			r.renderText(n.text, contexts)
+		case 'v':
+			value, found := lookup(n.name, contexts)
+			if !found {
+				r.missing[n.name] = true
+				continue
+			}
+			if value != nil {
+				r.b.WriteString(fmt.Sprint(value))
+			}
+		case '#', '^':
+			value, found := lookup(n.name, contexts)
+			if !found {
+				// As in Mustache, a missing section is false: it is
+				// skipped, and an inverted one is rendered.
+				if n.kind == '^' {
+					r.render(n.children, contexts)
+				}
+				continue
+			}
+			items, truthy := sectionItems(value)
+			switch {
+			case n.kind == '^':
+				if !truthy {
+					r.render(n.children, contexts)
+				}
+			case items != nil:
+				for _, item := range items {
+					r.render(n.children, append(contexts, item))
+				}
+			case truthy:
+				r.render(n.children, append(contexts, value))
+			}
+		}
+	}
+}
+
+// renderText writes literal text, filling in its {name} placeholders.
+func (r *mustacheRenderer) renderText(text string, contexts []any) {
+	last := 0
+	for _, loc := range singleMatches(text) {
+		r.b.WriteString(text[last:loc[0]])
+		last = loc[1]
+		name := text[loc[0]+1 : loc[1]-1]
+		value, found := lookup(name, contexts)
+		if !found {
+			r.missing[name] = true
+			continue
+		}
+		if value != nil {
+			r.b.WriteString(fmt.Sprint(value))
+		}
+	}
+	r.b.WriteString(text[last:])
+}
+
+// lookup resolves a dotted name against the context stack, innermost
+// first. "." is the innermost context.
+func lookup(name string, contexts []any) (any, bool) {
+	if name == "." {
+		return contexts[len(contexts)-1], true
+	}
+	parts := strings.Split(name, ".")
+	for i := len(contexts) - 1; i >= 0; i-- {
+		value, found := field(contexts[i], parts[0])
+		if !found {
+			continue
+		}
+		for _, part := range parts[1:] {
+			if value, found = field(value, part); !found {
+				return nil, false
+			}
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+// field returns the value of key in a map decoded from JSON or YAML.
+func field(context any, key string) (any, bool) {
+	switch m := context.(type) {
+	case map[string]any:
+		value, found := m[key]
+		return value, found
+	case map[any]any:
+		value, found := m[key]
+		return value, found
+	default:
+		return nil, false
+	}
+}
+
+// sectionItems returns the items a section is repeated for when value is a
+// list, and whether value counts as true.
+func sectionItems(value any) ([]any, bool) {
+	if value == nil {
+		return nil, false
+	}
+	if list, ok := value.([]any); ok {
+		return list, len(list) > 0
+	}
+	if b, ok := value.(bool); ok {
+		return nil, b
+	}
+	if s, ok := value.(string); ok {
+		return nil, s != ""
+	}
+	return nil, true
+}
@@ -0,0 +1,170 @@
+// Package variables finds the template variables of a prompt, checks that
+// an enhanced prompt kept them, and fills them in from data.
+//
+// Three styles are recognized: Go text/template actions ({{.Name}},
+// {{if .Premium}}...{{end}}), Mustache tags ({{name}}, {{#items}}...{{/items}})
+// and single-brace placeholders ({name}).
+package variables
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Style is the template syntax a variable is written in.
+type Style string
+
+// Template styles.
+const (
+	Go       Style = "go"
+	Mustache Style = "mustache"
+	Brace    Style = "brace"
+)
+
+// Variable is one placeholder or template action as written in a prompt.
+type Variable struct {
+	Text  string `json:"text"`  // Exactly as written, such as "{{ .Name }}"
+	Name  string `json:"name"`  // Contents without delimiters, such as ".Name" or "#items"
+	Style Style  `json:"style"` // go, mustache or brace
+}
+
+// key identifies v regardless of the spacing inside its delimiters.
+func (v Variable) key() string {
+	return string(v.Style) + " " + strings.Join(strings.Fields(v.Name), " ")
+}
+
+var (
+	// double matches {{...}} and Mustache's unescaped {{{...}}}.
+	double = regexp.MustCompile(`\{\{\{[^{}]*\}\}\}|\{\{[^{}]*\}\}`)
+	// single matches a {name} placeholder; neighbors are checked separately.
+	single = regexp.MustCompile(`\{[A-Za-z_][A-Za-z0-9_.]*\}`)
+	// inlineCode matches a `code` span on one line.
+	inlineCode = regexp.MustCompile("`[^`\n]+`")
+	// mustacheName matches a Mustache variable or section name.
+	mustacheName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// goWords start Go template actions that could otherwise pass for Mustache names.
+var goWords = []string{
+	"if", "else", "end", "range", "with", "template", "block", "define", "break", "continue",
+	"len", "index", "print", "printf", "println", "not", "and", "or", "eq", "ne", "lt", "le", "gt", "ge",
+	"call", "html", "js", "urlquery", "slice",
+}
+
+// Find returns the variables of text in order of appearance, each written
+// form once.
+func Find(text string) []Variable {
+	var found []Variable
+	seen := make(map[string]bool)
+	add := func(v Variable) {
+		if !seen[v.Text] {
+			seen[v.Text] = true
+			found = append(found, v)
+		}
+	}
+	// Double braces are blanked out first so their inner braces are not
+	// taken for single-brace placeholders.
+	blanked := []byte(text)
+	for _, loc := range double.FindAllStringIndex(text, -1) {
+		add(classify(text[loc[0]:loc[1]]))
+		for i := loc[0]; i < loc[1]; i++ {
+			blanked[i] = ' '
+		}
+	}
+	for _, loc := range singleMatches(string(blanked)) {
+		match := text[loc[0]:loc[1]]
+		add(Variable{Text: match, Name: match[1 : len(match)-1], Style: Brace})
+	}
+	slices.SortStableFunc(found, func(a, b Variable) int {
+		return strings.Index(text, a.Text) - strings.Index(text, b.Text)
+	})
+	return found
+}
+
+// singleMatches returns the locations of the {name} placeholders of text.
+// A placeholder stands on its own, between whitespace or punctuation, and
+// outside inline code, so LaTeX (\frac{a}{b}), shell (${HOME}) and code
+// such as `{return}` or f{x} are not taken for one.
+func singleMatches(text string) [][]int {
+	code := inlineCode.FindAllStringIndex(text, -1)
+	var matches [][]int
+	for _, loc := range single.FindAllStringIndex(text, -1) {
+		inCode := slices.ContainsFunc(code, func(c []int) bool { return c[0] < loc[0] && loc[1] < c[1] })
+		if inCode || !standsAlone(text, loc) {
+			continue
+		}
+		matches = append(matches, loc)
+	}
+	return matches
+}
+
+// standsAlone reports whether the text around loc separates it from other
+// words: the characters on both sides, if any, are whitespace or
+// punctuation other than braces, and the one before is not \, $ or _.
+func standsAlone(text string, loc []int) bool {
+	if loc[0] > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:loc[0]])
+		if !separator(r) || r == '\\' || r == '$' {
+			return false
+		}
+	}
+	if loc[1] < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[loc[1]:])
+		if !separator(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// separator reports whether r may stand next to a {name} placeholder.
+func separator(r rune) bool {
+	if r == '{' || r == '}' || r == '_' {
+		return false
+	}
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// classify tells a {{...}} tag written for Go templates from a Mustache one.
+func classify(tag string) Variable {
+	if strings.HasPrefix(tag, "{{{") {
+		return Variable{Text: tag, Name: strings.TrimSpace(tag[3 : len(tag)-3]), Style: Mustache}
+	}
+	inner := tag[2 : len(tag)-2]
+	name := strings.TrimSpace(inner)
+	switch {
+	case strings.HasPrefix(inner, "- ") || strings.HasSuffix(inner, " -"):
+		return Variable{Text: tag, Name: name, Style: Go} // Trim markers
+	case strings.HasPrefix(name, "/*"):
+		return Variable{Text: tag, Name: name, Style: Go} // Comment
+	case name != "" && strings.ContainsRune("#^/>!&", rune(name[0])):
+		return Variable{Text: tag, Name: name, Style: Mustache}
+	case name == "" || strings.ContainsRune(".$\"(", rune(name[0])):
+		return Variable{Text: tag, Name: name, Style: Go}
+	case slices.Contains(goWords, strings.Fields(name)[0]):
+		return Variable{Text: tag, Name: name, Style: Go}
+	case mustacheName.MatchString(name):
+		return Variable{Text: tag, Name: name, Style: Mustache}
+	default:
+		return Variable{Text: tag, Name: name, Style: Go}
+	}
+}
+
+// Missing returns the variables of want that text does not contain. Spacing
+// inside the delimiters is ignored, so "{{ name }}" keeps "{{name}}".
+func Missing(want []Variable, text string) []Variable {
+	present := make(map[string]bool)
+	for _, v := range Find(text) {
+		present[v.key()] = true
+	}
+	var missing []Variable
+	for _, v := range want {
+		if !present[v.key()] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,124 @@
+package variables
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string // Style and text of each variable
+	}{
+		{"none", "Write a poem about the sea.", nil},
+		{"go", "Hello {{.Name}}, {{if .Premium}}thanks{{end}}.", []string{"go {{.Name}}", "go {{if .Premium}}", "go {{end}}"}},
+		{"go trim markers", "{{- .Name -}}", []string{"go {{- .Name -}}"}},
+		{"mustache", "Hi {{name}}.{{#items}}- {{.}}{{/items}}{{{html}}}", []string{"mustache {{name}}", "mustache {{#items}}", "go {{.}}", "mustache {{/items}}", "mustache {{{html}}}"}},
+		{"brace", "Ticket {ticket_id}: reply to {customer.name}.", []string{"brace {ticket_id}", "brace {customer.name}"}},
+		{"brace next to punctuation", "({a}), \"{b}\" and {c}'s", []string{"brace {a}", "brace {b}", "brace {c}"}},
+		{"each written form once", "{{name}} and {{name}} and {{ name }}", []string{"mustache {{name}}", "mustache {{ name }}"}},
+		{"latex", `Solve \frac{a}{b} = x^{2}.`, nil},
+		{"shell", "Print ${HOME} and $HOME.", nil},
+		{"inline code", "Explain `{return}` and `f{x}` in Go.", nil},
+		{"inside a word", "Call f{x} or map{key}s.", nil},
+		{"adjacent braces", "Use {a}{b} as a pair.", nil},
+		{"json is not a placeholder", `Return {"name": "x"}.`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range Find(tt.text) {
+				got = append(got, string(v.Style)+" "+v.Text)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Find(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissing(t *testing.T) {
+	want := Find("Dear {{name}}, your ticket {ticket_id} about {{.Topic}} is open.")
+	tests := []struct {
+		name     string
+		enhanced string
+		missing  []string
+	}{
+		{"all kept", "Ticket {ticket_id}: write to {{name}} about {{.Topic}}.", nil},
+		{"spacing inside delimiters", "Ticket {ticket_id}: write to {{ name }} about {{ .Topic }}.", nil},
+		{"one lost", "Write to {{name}} about {{.Topic}}.", []string{"{ticket_id}"}},
+		{"rewritten", "Ticket {ticket_id}: write to {name} about {{.topic}}.", []string{"{{name}}", "{{.Topic}}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range Missing(want, tt.enhanced) {
+				got = append(got, v.Text)
+			}
+			if !slices.Equal(got, tt.missing) {
+				t.Errorf("Missing = %q, want %q", got, tt.missing)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := map[string]any{
+		"name":    "Ana",
+		"Premium": true,
+		"vip":     false,
+		"items":   []any{"tea", "cake"},
+		"customer": map[string]any{
+			"name": "Luis",
+		},
+		"orders": []any{
+			map[string]any{"id": 1},
+			map[string]any{"id": 2},
+		},
+	}
+	tests := []struct {
+		name    string
+		text    string
+		style   Style
+		want    string
+		wantErr string
+	}{
+		{"no variables", "Plain text.", "", "Plain text.", ""},
+		{"go", "Hi {{.name}}{{if .Premium}}, thanks{{end}}.", "", "Hi Ana, thanks.", ""},
+		{"go range", "{{range .items}}[{{.}}]{{end}}", "", "[tea][cake]", ""},
+		{"go missing key", "Hi {{.nobody}}", "", "", "failed to render Go template"},
+		{"mustache", "Hi {{name}} and {{customer.name}}.", "", "Hi Ana and Luis.", ""},
+		{"mustache list", "{{#items}}- {{.}}\n{{/items}}", "", "- tea\n- cake\n", ""},
+		{"mustache objects", "{{#orders}}#{{id}} {{name}};{{/orders}}", "", "#1 Ana;#2 Ana;", ""},
+		{"mustache inverted", "{{^vip}}regular{{/vip}}{{^Premium}}basic{{/Premium}}", "", "regular", ""},
+		{"mustache missing section is false", "{{#nothing}}x{{/nothing}}{{^nothing}}y{{/nothing}}", "", "y", ""},
+		{"mustache comment", "a{{! note }}b", "", "ab", ""},
+		{"mustache unescaped", "{{{name}}} {{& name}}", "", "Ana Ana", ""},
+		{"brace", "Hi {name} from {customer.name}.", "", "Hi Ana from Luis.", ""},
+		{"brace in latex is left alone", `Hi {name}: \frac{a}{b}`, "", `Hi Ana: \frac{a}{b}`, ""},
+		{"missing values", "{{a}} {b} {{a}}", "", "", "no value for a, b"},
+		{"mixed styles", "{{.name}} {{name}}", "", "", "mixes Go and Mustache"},
+		{"mixed styles with explicit style", "{{name}} {{#items}}{{.}}{{/items}}", Mustache, "Ana teacake", ""},
+		{"unclosed section", "{{#items}}x", "", "", "never closed"},
+		{"partials", "{{> header}}", Mustache, "", "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.text, data, tt.style)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Render error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
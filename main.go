@@ -2,157 +2,223 @@
 package main
 
 import (
-	"bufio"
-	"context" // Add context import
+	"errors"
 	"flag"
 	"fmt"
-	"log" // Using log for simple error reporting
-	"os"  // Add os import
+	"os"
 	"strings"
 
-	// It's conventional to alias internal packages based on their directory name.
-	// These imports will be uncommented as the packages are implemented.
-	config "tokinfo/internal/config"
-	gemini "tokinfo/internal/gemini"
 	prompt "tokinfo/internal/prompt"
 )
 
-func main() {
-	// Define command-line flags for user input and output options.
-	promptInput := flag.String("p", "", "Prompt string or path to prompt file (.txt, .md) (required)")
-	// outputPath is currently unused in the Analysis & Clarification phase,
-	// but is kept for future phases.
-	outputPath := flag.String("g", "", "Optional path to save the generated prompt")
-	verbose := flag.Bool("verbose", false, "Enable verbose output") // Add verbose flag
-	flag.Parse()
-
-	// --- Input Validation ---
-	if *promptInput == "" {
-		log.Fatal("Error: -p flag (prompt input) is required.") // Use log.Fatal for cleaner exit on error
-	}
+// Exit codes shared by every command.
+const (
+	exitOK    = 0
+	exitError = 1 // The command ran but failed
+	exitUsage = 2 // Invalid command, flags or arguments
+)
 
-	if *verbose {
-		fmt.Println("Starting Tokinfo: Prompt Enhancement Tool...") // Indicate start
-	}
+// command describes a tokinfo subcommand.
+type command struct {
+	name    string
+	usage   string // Argument synopsis shown after the command name
+	summary string
+	words   []string // Fixed words accepted as the first argument, for shell completion
+	// define registers the command's flags on fs and returns the function that
+	// runs the command with the remaining positional arguments once fs is parsed.
+	define func(fs *flag.FlagSet) func(args []string) error
+	// subcommands take over when the first argument names them, with flags
+	// of their own; their names start with the command's, as in "history rerun".
+	subcommands []*command
+}
 
-	// --- Load Guidelines ---
-	guidelines, err := config.LoadGuidelines("guidelines.json", *verbose) // Pass verbose flag
-	if err != nil {
-		log.Fatalf("Error loading guidelines: %v", err)
-	}
-	if *verbose {
-		fmt.Println("Guidelines loaded.") // Progress message
+// subcommand returns the subcommand of c named by arg, or nil.
+func (c *command) subcommand(arg string) *command {
+	for _, sub := range c.subcommands {
+		if sub.name == c.name+" "+arg {
+			return sub
+		}
 	}
+	return nil
+}
 
-	// --- Read User Prompt ---
-	userPrompt, err := prompt.ReadInput(*promptInput, *verbose) // Pass verbose flag
-	if err != nil {
-		log.Fatalf("Error reading prompt input: %v", err)
+// commands returns every subcommand in the order they are listed in help.
+func commands() []*command {
+	return []*command{
+		enhanceCommand(),
+		analyzeCommand(),
+		tuiCommand(),
+		batchCommand(),
+		serveCommand(),
+		mcpCommand(),
+		lspCommand(),
+		evalCommand(),
+		judgeCommand(),
+		lintCommand(),
+		regressCommand(),
+		historyCommand(),
+		libCommand(),
+		memoryCommand(),
+		renderCommand(),
+		countCommand(),
+		guidelinesCommand(),
+		cacheCommand(),
+		completionCommand(),
+		helpCommand(),
 	}
-	if *verbose {
-		fmt.Println("User prompt read successfully.") // Progress message
+}
+
+// completionWords returns the fixed words cmd accepts as its first argument.
+func (c *command) completionWords() []string {
+	if c.name == "help" {
+		// help takes any command name; listing them here avoids an initialization loop.
+		return commandNames()
 	}
+	return c.words
+}
 
-	// --- Initialize Gemini Client ---
-	apiKey := os.Getenv("GEMINI_API_KEY") // Get API key from environment variable
-	if apiKey == "" {
-		log.Fatal("Error: GEMINI_API_KEY environment variable not set.")
+// findCommand returns the command called name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd
+		}
 	}
+	return nil
+}
 
-	// Create a context
-	ctx := context.Background()
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Initialize the Gemini client
-	geminiClient, err := gemini.NewClient(ctx, apiKey, *verbose) // Pass verbose flag
-	if err != nil {
-		log.Fatalf("Error initializing Gemini client: %v", err)
+// run dispatches args to a subcommand and returns the process exit code.
+// Without a known subcommand name, the arguments are passed to `enhance`, so
+// `tokinfo "prompt"` and `tokinfo -p prompt` keep working.
+func run(args []string) int {
+	if len(args) == 0 && !prompt.StdinIsPiped() {
+		printUsage()
+		return exitUsage
 	}
-	defer geminiClient.Close() // Ensure resources are released
-	if *verbose {
-		fmt.Println("Gemini client initialized.") // Progress message
+
+	cmd := enhanceCommand()
+	if len(args) > 0 {
+		if found := findCommand(args[0]); found != nil {
+			cmd, args = found, args[1:]
+		}
+	}
+	if len(args) > 0 {
+		if sub := cmd.subcommand(args[0]); sub != nil {
+			cmd, args = sub, args[1:]
+		}
 	}
 
-	// --- Stage 1: Analysis & Clarification ---
-	// Summarize techniques for the Gemini API call
-	var summarizedTechniques string
-	for _, tech := range guidelines.Techniques {
-		summarizedTechniques += fmt.Sprintf("- %s: %s\n", tech.Name, tech.Summarized)
+	err := runCommand(cmd, args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case isUsageError(err):
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Run 'tokinfo help %s' for usage.\n", cmd.name)
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
 	}
+}
 
-	// --- Stage 1: Analysis & Clarification ---
-	// Call the AnalyzePrompt method on the Gemini client.
-	// This sends the introduction, summarized techniques, and user prompt to the Gemini model
-	// for analysis and to get clarifying questions.
-	analysisResult, err := geminiClient.AnalyzePrompt(ctx, guidelines.Introduction, summarizedTechniques, userPrompt)
+// runCommand parses the command's flags from args and runs it.
+func runCommand(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	runFn := cmd.define(fs)
+	positional, err := parseInterspersed(fs, args)
 	if err != nil {
-		log.Fatalf("Error during Stage 1 Gemini call: %v", err)
-	}
-	if *verbose {
-		fmt.Println("Stage 1 analysis complete. Chosen technique:", analysisResult.ChosenTechniqueName)
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageErrorf("%v", err)
 	}
+	return runFn(positional)
+}
 
-	// --- User Interaction ---
-	userAnswers := make(map[string]string) // Initialize map for answers
-	if len(analysisResult.ClarifyingQuestions) > 0 {
-		if *verbose {
-			fmt.Println("\nPlease answer the following questions to help refine the prompt:")
+// newFlagSet returns an empty flag set whose usage message describes cmd.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tokinfo %s %s\n\n%s\n", cmd.name, cmd.usage, cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(os.Stderr, "\nFlags:")
+			fs.PrintDefaults()
 		}
-		reader := bufio.NewReader(os.Stdin) // Create a reader for input
-
-		// Iterate over the slice of question strings
-		for i, questionText := range analysisResult.ClarifyingQuestions {
-			fmt.Printf("- %s: ", questionText) // Print the question text
-			answer, err := reader.ReadString('\n')
-			if err != nil {
-				// Basic error handling for reading input
-				log.Printf("Warning: Could not read answer for question %d ('%s'): %v. Skipping.", i+1, questionText, err)
-				continue // Skip this question if reading fails
-			}
-			// Trim newline characters (\r\n on Windows, \n on Unix)
-			// Use the question text as the key for the answer map
-			userAnswers[questionText] = strings.TrimSpace(answer)
+	}
+	return fs
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments, and returns the positional arguments in order.
+// Everything after "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
 		}
-		if *verbose {
-			fmt.Println("Thank you for your answers.")
+		remaining := fs.Args()
+		consumed := len(args) - len(remaining)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, remaining...), nil
 		}
-	} else {
-		if *verbose {
-			fmt.Println("No clarifying questions needed based on the analysis.")
+		if len(remaining) == 0 {
+			return positional, nil
 		}
+		positional = append(positional, remaining[0])
+		args = remaining[1:]
 	}
+}
 
-	// --- Stage 2: Refinement ---
-	chosenTechnique, found := config.GetTechniqueByName(guidelines.Techniques, analysisResult.ChosenTechniqueName)
-	if !found {
-		log.Fatalf("Error: Chosen technique '%s' not found in guidelines.", analysisResult.ChosenTechniqueName)
-	}
-	// userAnswers map is now populated from the interaction step above (if any questions were asked).
-	enhancedPrompt, err := geminiClient.RefinePrompt(ctx, guidelines.Introduction, chosenTechnique.Complete, userPrompt, userAnswers)
-	if err != nil {
-		log.Fatalf("Error during Stage 2 Gemini call: %v", err)
-	}
-	if *verbose {
-		fmt.Println("Stage 2 refinement complete.")
-	}
-
-	// --- Stage 3: Execute Enhanced Prompt ---
-	if *verbose {
-		fmt.Println("\nExecuting enhanced prompt with Gemini...")
+// printUsage prints the list of commands to stderr.
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "tokinfo improves prompts with Gemini using prompt engineering guidelines.")
+	fmt.Fprintln(os.Stderr, "\nUsage:\n  tokinfo <command> [flags] [arguments]\n  tokinfo [flags] \"prompt\"   (same as 'tokinfo enhance')")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, firstLine(cmd.summary))
 	}
+	fmt.Fprintln(os.Stderr, "\nRun 'tokinfo help <command>' for details on a command.")
+}
 
-	// The final result should ALWAYS be printed, regardless of verbose flag.
-	fmt.Println(enhancedPrompt)
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
 
-	// Final success message depends on output method
-	if *verbose && *outputPath != "" {
-		fmt.Printf("Enhanced prompt successfully saved to %s\n", *outputPath)
+// helpCommand prints general or per-command help.
+func helpCommand() *command {
+	return &command{
+		name:    "help",
+		usage:   "[command [subcommand]]",
+		summary: "Show help for tokinfo or for a single command.",
+		define: func(fs *flag.FlagSet) func(args []string) error {
+			return func(args []string) error {
+				if len(args) == 0 {
+					printUsage()
+					return nil
+				}
+				cmd := findCommand(args[0])
+				if cmd == nil {
+					return usageErrorf("unknown command '%s'", args[0])
+				}
+				if len(args) > 1 && cmd.subcommand(args[1]) != nil {
+					cmd = cmd.subcommand(args[1])
+				}
+				cmdFlags := newFlagSet(cmd)
+				cmd.define(cmdFlags)
+				cmdFlags.Usage()
+				return nil
+			}
+		},
 	}
-	// No need to print the enhanced prompt again here if HandleOutput already did
-	// The final Gemini response is printed above, outside the verbose check.
-
 }
-
-// Helper function to access refineConfig (needs to be added to client.go or accessed differently)
-// For now, let's assume we need to add a getter in client.go
-// Alternatively, pass nil if GenerateResponse handles it:
-// finalResult, err := geminiClient.GenerateResponse(ctx, "gemini-2.0-flash", enhancedPrompt, nil)